@@ -0,0 +1,398 @@
+package main_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/ui"
+	"github.com/ebisu/mugi/pkg/mugi"
+)
+
+var forges = []string{"github", "codeberg", "sourcehut"}
+
+var binary string
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "mugi-integration-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	binary = filepath.Join(dir, "mugi")
+
+	if output, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "build mugi: %v\n%s", err, output)
+
+		return 1
+	}
+
+	return m.Run()
+}
+
+type fixture struct {
+	t      *testing.T
+	root   string
+	config string
+	seed   string
+	work   string
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	gitConfig := filepath.Join(root, "gitconfig")
+
+	writeFile(t, gitConfig, "[init]\n\tdefaultBranch = main\n[user]\n\tname = Mugi\n\temail = mugi@example.com\n")
+
+	t.Setenv("HOME", filepath.Join(root, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "home", ".config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(root, "home", ".local", "state"))
+	t.Setenv("GIT_CONFIG_GLOBAL", gitConfig)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	f := &fixture{
+		t:      t,
+		root:   root,
+		config: filepath.Join(root, "config.yaml"),
+		seed:   filepath.Join(root, "seed"),
+		work:   filepath.Join(root, "work", "demo"),
+	}
+
+	var b strings.Builder
+
+	b.WriteString("remotes:\n")
+
+	for _, forge := range forges {
+		fmt.Fprintf(&b, "  %s:\n    url: file://%s/%s/${user}/${repo}.git\n", forge, root, forge)
+	}
+
+	fmt.Fprintf(&b, "defaults:\n  remotes: [%s]\n  path_prefix: %s\n", strings.Join(forges, ", "), filepath.Join(root, "work"))
+	b.WriteString("repos:\n  ebisu/demo:\n")
+
+	writeFile(t, f.config, b.String())
+
+	f.git(root, "init", "--quiet", f.seed)
+	f.commit(f.seed, "initial")
+
+	for _, forge := range forges {
+		f.git(root, "init", "--quiet", "--bare", f.bare(forge, "demo"))
+		f.git(f.seed, "push", "--quiet", f.url(forge, "demo"), "main")
+	}
+
+	return f
+}
+
+func (f *fixture) bare(forge, repo string) string {
+	return filepath.Join(f.root, forge, "ebisu", repo+".git")
+}
+
+func (f *fixture) url(forge, repo string) string {
+	return "file://" + f.bare(forge, repo)
+}
+
+func (f *fixture) git(dir string, args ...string) string {
+	f.t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+func (f *fixture) commit(dir, message string) string {
+	f.t.Helper()
+
+	writeFile(f.t, filepath.Join(dir, "log.txt"), message+"\n")
+	f.git(dir, "add", "log.txt")
+	f.git(dir, "commit", "--quiet", "-m", message)
+
+	return f.rev(dir, "HEAD")
+}
+
+func (f *fixture) rev(dir, ref string) string {
+	f.t.Helper()
+
+	return f.git(dir, "rev-parse", ref)
+}
+
+func (f *fixture) advance(forge, message string) string {
+	f.t.Helper()
+
+	clone := filepath.Join(f.t.TempDir(), forge)
+
+	f.git(f.root, "clone", "--quiet", f.url(forge, "demo"), clone)
+
+	sha := f.commit(clone, message)
+	f.git(clone, "push", "--quiet", "origin", "main")
+
+	return sha
+}
+
+func (f *fixture) mugi(args ...string) string {
+	f.t.Helper()
+
+	cmd := exec.Command(binary, append([]string{"-c", f.config, "--plain"}, args...)...)
+	cmd.Dir = f.root
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("mugi %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+
+	return string(output)
+}
+
+func (f *fixture) loadConfig() config.Config {
+	f.t.Helper()
+
+	cfg, err := config.Load(f.config)
+	if err != nil {
+		f.t.Fatalf("load config: %v", err)
+	}
+
+	return cfg
+}
+
+func (f *fixture) clone() {
+	f.t.Helper()
+
+	tasks := mugi.Plan(f.loadConfig(), mugi.All, nil, mugi.Pull)
+	inits := ui.NeedsInit(context.Background(), git.ExecRunner{}, tasks)
+
+	if len(inits) != 1 || inits[0].Path != f.work {
+		f.t.Fatalf("NeedsInit() = %+v, want %s", inits, f.work)
+	}
+
+	if result := ui.InitRepo(context.Background(), git.ExecRunner{}, inits[0]); !result.Success {
+		f.t.Fatalf("InitRepo() failed: %s", result.Output)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFirstClone(t *testing.T) {
+	f := newFixture(t)
+	f.clone()
+
+	if got, want := f.rev(f.work, "HEAD"), f.rev(f.seed, "HEAD"); got != want {
+		t.Errorf("HEAD = %s, want %s", got, want)
+	}
+
+	remotes := strings.Fields(f.git(f.work, "remote"))
+	slices.Sort(remotes)
+
+	if want := []string{"codeberg", "github", "sourcehut"}; !slices.Equal(remotes, want) {
+		t.Fatalf("remotes = %q, want %q", remotes, want)
+	}
+
+	for _, forge := range forges {
+		if got := f.git(f.work, "remote", "get-url", forge); got != f.url(forge, "demo") {
+			t.Errorf("%s url = %s, want %s", forge, got, f.url(forge, "demo"))
+		}
+	}
+
+	if ui.NeedsInit(context.Background(), git.ExecRunner{}, mugi.Plan(f.loadConfig(), mugi.All, nil, mugi.Pull)) != nil {
+		t.Error("NeedsInit() after clone, want nothing to initialise")
+	}
+}
+
+func TestPlainPullClones(t *testing.T) {
+	f := newFixture(t)
+
+	output := f.mugi("pull")
+
+	if !strings.Contains(output, "✓ demo\n") || !strings.Contains(output, "3 succeeded") {
+		t.Errorf("output = %q, want clone and 3 succeeded", output)
+	}
+
+	if got, want := f.rev(f.work, "HEAD"), f.rev(f.seed, "HEAD"); got != want {
+		t.Errorf("HEAD = %s, want %s", got, want)
+	}
+}
+
+func TestPullFetchesSecondaryRemotes(t *testing.T) {
+	f := newFixture(t)
+	f.clone()
+
+	initial := f.rev(f.work, "HEAD")
+	upstream := f.advance("github", "upstream")
+	diverged := f.advance("codeberg", "diverged")
+
+	f.mugi("pull")
+
+	if got := f.rev(f.work, "HEAD"); got != upstream {
+		t.Errorf("HEAD = %s, want fast-forward to %s", got, upstream)
+	}
+
+	refs := map[string]string{
+		"refs/remotes/github/main":    upstream,
+		"refs/remotes/codeberg/main":  diverged,
+		"refs/remotes/sourcehut/main": initial,
+	}
+
+	for ref, want := range refs {
+		if got := f.rev(f.work, ref); got != want {
+			t.Errorf("%s = %s, want %s", ref, got, want)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	f := newFixture(t)
+	f.clone()
+
+	local := f.commit(f.work, "local")
+
+	output := f.mugi("push")
+
+	if !strings.Contains(output, "3 succeeded") {
+		t.Errorf("output = %q, want 3 succeeded", output)
+	}
+
+	for _, forge := range forges {
+		if got := f.rev(f.bare(forge, "demo"), "main"); got != local {
+			t.Errorf("%s main = %s, want %s", forge, got, local)
+		}
+	}
+}
+
+func TestPushRepairsRemoteURL(t *testing.T) {
+	f := newFixture(t)
+	f.clone()
+
+	f.git(f.work, "remote", "set-url", "codeberg", f.url("codeberg", "stale"))
+	f.git(f.work, "remote", "remove", "sourcehut")
+
+	local := f.commit(f.work, "local")
+
+	f.mugi("push")
+
+	for _, forge := range forges {
+		if got := f.git(f.work, "remote", "get-url", forge); got != f.url(forge, "demo") {
+			t.Errorf("%s url = %s, want %s", forge, got, f.url(forge, "demo"))
+		}
+
+		if got := f.rev(f.bare(forge, "demo"), "main"); got != local {
+			t.Errorf("%s main = %s, want %s", forge, got, local)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	f := newFixture(t)
+	f.clone()
+
+	initial := f.rev(f.work, "HEAD")
+	ahead := f.advance("sourcehut", "ahead")
+
+	f.mugi("fetch")
+
+	if got := f.rev(f.work, "refs/remotes/sourcehut/main"); got != ahead {
+		t.Errorf("sourcehut/main = %s, want %s", got, ahead)
+	}
+
+	if got := f.rev(f.work, "HEAD"); got != initial {
+		t.Errorf("HEAD = %s, want unchanged %s", got, initial)
+	}
+}
+
+func TestAddAndRemove(t *testing.T) {
+	f := newFixture(t)
+
+	tool := filepath.Join(f.root, "tool")
+
+	f.git(f.root, "init", "--quiet", tool)
+	f.git(tool, "remote", "add", "origin", f.url("github", "tool"))
+	f.git(tool, "remote", "add", "backup", f.url("codeberg", "tool"))
+
+	if output := f.mugi("add", tool); !strings.Contains(output, "Added repository: ebisu/tool") {
+		t.Fatalf("add output = %q", output)
+	}
+
+	repo, ok := f.loadConfig().Repos["ebisu/tool"]
+	if !ok {
+		t.Fatal("ebisu/tool missing from config after add")
+	}
+
+	if repo.Path != tool {
+		t.Errorf("path = %s, want %s", repo.Path, tool)
+	}
+
+	for _, forge := range []string{"github", "codeberg"} {
+		if got := repo.Remotes[forge]; got != f.url(forge, "tool") {
+			t.Errorf("%s = %s, want %s", forge, got, f.url(forge, "tool"))
+		}
+	}
+
+	if _, ok := repo.Remotes["sourcehut"]; ok {
+		t.Error("sourcehut added although the working copy has no such remote")
+	}
+
+	f.mugi("rm", "ebisu/tool")
+
+	cfg := f.loadConfig()
+
+	if _, ok := cfg.Repos["ebisu/tool"]; ok {
+		t.Error("ebisu/tool still in config after rm")
+	}
+
+	if _, ok := cfg.Repos["ebisu/demo"]; !ok {
+		t.Error("rm removed ebisu/demo")
+	}
+}
+
+func TestPlainGit(t *testing.T) {
+	f := newFixture(t)
+	f.clone()
+
+	output := f.mugi("git", "demo", "--", "rev-parse", "HEAD")
+
+	if !strings.Contains(output, "✓ demo\n") || !strings.Contains(output, f.rev(f.seed, "HEAD")) {
+		t.Errorf("output = %q, want demo's HEAD", output)
+	}
+
+	output = f.mugi("git", "rev-parse", "--abbrev-ref", "HEAD")
+
+	if !strings.Contains(output, "main") || !strings.Contains(output, "1 succeeded") {
+		t.Errorf("output = %q, want the branch of every repository", output)
+	}
+}
@@ -1,20 +1,42 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ebisu/mugi/internal/cli"
 	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/forge"
+	"github.com/ebisu/mugi/internal/git"
 	"github.com/ebisu/mugi/internal/manage"
+	"github.com/ebisu/mugi/internal/notify"
+	"github.com/ebisu/mugi/internal/redact"
+	"github.com/ebisu/mugi/internal/remote"
+	"github.com/ebisu/mugi/internal/schedule"
 	"github.com/ebisu/mugi/internal/ui"
+	"github.com/ebisu/mugi/internal/watch"
+	"github.com/ebisu/mugi/pkg/mugi"
 )
 
 const version = "0.1.0"
 
+var gitRunner git.Runner = git.ExecRunner{}
+
 func main() {
 	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, redact.Error(err))
 		os.Exit(1)
 	}
 }
@@ -25,6 +47,8 @@ func run() error {
 		return err
 	}
 
+	redact.SetEnabled(!cmd.NoRedact)
+
 	if cmd.Help {
 		fmt.Println(cli.Usage())
 
@@ -32,7 +56,7 @@ func run() error {
 	}
 
 	if cmd.Version {
-		fmt.Printf("mugi %s\n", version)
+		printf("mugi %s\n", version)
 
 		return nil
 	}
@@ -49,11 +73,18 @@ func run() error {
 			return fmt.Errorf("config: %w", err)
 		}
 
-		if err := manage.Add(cmd.Path, configPath, cfg.Remotes); err != nil {
+		if cmd.Scan {
+			return runScan(cmd, configPath, cfg)
+		}
+
+		info, suggestions, err := manage.Add(context.Background(), gitRunner, cmd.Path, configPath, cfg)
+		if err != nil {
 			return err
 		}
 
-		fmt.Printf("Added repository: %s\n", cmd.Path)
+		printf("Added repository: %s (%s)\n", info.Name, info.Path)
+
+		printSuggestions(suggestions)
 
 		return nil
 
@@ -62,7 +93,7 @@ func run() error {
 			return err
 		}
 
-		fmt.Printf("Removed repository: %s\n", cmd.Repo)
+		printf("Removed repository: %s\n", cmd.Repo)
 
 		return nil
 
@@ -73,10 +104,42 @@ func run() error {
 		}
 
 		for _, repo := range repos {
-			fmt.Printf("%s (%s)\n", repo.Name, repo.Path)
+			printf("%s (%s)\n", repo.Name, repo.Path)
+		}
+
+		if cfg, err := config.Load(configPath); err == nil {
+			warnCollisions(cfg)
 		}
 
 		return nil
+
+	case cli.CommandRemote:
+		return runRemote(cmd, configPath)
+
+	case cli.CommandRepo:
+		return runRepo(cmd, configPath)
+
+	case cli.CommandRelocate:
+		return runRelocate(cmd, configPath)
+
+	case cli.CommandMirror:
+		return runMirror(cmd, configPath)
+	case cli.CommandMeta:
+		return runMeta(cmd, configPath)
+	case cli.CommandImport:
+		return runImport(cmd, configPath)
+	case cli.CommandUpdateForks:
+		return runUpdateForks(cmd, configPath)
+	case cli.CommandExec, cli.CommandGit:
+		return runExec(cmd, configPath)
+	case cli.CommandCheck:
+		return runCheck(cmd, configPath)
+	case cli.CommandWatch:
+		return runWatch(cmd, configPath)
+	case cli.CommandSchedule:
+		return runSchedule(cmd, configPath)
+	case cli.CommandHooks:
+		return runHooks(cmd, configPath)
 	}
 
 	cfg, err := config.Load(configPath)
@@ -85,29 +148,1216 @@ func run() error {
 	}
 
 	applyDefaults(&cmd, cfg)
+	warnCollisions(cfg)
 
-	tasks := ui.BuildTasks(cfg, cmd.Repo, cmd.Remotes)
+	tasks := mugi.Plan(cfg, cmd.Repo, cmd.Remotes, cmd.Operation)
 	if len(tasks) == 0 {
 		return fmt.Errorf("no matching repositories or remotes found")
 	}
 
-	return ui.Run(cmd.Operation, tasks, cmd.Verbose, cmd.Force, cmd.Linear)
+	if cmd.CreateMissing && cmd.Operation == remote.Push {
+		targets := make(map[string][]string)
+
+		for _, task := range mugi.Runnable(tasks) {
+			targets[task.RepoName] = append(targets[task.RepoName], task.RemoteName)
+		}
+
+		printOutcomes(forge.EnsureRepos(context.Background(), cfg, targets, nil), false)
+	}
+
+	return runTasks(cmd, cfg, cmd.Operation, tasks)
 }
 
-func applyDefaults(cmd *cli.Command, cfg config.Config) {
-	if cfg.Defaults.Verbose {
-		cmd.Verbose = true
+func runTasks(cmd cli.Command, cfg config.Config, op remote.Operation, tasks []mugi.Task) error {
+	if op == remote.Pull {
+		if err := initRepos(cmd, tasks); err != nil {
+			return err
+		}
 	}
 
-	if cfg.Defaults.Linear {
-		cmd.Linear = true
+	var finished []mugi.Finished
+
+	if cmd.Plain {
+		finished = ui.RunPlain(os.Stdout, gitRunner, tasks, cmd.Verbose, cmd.Force, cmd.Linear)
+	} else {
+		var err error
+
+		if finished, err = ui.Run(gitRunner, op, tasks, cmd.Verbose, cmd.Force, cmd.Linear); err != nil {
+			return err
+		}
 	}
 
-	if len(cmd.Remotes) == 1 && cmd.Remotes[0] == "all" {
-		opRemotes := cfg.Defaults.RemotesFor(cmd.Operation.String())
+	report := notify.NewReport(op.String()+" "+cmd.Repo, op.String(), describeTarget(cmd.Repo), finished)
 
-		if len(opRemotes) > 0 {
-			cmd.Remotes = opRemotes
+	sendNotifications(cfg, report)
+
+	if cmd.Plain && report.Failing() {
+		return fmt.Errorf("%d task(s) failed", report.Failed+report.Blocked)
+	}
+
+	return nil
+}
+
+func initRepos(cmd cli.Command, tasks []mugi.Task) error {
+	inits := ui.NeedsInit(context.Background(), gitRunner, mugi.Runnable(tasks))
+	if len(inits) == 0 {
+		return nil
+	}
+
+	if cmd.Plain {
+		return ui.InitPlain(os.Stdout, gitRunner, inits, cmd.Verbose)
+	}
+
+	return ui.RunInit(gitRunner, inits, cmd.Verbose)
+}
+
+func describeTarget(repo string) string {
+	if repo == remote.All {
+		return "all repositories"
+	}
+
+	return repo
+}
+
+func sendNotifications(cfg config.Config, report notify.Report) {
+	for _, err := range notify.Dispatch(context.Background(), cfg.Defaults.Notify, report) {
+		fmt.Fprintln(os.Stderr, "! "+redact.Error(err))
+	}
+}
+
+func runRemote(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	switch cmd.Action {
+	case "add":
+		if err := manage.AddRemote(configPath, cmd.Args[0], cmd.Args[1], cmd.Aliases); err != nil {
+			return err
+		}
+
+		printf("Added remote: %s\n", cmd.Args[0])
+
+	case "rm":
+		name := cfg.ResolveAlias(cmd.Args[0])
+
+		if err := manage.RemoveRemote(configPath, name); err != nil {
+			return err
+		}
+
+		printf("Removed remote: %s\n", name)
+
+	case "rename":
+		oldName, newName := cfg.ResolveAlias(cmd.Args[0]), cmd.Args[1]
+
+		if err := manage.RenameRemote(configPath, oldName, newName); err != nil {
+			return err
+		}
+
+		printf("Renamed remote: %s → %s\n", oldName, newName)
+
+		if cmd.RenameGit {
+			for _, result := range manage.RenameWorkingCopyRemotes(context.Background(), gitRunner, cfg, oldName, newName) {
+				if result.Error != nil {
+					printf("  %s: %s\n", result.Repo, result.Output)
+				} else {
+					printf("  %s: renamed git remote\n", result.Repo)
+				}
+			}
+		}
+
+	case "ls":
+		names := make([]string, 0, len(cfg.Remotes))
+
+		for name := range cfg.Remotes {
+			names = append(names, name)
+		}
+
+		slices.Sort(names)
+
+		for _, name := range names {
+			printf("%s\n", formatRemote(name, cfg.Remotes[name]))
+		}
+
+	case "show":
+		name := cfg.ResolveAlias(cmd.Args[0])
+
+		def, ok := cfg.Remotes[name]
+		if !ok {
+			return fmt.Errorf("remote not found: %s", cmd.Args[0])
+		}
+
+		printf("%s\n", formatRemote(name, def))
+
+		repos := manage.ReposUsingRemote(cfg, name)
+
+		if len(repos) > 0 {
+			printf("\n")
+		}
+
+		for _, repo := range repos {
+			printf("  %s → %s\n", repo.Name, repo.Remotes[name])
+		}
+	}
+
+	return nil
+}
+
+func formatRemote(name string, def config.RemoteDefinition) string {
+	line := fmt.Sprintf("%s  %s", name, def.URL)
+
+	if len(def.Aliases) > 0 {
+		line += fmt.Sprintf(" (%s)", strings.Join(def.Aliases, ", "))
+	}
+
+	return line
+}
+
+func runRepo(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	switch cmd.Action {
+	case "remotes":
+		fullName, remotes, err := manage.SetRepoRemotes(configPath, cfg, cmd.Repo, cmd.Args)
+		if err != nil {
+			return err
+		}
+
+		printf("Updated %s remotes: %s\n", fullName, strings.Join(remotes, ", "))
+
+	case "set":
+		fullName, err := manage.SetRepoFields(configPath, cfg, cmd.Repo, cmd.Args)
+		if err != nil {
+			return err
+		}
+
+		printf("Updated repository: %s\n", fullName)
+
+	case "show":
+		fullName, repo, ok := cfg.FindRepo(cmd.Repo)
+		if !ok {
+			return fmt.Errorf("repository not found: %s", cmd.Repo)
+		}
+
+		printRepo(fullName, repo)
+	}
+
+	return nil
+}
+
+func printRepo(name string, repo config.Repo) {
+	printf("%s\n", name)
+
+	if repo.Path == "" {
+		printf("  path     (none)\n")
+	} else {
+		printf("  path     %s (%s)\n", repo.ExpandPath(), repo.Sources["path"])
+	}
+
+	remotes := make([]string, 0, len(repo.Remotes))
+
+	for remoteName := range repo.Remotes {
+		remotes = append(remotes, remoteName)
+	}
+
+	slices.Sort(remotes)
+
+	if repo.Mode != config.ModeNormal {
+		printf("  mode     %s\n", repo.Mode)
+	}
+
+	if repo.Upstream != nil {
+		printf("  upstream %s\n", repo.Upstream.URL)
+
+		if len(repo.Upstream.Branches) > 0 {
+			printf("    branches %s\n", strings.Join(repo.Upstream.Branches, ", "))
+		}
+	}
+
+	printf("  remotes  %s (%s)\n", strings.Join(remotes, ", "), repo.Sources["remotes"])
+
+	for _, remoteName := range remotes {
+		line := fmt.Sprintf("    %-10s %s (%s)", remoteName, repo.Remotes[remoteName], repo.Sources[remoteName])
+
+		if direction := repo.Direction(remoteName); direction != config.DirectionBoth {
+			line += " [" + direction + "]"
+		}
+
+		printf("%s\n", line)
+	}
+
+	if len(repo.Tags) > 0 {
+		printf("  tags     %s\n", strings.Join(repo.Tags, ", "))
+	}
+}
+
+func runMirror(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	fullName, repo, ok := cfg.FindRepo(cmd.Repo)
+	if !ok {
+		return fmt.Errorf("repository not found: %s", cmd.Repo)
+	}
+
+	remotes := forge.APIRemotes(cfg, repo)
+
+	if !(len(cmd.Remotes) == 1 && cmd.Remotes[0] == remote.All) {
+		remotes = remotes[:0]
+
+		for _, name := range cmd.Remotes {
+			remotes = append(remotes, cfg.ResolveAlias(name))
+		}
+	}
+
+	if len(remotes) == 0 {
+		return fmt.Errorf("no remotes with an api definition found for %s", fullName)
+	}
+
+	outcomes := forge.EnsureRepos(context.Background(), cfg, map[string][]string{fullName: remotes}, nil)
+
+	if printOutcomes(outcomes, true) > 0 {
+		return fmt.Errorf("failed to create some repositories")
+	}
+
+	return nil
+}
+
+func runMeta(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	repoNames := cfg.AllRepos()
+	slices.Sort(repoNames)
+
+	if cmd.Repo != remote.All {
+		fullName, _, ok := cfg.FindRepo(cmd.Repo)
+		if !ok {
+			return fmt.Errorf("repository not found: %s", cmd.Repo)
+		}
+
+		repoNames = []string{fullName}
+	}
+
+	ctx := context.Background()
+
+	if cmd.Action == "pull" {
+		return runMetaPull(ctx, cmd, configPath, cfg, repoNames)
+	}
+
+	plans := forge.PlanMetadata(ctx, cfg, repoNames, nil)
+
+	var pending, failed int
+
+	for _, plan := range plans {
+		switch {
+		case plan.Error != nil:
+			failed++
+
+			printf("✗ %s on %s: %s\n", plan.Repo, plan.Remote, plan.Error)
+		case len(plan.Changes) > 0:
+			pending++
+
+			printf("%s on %s:\n", plan.Repo, plan.Remote)
+
+			for _, change := range plan.Changes {
+				printf("  %s: %q → %q\n", change.Field, change.From, change.To)
+			}
+		}
+	}
+
+	if pending == 0 {
+		if failed > 0 {
+			return fmt.Errorf("failed to read metadata for %d remote(s)", failed)
+		}
+
+		printf("Metadata is up to date\n")
+
+		return nil
+	}
+
+	if !cmd.Yes && !confirm("Apply these changes?") {
+		return nil
+	}
+
+	for _, plan := range plans {
+		if plan.Error != nil || len(plan.Changes) == 0 {
+			continue
+		}
+
+		if err := plan.Apply(ctx); err != nil {
+			failed++
+
+			printf("✗ %s on %s: %s\n", plan.Repo, plan.Remote, err)
+
+			continue
+		}
+
+		printf("✓ Updated %s on %s\n", plan.Repo, plan.Remote)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to update metadata for %d remote(s)", failed)
+	}
+
+	return nil
+}
+
+func runMetaPull(ctx context.Context, cmd cli.Command, configPath string, cfg config.Config, repoNames []string) error {
+	from := cfg.ResolveAlias(cmd.From)
+
+	var pulled, failed int
+
+	for _, repoName := range repoNames {
+		if _, ok := cfg.Repos[repoName].Remotes[from]; !ok {
+			if cmd.Repo != remote.All {
+				return fmt.Errorf("%s does not use remote: %s", repoName, from)
+			}
+
+			continue
+		}
+
+		metadata, fields, err := forge.FetchMetadata(ctx, cfg, repoName, from, nil)
+		if err == nil {
+			_, err = manage.SetRepoMetadata(configPath, cfg, repoName, metadata, fields)
+		}
+
+		if err != nil {
+			failed++
+
+			printf("✗ %s: %s\n", repoName, err)
+
+			continue
+		}
+
+		pulled++
+
+		printf("✓ Imported metadata for %s from %s\n", repoName, from)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to import metadata for %d repositories", failed)
+	}
+
+	if pulled == 0 {
+		printf("No repositories use remote: %s\n", from)
+	}
+
+	return nil
+}
+
+func confirm(prompt string) bool {
+	printf("%s [y/N] ", prompt)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+func printOutcomes(outcomes []forge.Outcome, showExisting bool) int {
+	var failed int
+
+	for _, outcome := range outcomes {
+		switch {
+		case outcome.Error != nil:
+			failed++
+
+			printf("✗ %s on %s: %s\n", outcome.Repo, outcome.Remote, outcome.Error)
+		case outcome.Created:
+			printf("✓ Created %s on %s\n", outcome.Repo, outcome.Remote)
+		case showExisting:
+			printf("○ %s already exists on %s\n", outcome.Repo, outcome.Remote)
+		}
+	}
+
+	return failed
+}
+
+func runRelocate(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	warnCollisions(cfg)
+
+	moves, err := manage.Relocate(context.Background(), gitRunner, cfg, cmd.Repo, cmd.From, cmd.DryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(moves) == 0 {
+		printf("Nothing to relocate\n")
+
+		return nil
+	}
+
+	var failed int
+
+	for _, move := range moves {
+		switch {
+		case move.Error != nil:
+			failed++
+
+			printf("✗ %s: %s\n", move.Repo, move.Error)
+		case cmd.DryRun:
+			printf("○ %s: %s → %s\n", move.Repo, move.From, move.To)
+		default:
+			printf("✓ %s: %s → %s\n", move.Repo, move.From, move.To)
 		}
 	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d relocation(s) failed", failed)
+	}
+
+	return nil
+}
+
+func runCheck(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	tasks := mugi.Plan(cfg, cmd.Repo, cmd.Remotes, cmd.Operation)
+	if len(tasks) == 0 {
+		return fmt.Errorf("no matching repositories or remotes found")
+	}
+
+	slices.SortFunc(tasks, func(a, b mugi.Task) int {
+		return strings.Compare(a.RepoName+":"+a.RemoteName, b.RepoName+":"+b.RemoteName)
+	})
+
+	shared := make(map[string]bool)
+
+	for _, collision := range cfg.Collisions() {
+		for _, name := range collision.Repos {
+			shared[name] = true
+		}
+	}
+
+	targets := make([]manage.CheckTarget, len(tasks))
+
+	for i, task := range tasks {
+		targets[i] = manage.CheckTarget{Repo: task.RepoName, Remote: task.RemoteName, URL: task.RemoteURL, Path: task.RepoPath, Skip: task.Skip}
+
+		if !shared[task.RepoName] && cfg.Repos[task.RepoName].Direction(task.RemoteName) == config.DirectionPush {
+			targets[i].Skip = ""
+		}
+	}
+
+	repos := manage.Check(context.Background(), gitRunner, targets)
+
+	var unhealthy int
+
+	for _, repo := range repos {
+		if len(repo.Issues) > 0 {
+			unhealthy++
+		}
+	}
+
+	if cmd.JSON {
+		data, err := json.MarshalIndent(repos, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		printf("%s\n", data)
+	} else {
+		for _, repo := range repos {
+			printHealth(repo)
+		}
+	}
+
+	if unhealthy > 0 {
+		return fmt.Errorf("%d of %d repositories have problems", unhealthy, len(repos))
+	}
+
+	return nil
+}
+
+func printHealth(repo manage.RepoHealth) {
+	printf("%s\n", repo.Repo)
+
+	for _, remote := range repo.Remotes {
+		switch remote.Status {
+		case manage.StatusOK:
+			printf("  ✓ %-10s %d refs\n", remote.Name, remote.Refs)
+		case manage.StatusAuth:
+			printf("  ✗ %-10s authentication failed: %s\n", remote.Name, firstLine(remote.Error))
+		case manage.StatusSkipped:
+			printf("  ○ %-10s skipped: %s\n", remote.Name, remote.Skip)
+		default:
+			printf("  ✗ %-10s unreachable: %s\n", remote.Name, firstLine(remote.Error))
+		}
+	}
+
+	for _, issue := range repo.Issues {
+		switch issue.Kind {
+		case manage.IssueMissing:
+			printf("  ! %s is missing %s\n", issue.Remote, issue.Ref)
+		case manage.IssueMismatch:
+			printf("  ! %s differs: %s\n", issue.Ref, formatSHAs(issue.SHAs))
+		case manage.IssueLocalMismatch:
+			printf("  ! %s on %s differs from local: %s\n", issue.Ref, issue.Remote, formatSHAs(issue.SHAs))
+		}
+	}
+}
+
+func formatSHAs(shas map[string]string) string {
+	parts := make([]string, 0, len(shas))
+
+	for _, name := range slices.Sorted(maps.Keys(shas)) {
+		parts = append(parts, fmt.Sprintf("%s %.7s", name, shas[name]))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+
+	return line
+}
+
+func runWatch(cmd cli.Command, configPath string) error {
+	if cmd.Action == "" {
+		daemon, err := watch.New(gitRunner, configPath, cmd.Socket, os.Stdout)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return daemon.Run(ctx)
+	}
+
+	socket := cmd.Socket
+
+	if socket == "" {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+
+		socket = cfg.Defaults.Watch.SocketPath()
+	}
+
+	status, err := watch.Query(socket, cmd.Action)
+	if err != nil {
+		return err
+	}
+
+	switch cmd.Action {
+	case "reload":
+		printf("Requested config reload\n")
+	case "fetch":
+		printf("Requested fetch\n")
+	default:
+		if cmd.JSON {
+			data, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			printf("%s\n", data)
+
+			return nil
+		}
+
+		printWatchStatus(status)
+	}
+
+	return nil
+}
+
+func printWatchStatus(status watch.Status) {
+	printf("Watching since %s (pid %d), next fetch %s\n", formatTime(status.Started), status.PID, formatTime(status.NextFetch))
+
+	if status.ReloadError != "" {
+		printf("! Last reload failed: %s\n", firstLine(status.ReloadError))
+	}
+
+	for _, repo := range status.Repos {
+		printf("\n%s", repo.Repo)
+
+		if repo.Running != "" {
+			printf(" (%s running)", repo.Running)
+		}
+
+		printf("\n")
+
+		if !repo.Watching {
+			printf("  ○ not watched: no working copy at %s\n", repo.Path)
+
+			continue
+		}
+
+		printf("  changed %s, fetched %s, pushed %s\n", formatTime(repo.LastChange), formatTime(repo.LastFetch), formatTime(repo.LastPush))
+
+		for _, name := range slices.Sorted(maps.Keys(repo.Remotes)) {
+			result := repo.Remotes[name]
+
+			if result.OK {
+				printf("  ✓ %-10s %s %s\n", name, result.Op, formatTime(result.At))
+			} else {
+				printf("  ✗ %-10s %s %s: %s\n", name, result.Op, formatTime(result.At), result.Error)
+			}
+		}
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return t.Local().Format(time.DateTime)
+}
+
+func runSchedule(cmd cli.Command, configPath string) error {
+	dir := cmd.Path
+	systemd := dir == ""
+
+	if systemd {
+		var err error
+
+		if dir, err = schedule.Dir(); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+
+	if cmd.Action == "remove" {
+		removed, err := schedule.Remove(ctx, dir, systemd)
+
+		for _, name := range removed {
+			printf("✓ Removed %s\n", name)
+		}
+
+		if err == nil && len(removed) == 0 {
+			printf("No scheduled units installed in %s\n", dir)
+		}
+
+		return err
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	if configPath != "" {
+		if configPath, err = filepath.Abs(configPath); err != nil {
+			return err
+		}
+	}
+
+	units := schedule.Units(cfg, executable, configPath)
+
+	if cmd.Action == "status" {
+		statuses, err := schedule.Status(ctx, dir, units, systemd)
+		if err != nil {
+			return err
+		}
+
+		if len(statuses) == 0 {
+			printf("No schedule blocks in config\n")
+		}
+
+		for _, status := range statuses {
+			printUnitStatus(status)
+		}
+
+		return nil
+	}
+
+	written, removed, err := schedule.Install(ctx, dir, units, systemd)
+
+	for _, name := range removed {
+		printf("✓ Removed %s\n", name)
+	}
+
+	for _, name := range written {
+		printf("✓ Installed %s\n", name)
+	}
+
+	if err == nil && len(units) == 0 {
+		printf("No schedule blocks in config\n")
+	}
+
+	return err
+}
+
+func printUnitStatus(status schedule.UnitStatus) {
+	target := status.Repo
+
+	if target == "" {
+		target = "all repositories"
+	}
+
+	switch status.State {
+	case schedule.StateStale:
+		printf("! %s: installed but no longer in config, run mugi schedule install\n", status.Name)
+
+		return
+	case schedule.StateMissing:
+		printf("○ %s: %s %s on %s, not installed\n", status.Name, status.Operation, target, status.Calendar)
+
+		return
+	case schedule.StateOutdated:
+		printf("! %s: %s %s on %s, outdated, run mugi schedule install\n", status.Name, status.Operation, target, status.Calendar)
+	default:
+		marker := "✓"
+
+		if status.Result != "" && status.Result != "success" {
+			marker = "✗"
+		}
+
+		printf("%s %s: %s %s on %s\n", marker, status.Name, status.Operation, target, status.Calendar)
+	}
+
+	if status.Active != "" {
+		printf("    %s, next %s, last %s, result %s\n", status.Active, orNever(status.Next), orNever(status.Last), orNever(status.Result))
+	}
+}
+
+func orNever(value string) string {
+	if value == "" || value == "n/a" {
+		return "never"
+	}
+
+	return value
+}
+
+func runHooks(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	names := cfg.AllRepos()
+
+	if cmd.Repo != remote.All {
+		fullName, _, found := cfg.FindRepo(cmd.Repo)
+		if !found {
+			return fmt.Errorf("repository not found: %s", cmd.Repo)
+		}
+
+		names = []string{fullName}
+	}
+
+	slices.Sort(names)
+
+	switch cmd.Action {
+	case "run":
+		return runQueuedPush(cfg, names[0])
+	case "uninstall":
+		for _, name := range names {
+			changes, err := manage.UninstallGitHooks(context.Background(), gitRunner, name, cfg.Repos[name].ExpandPath())
+			if err != nil {
+				return err
+			}
+
+			for _, change := range changes {
+				if change.Chained {
+					printf("✓ %s: removed %s hook, restored the previous hook\n", name, change.Hook)
+				} else {
+					printf("✓ %s: removed %s hook\n", name, change.Hook)
+				}
+			}
+		}
+
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	if configPath != "" {
+		if configPath, err = filepath.Abs(configPath); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		change, err := manage.InstallGitHook(context.Background(), gitRunner, name, cfg.Repos[name].ExpandPath(), cmd.Hook, executable, configPath)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case change.Status == manage.GitHookSkipped:
+			printf("○ %s: skipped, %s\n", name, change.Reason)
+		case change.Chained:
+			printf("✓ %s: %s %s hook, chaining the existing hook\n", name, change.Status, change.Hook)
+		default:
+			printf("✓ %s: %s %s hook\n", name, change.Status, change.Hook)
+		}
+	}
+
+	return nil
+}
+
+func runQueuedPush(cfg config.Config, name string) error {
+	gitDir := git.New(gitRunner).CommonDir(context.Background(), cfg.Repos[name].ExpandPath())
+	if gitDir == "" {
+		return fmt.Errorf("%s: not a git repository", name)
+	}
+
+	return manage.RunQueued(gitDir, func(log io.Writer) {
+		tasks := mugi.Plan(cfg, name, nil, remote.Push)
+		finished := ui.RunPlain(log, gitRunner, tasks, false, false, false)
+
+		sendNotifications(cfg, notify.NewReport("hooks push "+name, remote.Push.String(), name, finished))
+	})
+}
+
+func runExec(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	applyDefaults(&cmd, cfg)
+	warnCollisions(cfg)
+
+	argv := cmd.Args
+
+	if cmd.Type == cli.CommandGit {
+		argv = append([]string{"git"}, argv...)
+	}
+
+	tasks := mugi.PlanCommand(cfg, cmd.Repo, argv)
+	if len(tasks) == 0 {
+		return fmt.Errorf("no matching repositories found")
+	}
+
+	jobs := cmd.Jobs
+
+	switch {
+	case cmd.Linear:
+		jobs = 1
+	case jobs == 0:
+		jobs = runtime.NumCPU()
+	}
+
+	var failed int
+
+	if cmd.Plain {
+		failed = ui.RunCommandsPlain(os.Stdout, gitRunner, tasks, jobs)
+	} else if failed, err = ui.RunCommands(gitRunner, argv, tasks, cmd.Verbose, jobs); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("command failed in %d repositories", failed)
+	}
+
+	return nil
+}
+
+func runUpdateForks(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	applyDefaults(&cmd, cfg)
+	warnCollisions(cfg)
+
+	names, err := manage.Forks(cfg, cmd.Repo)
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		printf("No repositories have an upstream\n")
+
+		return nil
+	}
+
+	ctx := context.Background()
+
+	var tasks []mugi.Task
+	var failed int
+
+	for _, name := range names {
+		update := manage.UpdateFork(ctx, gitRunner, name, cfg.Repos[name])
+
+		if update.Error != nil {
+			failed++
+
+			printf("✗ %s: %s\n", name, update.Error)
+
+			continue
+		}
+
+		if update.Skip != "" {
+			printf("○ %s: skipped: %s\n", name, update.Skip)
+
+			continue
+		}
+
+		for _, branch := range update.Branches {
+			printBranchUpdate(name, branch)
+		}
+
+		var pushes, skipped []mugi.Task
+
+		for _, task := range mugi.Plan(cfg, name, cmd.Remotes, remote.Push) {
+			if task.Skip != "" {
+				skipped = append(skipped, task)
+
+				continue
+			}
+
+			push, diverged := update.Pushable(ctx, gitRunner, task.RemoteName)
+
+			for _, branch := range diverged {
+				printf("! %s %s: diverged on %s, not pushed\n", name, branch, task.RemoteName)
+			}
+
+			if len(push) > 0 {
+				task.Refspecs = push
+				pushes = append(pushes, task)
+			}
+		}
+
+		if len(pushes) > 0 {
+			tasks = append(append(tasks, pushes...), skipped...)
+		}
+	}
+
+	if len(tasks) > 0 {
+		printf("\n")
+
+		if err := runTasks(cmd, cfg, remote.Push, tasks); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to update %d fork(s)", failed)
+	}
+
+	return nil
+}
+
+func printBranchUpdate(repo string, branch manage.BranchUpdate) {
+	switch branch.Status {
+	case manage.BranchUpToDate:
+		printf("○ %s %s: up to date\n", repo, branch.Branch)
+	case manage.BranchForwarded:
+		printf("✓ %s %s: fast-forwarded %.7s..%.7s\n", repo, branch.Branch, branch.From, branch.To)
+	case manage.BranchCreated:
+		printf("✓ %s %s: created at %.7s\n", repo, branch.Branch, branch.To)
+	case manage.BranchAhead:
+		printf("○ %s %s: ahead of upstream\n", repo, branch.Branch)
+	case manage.BranchDiverged:
+		printf("! %s %s: diverged from upstream, needs a merge\n", repo, branch.Branch)
+	case manage.BranchMissing:
+		printf("✗ %s %s: not found upstream\n", repo, branch.Branch)
+	case manage.BranchFailed:
+		printf("✗ %s %s: %s\n", repo, branch.Branch, branch.Output)
+	}
+}
+
+func runImport(cmd cli.Command, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	source, err := forge.ParseSource(cmd.Args[0], cfg)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Language != "" && !source.ReportsLanguage() {
+		return fmt.Errorf("--language is not supported for %s sources: the forge reports no language", source.Kind)
+	}
+
+	var listings []forge.Listing
+
+	if cmd.Input != "" {
+		data, err := os.ReadFile(cmd.Input)
+		if err != nil {
+			return err
+		}
+
+		listings, err = source.Decode(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmd.Input, err)
+		}
+	} else {
+		listings, err = source.List(context.Background(), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	filter := forge.ListFilter{Archived: cmd.Archived, Forks: cmd.Forks, Language: cmd.Language}
+
+	var candidates []forge.Listing
+
+	for _, listing := range listings {
+		if !filter.Match(listing) {
+			continue
+		}
+
+		if _, _, known := cfg.FindRepo(listing.FullName()); known {
+			continue
+		}
+
+		candidates = append(candidates, listing)
+	}
+
+	if len(candidates) == 0 {
+		printf("No untracked repositories found\n")
+
+		return nil
+	}
+
+	items := make([]string, len(candidates))
+
+	for i, listing := range candidates {
+		items[i] = listing.FullName()
+
+		if listing.Language != "" {
+			items[i] += " [" + listing.Language + "]"
+		}
+
+		if listing.Description != "" {
+			items[i] += " " + listing.Description
+		}
+	}
+
+	indices, err := ui.Select("Select repositories to import", items)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]manage.Candidate, 0, len(indices))
+
+	for _, i := range indices {
+		listing := candidates[i]
+
+		candidate, err := manage.ImportCandidate(listing.FullName(), source.Remote, listing.CloneURL, cfg)
+		if err != nil {
+			return err
+		}
+
+		selected = append(selected, candidate)
+	}
+
+	if err := manage.AddCandidates(configPath, selected); err != nil {
+		return err
+	}
+
+	for _, candidate := range selected {
+		printf("Added repository: %s\n", candidate.Info.Name)
+	}
+
+	return nil
+}
+
+func runScan(cmd cli.Command, configPath string, cfg config.Config) error {
+	candidates, err := manage.Scan(context.Background(), gitRunner, cmd.Path, cmd.Depth, cfg)
+	if err != nil {
+		return err
+	}
+
+	if len(candidates) == 0 {
+		printf("No untracked repositories found\n")
+
+		return nil
+	}
+
+	items := make([]string, len(candidates))
+
+	for i, candidate := range candidates {
+		items[i] = fmt.Sprintf("%s (%s)", candidate.Info.Name, candidate.Info.Path)
+	}
+
+	indices, err := ui.Select("Select repositories to add", items)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]manage.Candidate, 0, len(indices))
+
+	for _, i := range indices {
+		selected = append(selected, candidates[i])
+	}
+
+	if err := manage.AddCandidates(configPath, selected); err != nil {
+		return err
+	}
+
+	var suggestions []manage.RemoteSuggestion
+
+	for _, candidate := range selected {
+		printf("Added repository: %s (%s)\n", candidate.Info.Name, candidate.Info.Path)
+
+		suggestions = append(suggestions, candidate.Suggestions...)
+	}
+
+	printSuggestions(suggestions)
+
+	return nil
+}
+
+func printSuggestions(suggestions []manage.RemoteSuggestion) {
+	for _, suggestion := range suggestions {
+		printf("\nRemote %s (%s) matches no remote definition. To use templates, add:\n", suggestion.Name, suggestion.URL)
+		printf("  remotes:\n    %s:\n      url: %s\n", suggestion.Name, suggestion.Template)
+	}
+}
+
+func applyDefaults(cmd *cli.Command, cfg config.Config) {
+	if cfg.Defaults.Verbose {
+		cmd.Verbose = true
+	}
+
+	if cfg.Defaults.Linear {
+		cmd.Linear = true
+	}
+
+	if len(cmd.Remotes) == 1 && cmd.Remotes[0] == "all" {
+		opRemotes := cfg.Defaults.RemotesFor(cmd.Operation.String())
+
+		if len(opRemotes) > 0 {
+			cmd.Remotes = opRemotes
+		}
+	}
+}
+
+func warnCollisions(cfg config.Config) {
+	for _, collision := range cfg.Collisions() {
+		printf("! %s share the same path, skipped by pull, push and exec: %s\n", strings.Join(collision.Repos, " and "), collision.Path)
+	}
+}
+
+func printf(format string, args ...any) {
+	fmt.Print(redact.String(fmt.Sprintf(format, args...)))
 }
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/ebisu/mugi/internal/remote"
@@ -16,22 +18,57 @@ const (
 	CommandAdd
 	CommandRemove
 	CommandList
+	CommandRemote
+	CommandRepo
+	CommandRelocate
+	CommandMirror
+	CommandMeta
+	CommandImport
+	CommandUpdateForks
+	CommandExec
+	CommandGit
+	CommandCheck
+	CommandWatch
+	CommandSchedule
+	CommandHooks
 )
 
 type Command struct {
-	Type       CommandType
-	Operation  remote.Operation
-	Repo       string
-	Remotes    []string
-	Path       string
-	ConfigPath string
-	Verbose    bool
-	Force      bool
-	Linear     bool
-	Help       bool
-	Version    bool
+	Type          CommandType
+	Operation     remote.Operation
+	Repo          string
+	Remotes       []string
+	Path          string
+	Scan          bool
+	Depth         int
+	Action        string
+	Args          []string
+	Aliases       []string
+	RenameGit     bool
+	From          string
+	DryRun        bool
+	Yes           bool
+	Archived      bool
+	Forks         bool
+	Language      string
+	Input         string
+	Jobs          int
+	JSON          bool
+	Socket        string
+	Hook          string
+	ConfigPath    string
+	Verbose       bool
+	Force         bool
+	Linear        bool
+	Plain         bool
+	NoRedact      bool
+	CreateMissing bool
+	Help          bool
+	Version       bool
 }
 
+const defaultScanDepth = 3
+
 var ErrUnknownCommand = errors.New("unknown command")
 
 func Parse(args []string) (Command, error) {
@@ -45,10 +82,15 @@ func Parse(args []string) (Command, error) {
 		return cmd, nil
 	}
 
+	args, passthrough := splitPassthrough(args)
+
 	args, cmd.ConfigPath = extractConfigFlag(args)
 	args, cmd.Verbose = extractVerboseFlag(args)
 	args, cmd.Force = extractForceFlag(args)
 	args, cmd.Linear = extractLinearFlag(args)
+	args, cmd.Plain = extractPlainFlag(args)
+	args, cmd.NoRedact = extractNoRedactFlag(args)
+	args, cmd.CreateMissing = extractCreateMissingFlag(args)
 
 	for _, arg := range args {
 		if arg == "-h" || arg == "--help" || arg == "help" {
@@ -70,6 +112,8 @@ func Parse(args []string) (Command, error) {
 		return cmd, nil
 	}
 
+	args = append(args, passthrough...)
+
 	switch args[0] {
 	case "pull":
 		cmd.Type = CommandOperation
@@ -80,16 +124,26 @@ func Parse(args []string) (Command, error) {
 	case "fetch":
 		cmd.Type = CommandOperation
 		cmd.Operation = remote.Fetch
+	case "update-forks":
+		cmd.Type = CommandUpdateForks
+		cmd.Operation = remote.Push
+	case "check":
+		cmd.Type = CommandCheck
+		cmd.Operation = remote.Fetch
+
+		args = slices.DeleteFunc(args, func(arg string) bool {
+			if arg == "--json" {
+				cmd.JSON = true
+			}
+
+			return arg == "--json"
+		})
 	case "add":
 		cmd.Type = CommandAdd
+		cmd.Path = "."
+		cmd.Depth = defaultScanDepth
 
-		if len(args) < 2 {
-			cmd.Path = "."
-		} else {
-			cmd.Path = args[1]
-		}
-
-		return cmd, nil
+		return parseAdd(cmd, args[1:])
 	case "rm", "remove":
 		cmd.Type = CommandRemove
 
@@ -104,6 +158,66 @@ func Parse(args []string) (Command, error) {
 		cmd.Type = CommandList
 
 		return cmd, nil
+	case "remote":
+		cmd.Type = CommandRemote
+
+		return parseRemote(cmd, args[1:])
+	case "repo":
+		cmd.Type = CommandRepo
+
+		return parseRepo(cmd, args[1:])
+	case "mirror":
+		cmd.Type = CommandMirror
+
+		if len(args) < 3 || args[1] != "create" {
+			return cmd, fmt.Errorf("usage: mirror create <repo> [remotes...]")
+		}
+
+		cmd.Action = args[1]
+		cmd.Repo = args[2]
+
+		if len(args) > 3 {
+			cmd.Remotes = args[3:]
+		}
+
+		return cmd, nil
+	case "meta":
+		cmd.Type = CommandMeta
+		cmd.Repo = remote.All
+
+		return parseMeta(cmd, args[1:])
+	case "import":
+		cmd.Type = CommandImport
+
+		return parseImport(cmd, args[1:])
+	case "exec":
+		cmd.Type = CommandExec
+		cmd.Repo = remote.All
+
+		return parseExec(cmd, args[1:])
+	case "git":
+		cmd.Type = CommandGit
+		cmd.Repo = remote.All
+
+		return parseExec(cmd, args[1:])
+	case "watch":
+		cmd.Type = CommandWatch
+
+		return parseWatch(cmd, args[1:])
+	case "schedule":
+		cmd.Type = CommandSchedule
+
+		return parseSchedule(cmd, args[1:])
+	case "hooks":
+		cmd.Type = CommandHooks
+		cmd.Repo = remote.All
+
+		return parseHooks(cmd, args[1:])
+	case "relocate":
+		cmd.Type = CommandRelocate
+		cmd.Repo = remote.All
+
+		return parseRelocate(cmd, args[1:])
 	default:
 		return cmd, fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
 	}
@@ -126,6 +240,416 @@ func Parse(args []string) (Command, error) {
 	return cmd, nil
 }
 
+func parseAdd(cmd Command, args []string) (Command, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--scan":
+			cmd.Scan = true
+		case arg == "--depth":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("--depth requires a value")
+			}
+
+			i++
+
+			if err := parseDepth(&cmd, args[i]); err != nil {
+				return cmd, err
+			}
+		case strings.HasPrefix(arg, "--depth="):
+			if err := parseDepth(&cmd, strings.TrimPrefix(arg, "--depth=")); err != nil {
+				return cmd, err
+			}
+		default:
+			cmd.Path = arg
+		}
+	}
+
+	return cmd, nil
+}
+
+func parseDepth(cmd *Command, value string) error {
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 1 {
+		return fmt.Errorf("invalid depth: %s", value)
+	}
+
+	cmd.Depth = depth
+
+	return nil
+}
+
+var remoteActionArgs = map[string]int{
+	"add":    2,
+	"rm":     1,
+	"rename": 2,
+	"ls":     0,
+	"show":   1,
+}
+
+func parseRemote(cmd Command, args []string) (Command, error) {
+	cmd.Action = "ls"
+
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--alias":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("--alias requires a value")
+			}
+
+			i++
+			cmd.Aliases = append(cmd.Aliases, args[i])
+		case strings.HasPrefix(arg, "--alias="):
+			cmd.Aliases = append(cmd.Aliases, strings.TrimPrefix(arg, "--alias="))
+		case arg == "--git":
+			cmd.RenameGit = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) > 0 {
+		cmd.Action = positional[0]
+		cmd.Args = positional[1:]
+	}
+
+	switch cmd.Action {
+	case "remove":
+		cmd.Action = "rm"
+	case "list":
+		cmd.Action = "ls"
+	}
+
+	expected, ok := remoteActionArgs[cmd.Action]
+	if !ok {
+		return cmd, fmt.Errorf("%w: remote %s", ErrUnknownCommand, cmd.Action)
+	}
+
+	if len(cmd.Args) != expected {
+		return cmd, fmt.Errorf("remote %s requires %d argument(s)", cmd.Action, expected)
+	}
+
+	return cmd, nil
+}
+
+func parseRepo(cmd Command, args []string) (Command, error) {
+	if len(args) < 2 {
+		return cmd, fmt.Errorf("repo requires an action and a repository name")
+	}
+
+	cmd.Action = args[0]
+	cmd.Repo = args[1]
+	cmd.Args = args[2:]
+
+	switch cmd.Action {
+	case "show":
+		if len(cmd.Args) > 0 {
+			return cmd, fmt.Errorf("repo show takes no further arguments")
+		}
+	case "remotes", "set":
+		if len(cmd.Args) == 0 {
+			return cmd, fmt.Errorf("repo %s requires at least one change", cmd.Action)
+		}
+	default:
+		return cmd, fmt.Errorf("%w: repo %s", ErrUnknownCommand, cmd.Action)
+	}
+
+	return cmd, nil
+}
+
+func parseRelocate(cmd Command, args []string) (Command, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--from":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("--from requires a value")
+			}
+
+			i++
+			cmd.From = args[i]
+		case strings.HasPrefix(arg, "--from="):
+			cmd.From = strings.TrimPrefix(arg, "--from=")
+		case arg == "-n" || arg == "--dry-run":
+			cmd.DryRun = true
+		default:
+			cmd.Repo = arg
+		}
+	}
+
+	return cmd, nil
+}
+
+func parseMeta(cmd Command, args []string) (Command, error) {
+	if len(args) == 0 || (args[0] != "push" && args[0] != "pull") {
+		return cmd, fmt.Errorf("usage: meta push [repo] [-y] | meta pull --from <remote> [repo]")
+	}
+
+	cmd.Action = args[0]
+	args = args[1:]
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--from":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("--from requires a value")
+			}
+
+			i++
+			cmd.From = args[i]
+		case strings.HasPrefix(arg, "--from="):
+			cmd.From = strings.TrimPrefix(arg, "--from=")
+		case arg == "-y" || arg == "--yes":
+			cmd.Yes = true
+		default:
+			cmd.Repo = arg
+		}
+	}
+
+	if cmd.Action == "pull" && cmd.From == "" {
+		return cmd, fmt.Errorf("meta pull requires --from <remote>")
+	}
+
+	return cmd, nil
+}
+
+func parseImport(cmd Command, args []string) (Command, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--archived":
+			cmd.Archived = true
+		case arg == "--forks":
+			cmd.Forks = true
+		case arg == "--language" || arg == "--json":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("%s requires a value", arg)
+			}
+
+			i++
+
+			if arg == "--language" {
+				cmd.Language = args[i]
+			} else {
+				cmd.Input = args[i]
+			}
+		case strings.HasPrefix(arg, "--language="):
+			cmd.Language = strings.TrimPrefix(arg, "--language=")
+		case strings.HasPrefix(arg, "--json="):
+			cmd.Input = strings.TrimPrefix(arg, "--json=")
+		default:
+			cmd.Args = append(cmd.Args, arg)
+		}
+	}
+
+	if len(cmd.Args) != 1 {
+		return cmd, fmt.Errorf("usage: import <forge>:<owner|url> [--archived] [--forks] [--language x] [--json file]")
+	}
+
+	return cmd, nil
+}
+
+func parseWatch(cmd Command, args []string) (Command, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--socket":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("--socket requires a value")
+			}
+
+			i++
+			cmd.Socket = args[i]
+		case strings.HasPrefix(arg, "--socket="):
+			cmd.Socket = strings.TrimPrefix(arg, "--socket=")
+		case arg == "--json":
+			cmd.JSON = true
+		case (arg == "status" || arg == "reload" || arg == "fetch") && cmd.Action == "":
+			cmd.Action = arg
+		default:
+			return cmd, fmt.Errorf("usage: watch [status|reload|fetch] [--socket path] [--json]")
+		}
+	}
+
+	return cmd, nil
+}
+
+func parseSchedule(cmd Command, args []string) (Command, error) {
+	if len(args) == 0 || (args[0] != "install" && args[0] != "status" && args[0] != "remove") {
+		return cmd, fmt.Errorf("usage: schedule install|status|remove [--dir path]")
+	}
+
+	cmd.Action = args[0]
+	args = args[1:]
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--dir":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("--dir requires a value")
+			}
+
+			i++
+			cmd.Path = args[i]
+		case strings.HasPrefix(arg, "--dir="):
+			cmd.Path = strings.TrimPrefix(arg, "--dir=")
+		default:
+			return cmd, fmt.Errorf("usage: schedule install|status|remove [--dir path]")
+		}
+	}
+
+	return cmd, nil
+}
+
+func parseHooks(cmd Command, args []string) (Command, error) {
+	usage := fmt.Errorf("usage: hooks install [repo] [--hook post-commit|reference-transaction] | hooks uninstall [repo]")
+
+	if len(args) == 0 || (args[0] != "install" && args[0] != "uninstall" && args[0] != "run") {
+		return cmd, usage
+	}
+
+	cmd.Action = args[0]
+	args = args[1:]
+
+	if cmd.Action == "install" {
+		cmd.Hook = "post-commit"
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--hook" && cmd.Action == "install":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("--hook requires a value")
+			}
+
+			i++
+			cmd.Hook = args[i]
+		case strings.HasPrefix(arg, "--hook=") && cmd.Action == "install":
+			cmd.Hook = strings.TrimPrefix(arg, "--hook=")
+		case strings.HasPrefix(arg, "-"):
+			return cmd, usage
+		default:
+			cmd.Repo = arg
+		}
+	}
+
+	if cmd.Hook != "" && cmd.Hook != "post-commit" && cmd.Hook != "reference-transaction" {
+		return cmd, fmt.Errorf("invalid hook: %s (expected post-commit or reference-transaction)", cmd.Hook)
+	}
+
+	if cmd.Action == "run" && cmd.Repo == remote.All {
+		return cmd, fmt.Errorf("hooks run requires a repository name")
+	}
+
+	return cmd, nil
+}
+
+func splitPassthrough(args []string) ([]string, []string) {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			return args[:i], args[i:]
+		case arg == "-c" || arg == "--config":
+			i++
+		case strings.HasPrefix(arg, "-"):
+		case arg == "git":
+			return args[:i+1], args[i+1:]
+		default:
+			return splitAtSeparator(args)
+		}
+	}
+
+	return args, nil
+}
+
+func splitAtSeparator(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i:]
+		}
+	}
+
+	return args, nil
+}
+
+func parseExec(cmd Command, args []string) (Command, error) {
+	var selectors []string
+
+	gitArgs := cmd.Type == CommandGit && !slices.Contains(args, "--")
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--":
+			cmd.Args = append(cmd.Args, args[i+1:]...)
+			i = len(args)
+		case arg == "-j" || arg == "--jobs":
+			if i+1 >= len(args) {
+				return cmd, fmt.Errorf("%s requires a value", arg)
+			}
+
+			i++
+
+			if err := parseJobs(&cmd, args[i]); err != nil {
+				return cmd, err
+			}
+		case strings.HasPrefix(arg, "--jobs="):
+			if err := parseJobs(&cmd, strings.TrimPrefix(arg, "--jobs=")); err != nil {
+				return cmd, err
+			}
+		case gitArgs:
+			cmd.Args = append(cmd.Args, args[i:]...)
+			i = len(args)
+		default:
+			selectors = append(selectors, arg)
+		}
+	}
+
+	if len(selectors) > 1 {
+		return cmd, fmt.Errorf("exec accepts at most one repository before --")
+	}
+
+	if len(selectors) == 1 {
+		cmd.Repo = selectors[0]
+	}
+
+	if len(cmd.Args) == 0 {
+		if cmd.Type == CommandGit {
+			return cmd, fmt.Errorf("usage: git [repo --] <git-args...>")
+		}
+
+		return cmd, fmt.Errorf("usage: exec [repo] -- <command...>")
+	}
+
+	return cmd, nil
+}
+
+func parseJobs(cmd *Command, value string) error {
+	jobs, err := strconv.Atoi(value)
+	if err != nil || jobs < 1 {
+		return fmt.Errorf("invalid jobs value: %s", value)
+	}
+
+	cmd.Jobs = jobs
+
+	return nil
+}
+
 func Usage() string {
 	return `Mugi - Personal Multi-Git Remote Manager
 
@@ -136,9 +660,55 @@ Commands:
   pull          Pull from remote(s)
   push          Push to remote(s)
   fetch         Fetch from remote(s)
+  update-forks [repo] [remotes...]
+                Fast-forward forks from their upstream, then push to remote(s)
   add <path>    Add repository to config
+  add --scan <dir> [--depth n]
+                Add untracked repositories found under a directory
   rm <name>     Remove repository from config
   list          List tracked repositories
+  remote add <name> <url-template> [--alias x]
+                Define a remote
+  remote rm <name>
+                Remove a remote definition and every reference to it
+  remote rename <old> <new> [--git]
+                Rename a remote definition (--git also renames working copy remotes)
+  remote ls     List remote definitions
+  remote show <name>
+                Show a remote and the repositories using it
+  repo show <repo>
+                Show a repository's expanded configuration
+  repo remotes <repo> [+remote] [-remote]...
+                Enable or disable remotes for a repository
+  repo set <repo> key=value...
+                Set path, mode, tags, description, homepage, topics, private,
+                <remote>.user, <remote>.repo, <remote>.url or <remote>.direction
+  import <forge>:<owner|url> [--archived] [--forks] [--language x] [--json file]
+                Choose repositories to add from a forge user or organisation
+  check [repo] [remotes...] [--json]
+                Compare refs advertised by each remote with each other and local refs
+  exec [repo] [-j n] -- <command...>
+                Run a command in every repository's working copy
+  git [repo --] [-j n] <git-args...>
+                Run a git command in every repository's working copy
+  watch [--socket path]
+                Fetch on a schedule and push repositories when their local refs change
+  watch status|reload|fetch [--socket path] [--json]
+                Query, reload or trigger a fetch in a running watch process
+  schedule install|status|remove [--dir path]
+                Manage systemd user timers for the schedule blocks in config
+  hooks install [repo] [--hook post-commit|reference-transaction]
+                Push to mirrors in the background after each commit or ref update
+  hooks uninstall [repo]
+                Remove installed git hooks and restore the hooks they wrapped
+  relocate [repo] [--from <prefix>] [-n]
+                Move working copies from a path prefix to their configured path
+  mirror create <repo> [remotes...]
+                Create the repository on forges with an api definition
+  meta push [repo] [-y]
+                Update description, homepage, topics and visibility on forges
+  meta pull --from <remote> [repo]
+                Import repository metadata from a forge into config
   help          Show this help
   version       Show version
 
@@ -146,15 +716,26 @@ Flags:
   -c, --config <path>  Override config file path
   -V, --verbose        Show detailed output
   -f, --force          Force push (use with caution)
+      --create-missing Create missing repositories on forges before pushing
   -l, --linear         Run operations sequentially
+      --plain          Print plain output instead of the interactive display
+      --no-redact      Show credentials in output (for debugging)
 
 Examples:
   mugi pull                      Pull all repositories from all remotes
   mugi push windmark gh cb       Push to GitHub and Codeberg
   mugi add .                     Add current directory to config
   mugi add ~/Developer/mugi      Add repository at path
+  mugi add --scan ~/Developer    Choose repositories to add from a directory
   mugi rm mugi                   Remove repository from config
   mugi list                      List all tracked repositories
+  mugi remote add gl 'git@gitlab.com:${user}/${repo}.git' --alias gitlab
+                                 Define a GitLab remote
+  mugi repo remotes windmark +sh -cb
+                                 Mirror Windmark to SourceHut instead of Codeberg
+  mugi import github:fuwn --language go
+                                 Choose Go repositories to add from GitHub
+  mugi git status -sb            Show the status of every repository
 
 Config: ` + configPath()
 }
@@ -255,3 +836,54 @@ func extractLinearFlag(args []string) ([]string, bool) {
 
 	return remaining, linear
 }
+
+func extractPlainFlag(args []string) ([]string, bool) {
+	var remaining []string
+	var plain bool
+
+	for _, arg := range args {
+		if arg == "--plain" {
+			plain = true
+
+			continue
+		}
+
+		remaining = append(remaining, arg)
+	}
+
+	return remaining, plain
+}
+
+func extractNoRedactFlag(args []string) ([]string, bool) {
+	var remaining []string
+	var noRedact bool
+
+	for _, arg := range args {
+		if arg == "--no-redact" {
+			noRedact = true
+
+			continue
+		}
+
+		remaining = append(remaining, arg)
+	}
+
+	return remaining, noRedact
+}
+
+func extractCreateMissingFlag(args []string) ([]string, bool) {
+	var remaining []string
+	var createMissing bool
+
+	for _, arg := range args {
+		if arg == "--create-missing" {
+			createMissing = true
+
+			continue
+		}
+
+		remaining = append(remaining, arg)
+	}
+
+	return remaining, createMissing
+}
@@ -1,17 +1,28 @@
 package config
 
 import (
+	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
+	"github.com/ebisu/mugi/internal/giturl"
 	"gopkg.in/yaml.v3"
 )
 
 type RemoteDefinition struct {
-	Aliases []string `yaml:"aliases"`
-	URL     string   `yaml:"url"`
+	Aliases []string       `yaml:"aliases"`
+	URL     string         `yaml:"url"`
+	API     *APIDefinition `yaml:"api"`
+}
+
+type APIDefinition struct {
+	Type    string `yaml:"type"`
+	BaseURL string `yaml:"base_url"`
+	Token   string `yaml:"token"`
 }
 
 type OperationDefaults struct {
@@ -19,20 +30,115 @@ type OperationDefaults struct {
 }
 
 type Defaults struct {
-	Remotes    []string          `yaml:"remotes"`
-	PathPrefix string            `yaml:"path_prefix"`
-	Verbose    bool              `yaml:"verbose"`
-	Linear     bool              `yaml:"linear"`
-	Pull       OperationDefaults `yaml:"pull"`
-	Push       OperationDefaults `yaml:"push"`
-	Fetch      OperationDefaults `yaml:"fetch"`
+	Remotes      []string          `yaml:"remotes"`
+	PathPrefix   string            `yaml:"path_prefix"`
+	PathTemplate string            `yaml:"path_template"`
+	Verbose      bool              `yaml:"verbose"`
+	Linear       bool              `yaml:"linear"`
+	Pull         OperationDefaults `yaml:"pull"`
+	Push         OperationDefaults `yaml:"push"`
+	Fetch        OperationDefaults `yaml:"fetch"`
+	Hooks        Hooks             `yaml:"hooks"`
+	Watch        Watch             `yaml:"watch"`
+	Schedule     Schedule          `yaml:"schedule"`
+	Notify       []NotifySink      `yaml:"notify"`
+}
+
+type NotifySink struct {
+	Type     string            `yaml:"type"`
+	On       NotifyEvents      `yaml:"on"`
+	URL      string            `yaml:"url"`
+	Method   string            `yaml:"method"`
+	Format   string            `yaml:"format"`
+	Template string            `yaml:"template"`
+	Headers  map[string]string `yaml:"headers"`
+	To       []string          `yaml:"to"`
+	From     string            `yaml:"from"`
+	Command  string            `yaml:"command"`
+}
+
+type NotifyEvents []string
+
+const (
+	NotifyWebhook    = "webhook"
+	NotifySendmail   = "sendmail"
+	NotifyNotifySend = "notify-send"
+)
+
+const (
+	NotifyOnFailure  = "failure"
+	NotifyOnRecovery = "recovery"
+	NotifyOnAlways   = "always"
+)
+
+type Schedule map[string]string
+
+var ScheduleOperations = []string{"pull", "push", "fetch", "update-forks", "check"}
+
+type Watch struct {
+	FetchInterval time.Duration `yaml:"fetch_interval"`
+	PushOnChange  *bool         `yaml:"push_on_change"`
+	Debounce      time.Duration `yaml:"debounce"`
+	Socket        string        `yaml:"socket"`
+}
+
+type Hooks struct {
+	PrePull   string `yaml:"pre_pull"`
+	PostPull  string `yaml:"post_pull"`
+	PrePush   string `yaml:"pre_push"`
+	PostPush  string `yaml:"post_push"`
+	OnFailure string `yaml:"on_failure"`
 }
 
 type RepoRemotes map[string]string
 
 type Repo struct {
-	Path    string
-	Remotes RepoRemotes
+	Path       string
+	Remotes    RepoRemotes
+	Targets    map[string]Target
+	Tags       []string
+	Vars       Vars
+	Mode       string
+	Directions map[string]string
+	Upstream   *Upstream
+	Hooks      Hooks
+	Schedule   Schedule
+	Metadata
+	Sources map[string]string
+}
+
+type Metadata struct {
+	Description string   `yaml:"description"`
+	Homepage    string   `yaml:"homepage"`
+	Topics      []string `yaml:"topics"`
+	Private     *bool    `yaml:"private"`
+}
+
+type Upstream struct {
+	URL      string
+	Branches []string
+}
+
+type fork struct {
+	Upstream string   `yaml:"upstream"`
+	Branches []string `yaml:"branches"`
+}
+
+type Target struct {
+	User string
+	Repo string
+}
+
+const (
+	SourceDefault  = "default"
+	SourceTemplate = "template"
+	SourceOverride = "override"
+)
+
+var RepoKeys = []string{"path", "remotes", "tags", "vars", "mode", "hooks", "schedule", "description", "homepage", "topics", "private", "fork", "upstream"}
+
+func IsRepoKey(name string) bool {
+	return slices.Contains(RepoKeys, name)
 }
 
 type Config struct {
@@ -48,11 +154,33 @@ type rawConfig struct {
 }
 
 type remoteOverride struct {
-	User string `yaml:"user"`
-	Repo string `yaml:"repo"`
+	User      string `yaml:"user"`
+	Repo      string `yaml:"repo"`
+	URL       string `yaml:"url"`
+	Direction string `yaml:"direction"`
 }
 
+const (
+	ModeNormal  = "normal"
+	ModeMirror  = "mirror"
+	ModeArchive = "archive"
+)
+
+const (
+	DirectionPull = "pull"
+	DirectionPush = "push"
+	DirectionBoth = "both"
+)
+
 func Load(override string) (Config, error) {
+	return load(override, true)
+}
+
+func LoadFile(override string) (Config, error) {
+	return load(override, false)
+}
+
+func load(override string, withProject bool) (Config, error) {
 	path := override
 
 	if path == "" {
@@ -64,20 +192,58 @@ func Load(override string) (Config, error) {
 		}
 	}
 
-	data, err := os.ReadFile(path)
+	merged, err := loadLayer(path, nil, true)
 	if err != nil {
 		return Config{}, err
 	}
 
-	var raw rawConfig
+	if !withProject {
+		return merged.config()
+	}
+
+	if project := FindProjectConfig(); project != "" && !sameFile(project, path) {
+		projectLayer, err := loadLayer(project, nil, false)
+		if err != nil {
+			return Config{}, err
+		}
+
+		if !merged.trusts(project) {
+			if err := projectLayer.checkUntrusted(merged, filepath.Dir(project)); err != nil {
+				return Config{}, fmt.Errorf("%s: %w; add %s to trusted_projects to allow it", project, err, filepath.Dir(project))
+			}
+		}
+
+		projectLayer.TrustedProjects = nil
+
+		merged.merge(projectLayer)
+	}
+
+	return merged.config()
+}
 
-	if err := yaml.Unmarshal(data, &raw); err != nil {
+func (l layer) config() (Config, error) {
+	raw, err := l.raw()
+	if err != nil {
 		return Config{}, err
 	}
 
 	return expand(raw)
 }
 
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(infoA, infoB)
+}
+
 func expand(raw rawConfig) (Config, error) {
 	cfg := Config{
 		Remotes:  raw.Remotes,
@@ -85,6 +251,22 @@ func expand(raw rawConfig) (Config, error) {
 		Repos:    make(map[string]Repo),
 	}
 
+	if err := raw.Defaults.Schedule.validate(); err != nil {
+		return Config{}, fmt.Errorf("defaults: %w", err)
+	}
+
+	for i, sink := range raw.Defaults.Notify {
+		if err := sink.validate(); err != nil {
+			return Config{}, fmt.Errorf("defaults: notify[%d]: %w", i, err)
+		}
+	}
+
+	for name := range raw.Remotes {
+		if IsRepoKey(name) {
+			return Config{}, fmt.Errorf("remote %s: name is reserved for repo settings", name)
+		}
+	}
+
 	for name, node := range raw.Repos {
 		repo, err := expandRepo(name, node, raw)
 		if err != nil {
@@ -97,10 +279,53 @@ func expand(raw rawConfig) (Config, error) {
 	return cfg, nil
 }
 
+type Collision struct {
+	Path  string
+	Repos []string
+}
+
+func (c Config) Collisions() []Collision {
+	names := c.AllRepos()
+	owners := make(map[string][]string)
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		if c.Repos[name].Path == "" {
+			continue
+		}
+
+		path, err := filepath.Abs(c.Repos[name].ExpandPath())
+		if err != nil {
+			continue
+		}
+
+		owners[path] = append(owners[path], name)
+	}
+
+	var collisions []Collision
+
+	for path, repos := range owners {
+		if len(repos) > 1 {
+			collisions = append(collisions, Collision{Path: path, Repos: repos})
+		}
+	}
+
+	slices.SortFunc(collisions, func(a, b Collision) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return collisions
+}
+
 func expandRepo(name string, node yaml.Node, raw rawConfig) (Repo, error) {
 	user, repoName := splitRepoName(name)
 	repo := Repo{
-		Remotes: make(RepoRemotes),
+		Remotes:    make(RepoRemotes),
+		Targets:    make(map[string]Target),
+		Mode:       ModeNormal,
+		Directions: make(map[string]string),
+		Sources:    make(map[string]string),
 	}
 
 	var parsed map[string]yaml.Node
@@ -109,21 +334,65 @@ func expandRepo(name string, node yaml.Node, raw rawConfig) (Repo, error) {
 		parsed = make(map[string]yaml.Node)
 	}
 
-	if pathNode, ok := parsed["path"]; ok {
-		var path string
+	if tagsNode, ok := parsed["tags"]; ok {
+		tagsNode.Decode(&repo.Tags)
+	}
 
-		pathNode.Decode(&path)
+	if varsNode, ok := parsed["vars"]; ok {
+		if err := varsNode.Decode(&repo.Vars); err != nil {
+			return Repo{}, fmt.Errorf("repo %s: vars: %w", name, err)
+		}
+	}
 
-		repo.Path = path
-	} else if raw.Defaults.PathPrefix != "" {
-		repo.Path = filepath.Join(raw.Defaults.PathPrefix, repoName)
+	if err := node.Decode(&repo.Metadata); err != nil && len(parsed) > 0 {
+		return Repo{}, fmt.Errorf("repo %s: %w", name, err)
+	}
+
+	if modeNode, ok := parsed["mode"]; ok {
+		modeNode.Decode(&repo.Mode)
+
+		switch repo.Mode {
+		case ModeNormal, ModeMirror, ModeArchive:
+		default:
+			return Repo{}, fmt.Errorf("repo %s: invalid mode %q (expected normal, mirror or archive)", name, repo.Mode)
+		}
+	}
+
+	repo.Hooks = raw.Defaults.Hooks
+
+	if hooksNode, ok := parsed["hooks"]; ok {
+		if err := hooksNode.Decode(&repo.Hooks); err != nil {
+			return Repo{}, fmt.Errorf("repo %s: hooks: %w", name, err)
+		}
+	}
+
+	if scheduleNode, ok := parsed["schedule"]; ok {
+		if err := scheduleNode.Decode(&repo.Schedule); err != nil {
+			return Repo{}, fmt.Errorf("repo %s: schedule: %w", name, err)
+		}
+
+		if err := repo.Schedule.validate(); err != nil {
+			return Repo{}, fmt.Errorf("repo %s: %w", name, err)
+		}
+	}
+
+	if forkNode, ok := parsed["fork"]; ok {
+		upstream, err := parseFork(name, forkNode, repo.Vars)
+		if err != nil {
+			return Repo{}, fmt.Errorf("repo %s: fork: %w", name, err)
+		}
+
+		repo.Upstream = upstream
 	}
 
 	remoteList := raw.Defaults.Remotes
+	repo.Sources["remotes"] = SourceDefault
 
 	if remotesNode, ok := parsed["remotes"]; ok {
 		var list []string
 
+		repo.Sources["remotes"] = SourceOverride
+
 		if err := remotesNode.Decode(&list); err == nil {
 			remoteList = list
 		} else {
@@ -131,31 +400,71 @@ func expandRepo(name string, node yaml.Node, raw rawConfig) (Repo, error) {
 
 			if err := remotesNode.Decode(&oldStyle); err == nil {
 				repo.Remotes = oldStyle
+				remoteList = slices.Sorted(maps.Keys(oldStyle))
 
-				return repo, nil
+				for remoteName := range oldStyle {
+					repo.Sources[remoteName] = SourceOverride
+				}
 			}
 		}
 	}
 
 	for _, remoteName := range remoteList {
+		if IsRepoKey(remoteName) {
+			return Repo{}, fmt.Errorf("repo %s: remote %s: name is reserved for repo settings", name, remoteName)
+		}
+
+		if overrideNode, ok := parsed[remoteName]; ok && overrideNode.Kind == yaml.MappingNode {
+			var override remoteOverride
+
+			overrideNode.Decode(&override)
+
+			switch override.Direction {
+			case "":
+			case DirectionPull, DirectionPush, DirectionBoth:
+				repo.Directions[remoteName] = override.Direction
+			default:
+				return Repo{}, fmt.Errorf("repo %s: remote %s: invalid direction %q (expected pull, push or both)", name, remoteName, override.Direction)
+			}
+		}
+
+		if _, ok := repo.Remotes[remoteName]; ok {
+			continue
+		}
+
 		remoteUser, remoteRepo := user, repoName
+		source := SourceTemplate
 
 		if overrideNode, ok := parsed[remoteName]; ok {
 			var override remoteOverride
 
 			if err := overrideNode.Decode(&override); err == nil {
+				if override.URL != "" {
+					repo.Remotes[remoteName] = override.URL
+					repo.Sources[remoteName] = SourceOverride
+
+					continue
+				}
+
 				if override.User != "" {
 					remoteUser = override.User
+					source = SourceTemplate + ", user override"
 				}
 
 				if override.Repo != "" {
 					remoteRepo = override.Repo
+					source = SourceTemplate + ", repo override"
+				}
+
+				if override.User != "" && override.Repo != "" {
+					source = SourceTemplate + ", user and repo override"
 				}
 			} else {
 				var urlOverride string
 
 				if err := overrideNode.Decode(&urlOverride); err == nil {
 					repo.Remotes[remoteName] = urlOverride
+					repo.Sources[remoteName] = SourceOverride
 
 					continue
 				}
@@ -163,30 +472,142 @@ func expandRepo(name string, node yaml.Node, raw rawConfig) (Repo, error) {
 		}
 
 		if def, ok := raw.Remotes[remoteName]; ok && def.URL != "" {
-			url := expandURL(def.URL, remoteUser, remoteRepo)
+			vars := repoVars(name, remoteUser, remoteRepo, repo.Vars)
+			vars["host"] = giturl.TemplateHost(def.URL)
+
+			url, err := Expand(def.URL, vars)
+			if err != nil {
+				return Repo{}, fmt.Errorf("repo %s: remote %s: %w", name, remoteName, err)
+			}
 
 			repo.Remotes[remoteName] = url
+			repo.Targets[remoteName] = Target{User: remoteUser, Repo: remoteRepo}
+			repo.Sources[remoteName] = source
+		}
+	}
+
+	for remoteName, url := range repo.Remotes {
+		if _, ok := repo.Targets[remoteName]; ok {
+			continue
+		}
+
+		if parsed, err := giturl.Parse(url); err == nil {
+			targetUser, targetRepo := splitRepoName(parsed.RepoName())
+			repo.Targets[remoteName] = Target{User: targetUser, Repo: targetRepo}
 		}
 	}
 
+	if err := resolvePath(&repo, name, parsed, raw.Defaults, remoteList); err != nil {
+		return Repo{}, fmt.Errorf("repo %s: path: %w", name, err)
+	}
+
 	return repo, nil
 }
 
-func expandURL(template, user, repo string) string {
-	url := strings.ReplaceAll(template, "${user}", user)
-	url = strings.ReplaceAll(url, "${repo}", repo)
+func parseFork(name string, node yaml.Node, custom Vars) (*Upstream, error) {
+	var entry fork
+
+	if err := node.Decode(&entry); err != nil {
+		return nil, err
+	}
+
+	if entry.Upstream == "" {
+		return nil, fmt.Errorf("upstream is required")
+	}
+
+	user, repoName := splitRepoName(name)
+	vars := repoVars(name, user, repoName, custom)
+	vars["host"] = giturl.TemplateHost(entry.Upstream)
 
-	return url
+	url, err := Expand(entry.Upstream, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Upstream{URL: url, Branches: entry.Branches}, nil
 }
 
-func splitRepoName(name string) (user, repo string) {
-	parts := strings.SplitN(name, "/", 2)
+func resolvePath(repo *Repo, name string, parsed map[string]yaml.Node, defaults Defaults, remoteList []string) error {
+	host := firstHost(repo.Remotes, remoteList)
+
+	if pathNode, ok := parsed["path"]; ok {
+		var path string
+
+		pathNode.Decode(&path)
+
+		user, repoName := splitRepoName(name)
+		vars := repoVars(name, user, repoName, repo.Vars)
+		vars["host"] = host
+
+		expanded, err := Expand(path, vars)
+		if err != nil {
+			return err
+		}
+
+		repo.Path = expanded
+		repo.Sources["path"] = SourceOverride
 
-	if len(parts) == 2 {
-		return parts[0], parts[1]
+		return nil
 	}
 
-	return "", parts[0]
+	path, err := defaults.RepoPath(name, host, repo.Vars)
+	if err != nil {
+		return err
+	}
+
+	if path != "" {
+		repo.Path = path
+		repo.Sources["path"] = SourceDefault
+	}
+
+	return nil
+}
+
+func firstHost(remotes RepoRemotes, order []string) string {
+	for _, remoteName := range order {
+		if url, ok := remotes[remoteName]; ok {
+			if parsed, err := giturl.Parse(url); err == nil {
+				return parsed.Host
+			}
+		}
+	}
+
+	return ""
+}
+
+func (d Defaults) RepoPath(name, host string, custom Vars) (string, error) {
+	user, repoName := splitRepoName(name)
+
+	if d.PathTemplate != "" {
+		vars := repoVars(name, user, repoName, custom)
+		vars["host"] = host
+
+		return Expand(d.PathTemplate, vars)
+	}
+
+	if d.PathPrefix != "" {
+		return filepath.Join(d.PathPrefix, repoName), nil
+	}
+
+	return "", nil
+}
+
+func (d Defaults) LegacyPath(name string) string {
+	if d.PathPrefix == "" {
+		return ""
+	}
+
+	_, repoName := splitRepoName(name)
+
+	return filepath.Join(d.PathPrefix, repoName)
+}
+
+func splitRepoName(name string) (user, repo string) {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+
+	return "", name
 }
 
 func Path() (string, error) {
@@ -251,8 +672,10 @@ func (c Config) ResolveAlias(alias string) string {
 }
 
 func (r Repo) ExpandPath() string {
-	path := r.Path
+	return expandHome(r.Path)
+}
 
+func expandHome(path string) string {
 	if len(path) > 0 && path[0] == '~' {
 		if home, err := os.UserHomeDir(); err == nil {
 			path = filepath.Join(home, path[1:])
@@ -262,6 +685,146 @@ func (r Repo) ExpandPath() string {
 	return path
 }
 
+func (r Repo) Direction(remoteName string) string {
+	if direction, ok := r.Directions[remoteName]; ok {
+		return direction
+	}
+
+	if r.Mode == ModeMirror || r.Mode == ModeArchive {
+		return DirectionPull
+	}
+
+	return DirectionBoth
+}
+
+func (h Hooks) Pre(operation string) string {
+	switch operation {
+	case "pull":
+		return h.PrePull
+	case "push":
+		return h.PrePush
+	default:
+		return ""
+	}
+}
+
+func (h Hooks) Post(operation string) string {
+	switch operation {
+	case "pull":
+		return h.PostPull
+	case "push":
+		return h.PostPush
+	default:
+		return ""
+	}
+}
+
+func (s Schedule) validate() error {
+	for operation, calendar := range s {
+		if !slices.Contains(ScheduleOperations, operation) {
+			return fmt.Errorf("schedule: unknown operation %q (expected %s)", operation, strings.Join(ScheduleOperations, ", "))
+		}
+
+		if strings.TrimSpace(calendar) == "" || strings.ContainsAny(calendar, "\n\r") {
+			return fmt.Errorf("schedule: invalid calendar %q for %s", calendar, operation)
+		}
+	}
+
+	return nil
+}
+
+func (e *NotifyEvents) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*e = NotifyEvents{node.Value}
+
+		return nil
+	}
+
+	var events []string
+
+	if err := node.Decode(&events); err != nil {
+		return err
+	}
+
+	*e = events
+
+	return nil
+}
+
+func (s NotifySink) validate() error {
+	switch s.Type {
+	case NotifyWebhook:
+		if s.URL == "" {
+			return fmt.Errorf("webhook requires a url")
+		}
+
+		switch s.Format {
+		case "", "json", "slack", "matrix", "ntfy":
+		default:
+			return fmt.Errorf("invalid format %q (expected json, slack, matrix or ntfy)", s.Format)
+		}
+	case NotifySendmail:
+		if len(s.To) == 0 {
+			return fmt.Errorf("sendmail requires to")
+		}
+	case NotifyNotifySend:
+	default:
+		return fmt.Errorf("invalid type %q (expected webhook, sendmail or notify-send)", s.Type)
+	}
+
+	for _, event := range s.On {
+		switch event {
+		case NotifyOnFailure, NotifyOnRecovery, NotifyOnAlways:
+		default:
+			return fmt.Errorf("invalid event %q (expected failure, recovery or always)", event)
+		}
+	}
+
+	return nil
+}
+
+func (s NotifySink) Fires(event string) bool {
+	events := s.On
+
+	if len(events) == 0 {
+		events = NotifyEvents{NotifyOnFailure}
+	}
+
+	return slices.Contains(events, NotifyOnAlways) || slices.Contains(events, event)
+}
+
+func (w Watch) Interval() time.Duration {
+	if w.FetchInterval <= 0 {
+		return 15 * time.Minute
+	}
+
+	return w.FetchInterval
+}
+
+func (w Watch) DebounceDelay() time.Duration {
+	if w.Debounce <= 0 {
+		return 5 * time.Second
+	}
+
+	return w.Debounce
+}
+
+func (w Watch) PushesOnChange() bool {
+	return w.PushOnChange == nil || *w.PushOnChange
+}
+
+func (w Watch) SocketPath() string {
+	if w.Socket != "" {
+		return expandHome(w.Socket)
+	}
+
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "mugi", "watch.sock")
+	}
+
+	return filepath.Join(os.TempDir(), fmt.Sprintf("mugi-%d", os.Getuid()), "watch.sock")
+}
+
 func (d Defaults) RemotesFor(operation string) []string {
 	switch operation {
 	case "pull":
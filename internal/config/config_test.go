@@ -0,0 +1,130 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestForkUpstream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeTestFile(t, path, `remotes:
+  github:
+    url: git@github.com:${user}/${repo}.git
+defaults:
+  remotes: [github]
+repos:
+  ebisu/fork:
+    fork:
+      upstream: https://github.com/other/${repo}.git
+      branches: [main]
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	repo := cfg.Repos["ebisu/fork"]
+
+	if repo.Upstream == nil || repo.Upstream.URL != "https://github.com/other/fork.git" || strings.Join(repo.Upstream.Branches, ",") != "main" {
+		t.Errorf("upstream = %+v", repo.Upstream)
+	}
+
+	if len(repo.Remotes) != 1 || repo.Remotes["github"] != "git@github.com:ebisu/fork.git" {
+		t.Errorf("remotes = %v, want only github", repo.Remotes)
+	}
+}
+
+func TestRemoteNamesReserved(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name:   "definition",
+			config: "remotes:\n  upstream:\n    url: https://github.com/${user}/${repo}.git\nrepos:\n",
+			err:    "remote upstream: name is reserved",
+		},
+		{
+			name:   "repo list",
+			config: "repos:\n  ebisu/demo:\n    remotes: [origin, upstream]\n    upstream: https://github.com/other/demo.git\n",
+			err:    "repo ebisu/demo: remote upstream: name is reserved",
+		},
+		{
+			name:   "old style map",
+			config: "repos:\n  ebisu/demo:\n    remotes:\n      path: https://example.com/demo.git\n",
+			err:    "repo ebisu/demo: remote path: name is reserved",
+		},
+		{
+			name:   "fork without upstream",
+			config: "repos:\n  ebisu/demo:\n    fork:\n      branches: [main]\n",
+			err:    "repo ebisu/demo: fork: upstream is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+
+			writeTestFile(t, path, tt.config)
+
+			if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("LoadFile() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	cfg := Config{
+		Repos: map[string]Repo{
+			"ebisu/a_b": {Path: "/src/a-b"},
+			"ebisu/a-b": {Path: "/src/a-b"},
+			"ebisu/c":   {Path: "/src/c"},
+			"ebisu/d":   {},
+		},
+	}
+
+	collisions := cfg.Collisions()
+
+	if len(collisions) != 1 || collisions[0].Path != "/src/a-b" || !slices.Equal(collisions[0].Repos, []string{"ebisu/a-b", "ebisu/a_b"}) {
+		t.Errorf("Collisions() = %+v, want ebisu/a-b and ebisu/a_b at /src/a-b", collisions)
+	}
+}
+
+func TestNestedRepoNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeTestFile(t, path, `remotes:
+  gitlab:
+    url: git@gitlab.com:${user}/${repo}.git
+defaults:
+  remotes: [gitlab]
+  path_prefix: /src
+repos:
+  group/subgroup/proj: {}
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	repo := cfg.Repos["group/subgroup/proj"]
+
+	if got := repo.Remotes["gitlab"]; got != "git@gitlab.com:group/subgroup/proj.git" {
+		t.Errorf("gitlab = %s", got)
+	}
+
+	if target := repo.Targets["gitlab"]; target.User != "group/subgroup" || target.Repo != "proj" {
+		t.Errorf("target = %+v, want group/subgroup and proj", target)
+	}
+
+	if repo.Path != filepath.Join("/src", "proj") {
+		t.Errorf("path = %s", repo.Path)
+	}
+}
@@ -0,0 +1,389 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ProjectFile = ".mugi.yaml"
+
+type layer struct {
+	Include         []string             `yaml:"include"`
+	TrustedProjects []string             `yaml:"trusted_projects"`
+	Remotes         map[string]yaml.Node `yaml:"remotes"`
+	Defaults        yaml.Node            `yaml:"defaults"`
+	Repos           map[string]yaml.Node `yaml:"repos"`
+	Secrets         map[string]yaml.Node `yaml:"secrets"`
+}
+
+var untrustedKeys = []string{"hooks", "notify"}
+
+var untrustedDefaults = []string{"verbose", "linear"}
+
+func loadLayer(path string, stack []string, root bool) (layer, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return layer{}, err
+	}
+
+	for _, seen := range stack {
+		if seen == absPath {
+			return layer{}, fmt.Errorf("include cycle: %s", strings.Join(append(stack, absPath), " → "))
+		}
+	}
+
+	stack = append(stack, absPath)
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return layer{}, err
+	}
+
+	var current layer
+
+	if err := yaml.Unmarshal(data, &current); err != nil {
+		return layer{}, fmt.Errorf("%s: %w", absPath, err)
+	}
+
+	if !root {
+		resolveRepoPaths(current.Repos, filepath.Dir(absPath))
+	}
+
+	merged := layer{
+		Remotes: make(map[string]yaml.Node),
+		Repos:   make(map[string]yaml.Node),
+		Secrets: make(map[string]yaml.Node),
+	}
+
+	for _, pattern := range current.Include {
+		paths, err := includePaths(pattern, filepath.Dir(absPath))
+		if err != nil {
+			return layer{}, fmt.Errorf("%s: include %s: %w", absPath, pattern, err)
+		}
+
+		for _, includePath := range paths {
+			included, err := loadLayer(includePath, stack, false)
+			if err != nil {
+				return layer{}, err
+			}
+
+			merged.merge(included)
+		}
+	}
+
+	merged.merge(current)
+
+	return merged, nil
+}
+
+func includePaths(pattern, dir string) ([]string, error) {
+	pattern = Repo{Path: pattern}.ExpandPath()
+
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	return filepath.Glob(pattern)
+}
+
+func resolveRepoPaths(repos map[string]yaml.Node, dir string) {
+	for name, node := range repos {
+		if node.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != "path" {
+				continue
+			}
+
+			value := node.Content[i+1]
+
+			if value.Kind == yaml.ScalarNode && isRelativePath(value.Value) {
+				value.Value = filepath.Join(dir, value.Value)
+			}
+		}
+
+		repos[name] = node
+	}
+}
+
+func isRelativePath(path string) bool {
+	return path != "" && !filepath.IsAbs(path) && !strings.HasPrefix(path, "~") && !strings.HasPrefix(path, "$")
+}
+
+func (l *layer) merge(other layer) {
+	for name, node := range other.Remotes {
+		l.Remotes[name] = node
+	}
+
+	for name, node := range other.Repos {
+		l.Repos[name] = node
+	}
+
+	for name, node := range other.Secrets {
+		l.Secrets[name] = node
+	}
+
+	l.TrustedProjects = append(l.TrustedProjects, other.TrustedProjects...)
+	l.Defaults = mergeNodes(l.Defaults, other.Defaults)
+}
+
+func (l layer) trusts(project string) bool {
+	dir := filepath.Dir(project)
+
+	for _, trusted := range l.TrustedProjects {
+		trusted = filepath.Clean(Repo{Path: trusted}.ExpandPath())
+
+		if trusted == dir || trusted == project {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l layer) checkUntrusted(trusted layer, dir string) error {
+	if len(l.Remotes) > 0 {
+		return fmt.Errorf("untrusted project config may not define remotes")
+	}
+
+	if len(l.Secrets) > 0 {
+		return fmt.Errorf("untrusted project config may not define secrets")
+	}
+
+	if key := findOtherKey(&l.Defaults, untrustedDefaults); key != "" {
+		return fmt.Errorf("untrusted project config may not set defaults.%s", key)
+	}
+
+	for name, node := range l.Repos {
+		if _, exists := trusted.Repos[name]; exists {
+			return fmt.Errorf("untrusted project config may not override repo %s", name)
+		}
+
+		if key := findKey(&node, untrustedKeys); key != "" {
+			return fmt.Errorf("untrusted project config may not set %s for repo %s", key, name)
+		}
+
+		if hasReference(&node) {
+			return fmt.Errorf("untrusted project config may not reference environment variables or secrets in repo %s", name)
+		}
+
+		if key := findURL(&node); key != "" {
+			return fmt.Errorf("untrusted project config may not set a URL for repo %s (%s)", name, key)
+		}
+
+		if path := mappingScalar(&node, "path"); path != "" && !within(path, dir) {
+			return fmt.Errorf("untrusted project config may not place repo %s outside %s", name, dir)
+		}
+	}
+
+	return nil
+}
+
+func findOtherKey(node *yaml.Node, allowed []string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if !slices.Contains(allowed, node.Content[i].Value) {
+			return node.Content[i].Value
+		}
+	}
+
+	return ""
+}
+
+func findURL(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+
+		switch {
+		case key == "fork":
+			return key
+		case key == "remotes" && value.Kind == yaml.MappingNode:
+			return key
+		case IsRepoKey(key):
+		case value.Kind == yaml.ScalarNode:
+			return key
+		case mappingScalar(value, "url") != "":
+			return key + ".url"
+		}
+	}
+
+	return ""
+}
+
+func mappingScalar(node *yaml.Node, key string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i+1].Kind == yaml.ScalarNode {
+			return node.Content[i+1].Value
+		}
+	}
+
+	return ""
+}
+
+func within(path, dir string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+
+	relative, err := filepath.Rel(dir, filepath.Clean(path))
+
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+func findKey(node *yaml.Node, keys []string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if slices.Contains(keys, node.Content[i].Value) {
+			return node.Content[i].Value
+		}
+	}
+
+	return ""
+}
+
+func hasReference(node *yaml.Node) bool {
+	if node.Kind == yaml.ScalarNode {
+		for _, match := range environmentPattern.FindAllString(node.Value, -1) {
+			if match != "$$" {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, child := range node.Content {
+		if hasReference(child) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mergeNodes(base, override yaml.Node) yaml.Node {
+	if override.Kind == 0 || (override.Kind == yaml.ScalarNode && override.Tag == "!!null") {
+		return base
+	}
+
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+
+	merged := base
+	merged.Content = append([]*yaml.Node(nil), base.Content...)
+
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		replaced := false
+
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				combined := mergeNodes(*merged.Content[j+1], *value)
+				merged.Content[j+1] = &combined
+				replaced = true
+
+				break
+			}
+		}
+
+		if !replaced {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+
+	return merged
+}
+
+func (l layer) raw() (rawConfig, error) {
+	raw := rawConfig{
+		Remotes: make(map[string]RemoteDefinition),
+		Repos:   l.Repos,
+	}
+
+	secrets, err := newSecretStore(l.Secrets)
+	if err != nil {
+		return rawConfig{}, err
+	}
+
+	for name, node := range l.Repos {
+		if err := expandNode(&node, secrets, "path", "fork.upstream"); err != nil {
+			return rawConfig{}, fmt.Errorf("repo %s: %w", name, err)
+		}
+
+		raw.Repos[name] = node
+	}
+
+	if err := expandNode(&l.Defaults, secrets, "path_template"); err != nil {
+		return rawConfig{}, fmt.Errorf("defaults: %w", err)
+	}
+
+	for name, node := range l.Remotes {
+		var def RemoteDefinition
+
+		if err := expandNode(&node, secrets, "url"); err != nil {
+			return rawConfig{}, fmt.Errorf("remote %s: %w", name, err)
+		}
+
+		if err := node.Decode(&def); err != nil {
+			return rawConfig{}, fmt.Errorf("remote %s: %w", name, err)
+		}
+
+		raw.Remotes[name] = def
+	}
+
+	if l.Defaults.Kind != 0 {
+		if err := l.Defaults.Decode(&raw.Defaults); err != nil {
+			return rawConfig{}, fmt.Errorf("defaults: %w", err)
+		}
+	}
+
+	return raw, nil
+}
+
+func FindProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		candidate := filepath.Join(dir, ProjectFile)
+
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+
+		dir = parent
+	}
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ebisu/mugi/internal/redact"
+	"gopkg.in/yaml.v3"
+)
+
+type SecretSource interface {
+	Resolve(value string) (string, error)
+}
+
+type SecretSourceFunc func(value string) (string, error)
+
+func (f SecretSourceFunc) Resolve(value string) (string, error) {
+	return f(value)
+}
+
+var (
+	secretSourcesMu sync.RWMutex
+	secretSources   = map[string]SecretSource{
+		"env":     SecretSourceFunc(envSecret),
+		"file":    SecretSourceFunc(fileSecret),
+		"command": SecretSourceFunc(commandSecret),
+	}
+)
+
+func RegisterSecretSource(kind string, source SecretSource) {
+	secretSourcesMu.Lock()
+	defer secretSourcesMu.Unlock()
+
+	secretSources[kind] = source
+}
+
+func envSecret(value string) (string, error) {
+	secret, ok := os.LookupEnv(value)
+	if !ok {
+		return "", fmt.Errorf("environment variable not set: %s", value)
+	}
+
+	return secret, nil
+}
+
+func fileSecret(value string) (string, error) {
+	data, err := os.ReadFile(Repo{Path: value}.ExpandPath())
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+var (
+	commandSecretsMu sync.Mutex
+	commandSecrets   = make(map[string]string)
+)
+
+func commandSecret(value string) (string, error) {
+	commandSecretsMu.Lock()
+	defer commandSecretsMu.Unlock()
+
+	if secret, ok := commandSecrets[value]; ok {
+		return secret, nil
+	}
+
+	cmd := exec.Command("sh", "-c", value)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("command %q: %w", value, err)
+	}
+
+	secret, _, _ := strings.Cut(string(out), "\n")
+	secret = strings.TrimSpace(secret)
+
+	commandSecrets[value] = secret
+
+	return secret, nil
+}
+
+type secretStore struct {
+	definitions map[string]map[string]string
+	resolved    map[string]string
+}
+
+func newSecretStore(nodes map[string]yaml.Node) (*secretStore, error) {
+	store := &secretStore{
+		definitions: make(map[string]map[string]string),
+		resolved:    make(map[string]string),
+	}
+
+	for name, node := range nodes {
+		var definition map[string]string
+
+		if err := node.Decode(&definition); err != nil {
+			return nil, fmt.Errorf("secret %s: %w", name, err)
+		}
+
+		if len(definition) != 1 {
+			return nil, fmt.Errorf("secret %s: expected exactly one source", name)
+		}
+
+		store.definitions[name] = definition
+	}
+
+	return store, nil
+}
+
+func (s *secretStore) lookup(name string) (string, error) {
+	if value, ok := s.resolved[name]; ok {
+		return value, nil
+	}
+
+	definition, ok := s.definitions[name]
+	if !ok {
+		return "", fmt.Errorf("unknown secret: %s", name)
+	}
+
+	for kind, value := range definition {
+		secretSourcesMu.RLock()
+		source, ok := secretSources[kind]
+		secretSourcesMu.RUnlock()
+
+		if !ok {
+			return "", fmt.Errorf("secret %s: unknown source: %s", name, kind)
+		}
+
+		secret, err := source.Resolve(value)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", name, err)
+		}
+
+		redact.Register(secret)
+
+		s.resolved[name] = secret
+	}
+
+	return s.resolved[name], nil
+}
+
+var environmentPattern = regexp.MustCompile(`\$\$|\$\{((?:env|secret):[^}]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+func expandEnvironment(s string, secrets *secretStore, template bool) (string, error) {
+	var expandErr error
+
+	expanded := environmentPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			if template {
+				return match
+			}
+
+			return "$"
+		}
+
+		groups := environmentPattern.FindStringSubmatch(match)
+
+		var (
+			value string
+			err   error
+		)
+
+		if groups[1] != "" {
+			value, err = evaluate(groups[1], nil, secrets)
+		} else {
+			value, err = envSecret(groups[2])
+		}
+
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+
+		if template {
+			value = strings.ReplaceAll(value, "$", "$$")
+		}
+
+		return value
+	})
+
+	return expanded, expandErr
+}
+
+var verbatimKeys = []string{"hooks", "template"}
+
+func expandNode(node *yaml.Node, secrets *secretStore, templates ...string) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return expandScalar(node, secrets, false)
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			key := node.Content[i-1].Value
+
+			if slices.Contains(verbatimKeys, key) {
+				continue
+			}
+
+			var err error
+
+			if slices.Contains(templates, key) && node.Content[i].Kind == yaml.ScalarNode {
+				err = expandScalar(node.Content[i], secrets, true)
+			} else {
+				err = expandNode(node.Content[i], secrets, nestedTemplates(templates, key)...)
+			}
+
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	case yaml.SequenceNode, yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := expandNode(child, secrets); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func expandScalar(node *yaml.Node, secrets *secretStore, template bool) error {
+	if !strings.Contains(node.Value, "$") {
+		return nil
+	}
+
+	expanded, err := expandEnvironment(node.Value, secrets, template)
+	if err != nil {
+		return err
+	}
+
+	node.Value = expanded
+
+	return nil
+}
+
+func nestedTemplates(templates []string, key string) []string {
+	var nested []string
+
+	for _, template := range templates {
+		if rest, ok := strings.CutPrefix(template, key+"."); ok {
+			nested = append(nested, rest)
+		}
+	}
+
+	return nested
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/giturl"
+)
+
+type Vars map[string]string
+
+var placeholderPattern = regexp.MustCompile(`\$\$|\$\{([^}]*)\}`)
+
+func Expand(template string, vars Vars) (string, error) {
+	var expandErr error
+
+	expanded := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if placeholder == "$$" {
+			return "$"
+		}
+
+		value, err := evaluate(placeholder[2:len(placeholder)-1], vars, nil)
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+
+		return value
+	})
+
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	return expanded, nil
+}
+
+func evaluate(expr string, vars Vars, secrets *secretStore) (string, error) {
+	parts := strings.Split(expr, "|")
+	name := strings.TrimSpace(parts[0])
+
+	value, err := lookup(name, vars, secrets)
+	if err != nil {
+		return "", err
+	}
+
+	for _, filter := range parts[1:] {
+		value, err = giturl.ApplyFilter(strings.TrimSpace(filter), value)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return value, nil
+}
+
+func lookup(name string, vars Vars, secrets *secretStore) (string, error) {
+	if variable, ok := strings.CutPrefix(name, "env:"); ok {
+		return envSecret(variable)
+	}
+
+	if secretName, ok := strings.CutPrefix(name, "secret:"); ok {
+		if secrets == nil {
+			return "", fmt.Errorf("secrets are not available here: %s", secretName)
+		}
+
+		return secrets.lookup(secretName)
+	}
+
+	if value, ok := vars[name]; ok {
+		return value, nil
+	}
+
+	return "", fmt.Errorf("unknown variable: ${%s}", name)
+}
+
+func repoVars(name, user, repo string, custom map[string]string) Vars {
+	vars := make(Vars, len(custom)+6)
+
+	for key, value := range custom {
+		vars[key] = value
+	}
+
+	vars["name"] = name
+	vars["user"] = user
+	vars["owner"] = user
+	vars["repo"] = repo
+	vars["repo_lower"] = strings.ToLower(repo)
+
+	return vars
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandFilters(t *testing.T) {
+	vars := repoVars("Ebisu/My_Tool", "Ebisu", "My_Tool", map[string]string{"prefix": "go-tool"})
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"${repo|lower}", "my_tool"},
+		{"${repo|upper}", "MY_TOOL"},
+		{"${repo|replace:_:-}", "My-Tool"},
+		{"${repo|replace:_:}", "MyTool"},
+		{"${prefix|trim_prefix:go-}", "tool"},
+		{"${prefix|trim_suffix:-tool}", "go"},
+		{"${prefix|trim_prefix:rs-}", "go-tool"},
+		{"${repo | lower | replace:_:-}", "my-tool"},
+		{"${name|lower}", "ebisu/my_tool"},
+		{"$${repo|lower}", "${repo|lower}"},
+	}
+
+	for _, tt := range tests {
+		got, err := Expand(tt.template, vars)
+		if err != nil {
+			t.Errorf("Expand(%q) error = %v", tt.template, err)
+
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestExpandFilterErrors(t *testing.T) {
+	vars := repoVars("ebisu/tool", "ebisu", "tool", nil)
+
+	for template, want := range map[string]string{
+		"${repo|title}":     "unknown filter: title",
+		"${repo|replace:_}": "replace filter requires replace:old:new",
+		"${missing|lower}":  "unknown variable: ${missing}",
+		"${secret:token}":   "secrets are not available here",
+	} {
+		if _, err := Expand(template, vars); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expand(%q) error = %v, want %q", template, err, want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/giturl"
+)
+
+type Repository struct {
+	Owner string
+	Name  string
+	config.Metadata
+}
+
+type Client interface {
+	Exists(ctx context.Context, owner, name string) (bool, error)
+	Create(ctx context.Context, repo Repository) error
+	Metadata(ctx context.Context, owner, name string) (config.Metadata, error)
+	UpdateMetadata(ctx context.Context, repo Repository) error
+	MetadataFields() []string
+	List(ctx context.Context, owner string) ([]Listing, error)
+}
+
+var ErrUnsupported = errors.New("unsupported forge type")
+
+func New(def config.RemoteDefinition, httpClient *http.Client) (Client, error) {
+	if def.API == nil {
+		return nil, fmt.Errorf("remote has no api definition")
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	api := *def.API
+	baseURL := strings.TrimSuffix(api.BaseURL, "/")
+
+	switch api.Type {
+	case "github":
+		if baseURL == "" {
+			baseURL = "https://api.github.com"
+		}
+
+		return &github{api: newAPI(httpClient, baseURL).authorize("Authorization", "Bearer", api.Token)}, nil
+	case "gitea", "forgejo":
+		if baseURL == "" {
+			baseURL = "https://" + giturl.TemplateHost(def.URL)
+		}
+
+		return &gitea{api: newAPI(httpClient, baseURL+"/api/v1").authorize("Authorization", "token", api.Token)}, nil
+	case "gitlab":
+		if baseURL == "" {
+			baseURL = "https://gitlab.com"
+		}
+
+		return &gitlab{api: newAPI(httpClient, baseURL+"/api/v4").authorize("PRIVATE-TOKEN", "", api.Token)}, nil
+	case "sourcehut":
+		if baseURL == "" {
+			baseURL = "https://git.sr.ht"
+		}
+
+		return &sourcehut{api: newAPI(httpClient, baseURL).authorize("Authorization", "Bearer", api.Token)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, api.Type)
+	}
+}
+
+type Outcome struct {
+	Repo    string
+	Remote  string
+	Created bool
+	Error   error
+}
+
+func EnsureRepos(ctx context.Context, cfg config.Config, targets map[string][]string, httpClient *http.Client) []Outcome {
+	var outcomes []Outcome
+
+	clients := make(map[string]Client)
+	repoNames := slices.Sorted(maps.Keys(targets))
+
+	for _, repoName := range repoNames {
+		repo := cfg.Repos[repoName]
+
+		for _, remoteName := range targets[repoName] {
+			def, ok := cfg.Remotes[remoteName]
+			if !ok || def.API == nil {
+				continue
+			}
+
+			target, ok := repo.Targets[remoteName]
+			if !ok {
+				continue
+			}
+
+			outcome := Outcome{Repo: repoName, Remote: remoteName}
+
+			client, ok := clients[remoteName]
+			if !ok {
+				var err error
+
+				client, err = New(def, httpClient)
+				if err != nil {
+					outcome.Error = err
+					outcomes = append(outcomes, outcome)
+
+					continue
+				}
+
+				clients[remoteName] = client
+			}
+
+			outcome.Created, outcome.Error = ensure(ctx, client, Repository{
+				Owner:    target.User,
+				Name:     target.Repo,
+				Metadata: repo.Metadata,
+			})
+
+			outcomes = append(outcomes, outcome)
+		}
+	}
+
+	return outcomes
+}
+
+func ensure(ctx context.Context, client Client, repo Repository) (bool, error) {
+	exists, err := client.Exists(ctx, repo.Owner, repo.Name)
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	if err := client.Create(ctx, repo); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func isPrivate(metadata config.Metadata) bool {
+	return metadata.Private != nil && *metadata.Private
+}
+
+func APIRemotes(cfg config.Config, repo config.Repo) []string {
+	var names []string
+
+	for name := range repo.Remotes {
+		if def, ok := cfg.Remotes[name]; ok && def.API != nil {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+type api struct {
+	client  *http.Client
+	baseURL string
+	headers map[string]string
+}
+
+type StatusError struct {
+	Method  string
+	URL     string
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.Status, http.StatusText(e.Status))
+	}
+
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.URL, e.Status, http.StatusText(e.Status), e.Message)
+}
+
+func newAPI(client *http.Client, baseURL string) *api {
+	return &api{
+		client:  client,
+		baseURL: baseURL,
+		headers: map[string]string{
+			"Accept":     "application/json",
+			"User-Agent": "mugi",
+		},
+	}
+}
+
+func (a *api) authorize(header, scheme, token string) *api {
+	if token == "" {
+		return a
+	}
+
+	if scheme != "" {
+		token = scheme + " " + token
+	}
+
+	a.headers[header] = token
+
+	return a
+}
+
+func (a *api) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range a.headers {
+		req.Header.Set(key, value)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{
+			Method:  method,
+			URL:     a.baseURL + path,
+			Status:  resp.StatusCode,
+			Message: errorMessage(data),
+		}
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func errorMessage(data []byte) string {
+	var payload struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+
+	if err := json.Unmarshal(data, &payload); err == nil {
+		if payload.Message != "" {
+			return payload.Message
+		}
+
+		if payload.Error != "" {
+			return payload.Error
+		}
+	}
+
+	message := strings.TrimSpace(string(data))
+
+	if len(message) > 200 {
+		message = message[:200]
+	}
+
+	return message
+}
+
+func isNotFound(err error) bool {
+	var statusErr *StatusError
+
+	return errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound
+}
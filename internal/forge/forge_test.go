@@ -0,0 +1,417 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+type response struct {
+	status int
+	body   string
+}
+
+type request struct {
+	route  string
+	header http.Header
+	body   map[string]any
+}
+
+type fakeForge struct {
+	t         *testing.T
+	mu        sync.Mutex
+	responses map[string][]response
+	requests  []request
+}
+
+func newFakeForge(t *testing.T, responses map[string][]response) (*fakeForge, *httptest.Server) {
+	f := &fakeForge{t: t, responses: responses}
+	server := httptest.NewServer(f)
+
+	t.Cleanup(server.Close)
+
+	return f, server
+}
+
+func (f *fakeForge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	route := r.Method + " " + r.URL.EscapedPath()
+
+	var body map[string]any
+
+	if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			f.t.Errorf("%s: decode body: %v", route, err)
+		}
+	}
+
+	f.requests = append(f.requests, request{route: route, header: r.Header.Clone(), body: body})
+
+	queue := f.responses[route]
+	if len(queue) == 0 {
+		f.t.Errorf("unexpected request %s", route)
+		http.NotFound(w, r)
+
+		return
+	}
+
+	f.responses[route] = queue[1:]
+
+	w.WriteHeader(queue[0].status)
+	io.WriteString(w, queue[0].body)
+}
+
+func (f *fakeForge) routes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	routes := make([]string, len(f.requests))
+
+	for i, req := range f.requests {
+		routes[i] = req.route
+	}
+
+	return routes
+}
+
+func (f *fakeForge) last() request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests[len(f.requests)-1]
+}
+
+func ensureOne(t *testing.T, forgeType, baseURL, owner string) Outcome {
+	t.Helper()
+
+	private := true
+	cfg := config.Config{
+		Remotes: map[string]config.RemoteDefinition{
+			"forge": {
+				URL: "https://forge.example/${user}/${repo}.git",
+				API: &config.APIDefinition{Type: forgeType, BaseURL: baseURL, Token: "tok"},
+			},
+		},
+		Repos: map[string]config.Repo{
+			"ebisu/demo": {
+				Targets:  map[string]config.Target{"forge": {User: owner, Repo: "demo"}},
+				Metadata: config.Metadata{Description: "A demo", Private: &private},
+			},
+		},
+	}
+
+	outcomes := EnsureRepos(context.Background(), cfg, map[string][]string{"ebisu/demo": {"forge"}}, nil)
+	if len(outcomes) != 1 {
+		t.Fatalf("EnsureRepos() = %+v, want one outcome", outcomes)
+	}
+
+	return outcomes[0]
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		forgeType  string
+		owner      string
+		responses  map[string][]response
+		authHeader string
+		auth       string
+		routes     []string
+		body       map[string]any
+	}{
+		{
+			name:      "github user",
+			forgeType: "github",
+			owner:     "ebisu",
+			responses: map[string][]response{
+				"GET /repos/ebisu/demo": {{404, `{"message":"Not Found"}`}},
+				"GET /user":             {{200, `{"login":"ebisu"}`}},
+				"POST /user/repos":      {{201, `{}`}},
+			},
+			authHeader: "Authorization",
+			auth:       "Bearer tok",
+			routes:     []string{"GET /repos/ebisu/demo", "GET /user", "POST /user/repos"},
+			body:       map[string]any{"name": "demo", "description": "A demo", "private": true},
+		},
+		{
+			name:      "github organisation",
+			forgeType: "github",
+			owner:     "acme",
+			responses: map[string][]response{
+				"GET /repos/acme/demo":  {{404, `{}`}},
+				"GET /user":             {{200, `{"login":"ebisu"}`}},
+				"POST /orgs/acme/repos": {{201, `{}`}},
+			},
+			authHeader: "Authorization",
+			auth:       "Bearer tok",
+			routes:     []string{"GET /repos/acme/demo", "GET /user", "POST /orgs/acme/repos"},
+			body:       map[string]any{"name": "demo", "description": "A demo", "private": true},
+		},
+		{
+			name:      "gitea",
+			forgeType: "gitea",
+			owner:     "ebisu",
+			responses: map[string][]response{
+				"GET /api/v1/repos/ebisu/demo": {{404, `{}`}},
+				"GET /api/v1/user":             {{200, `{"login":"ebisu"}`}},
+				"POST /api/v1/user/repos":      {{201, `{}`}},
+			},
+			authHeader: "Authorization",
+			auth:       "token tok",
+			routes:     []string{"GET /api/v1/repos/ebisu/demo", "GET /api/v1/user", "POST /api/v1/user/repos"},
+			body:       map[string]any{"name": "demo", "description": "A demo", "private": true},
+		},
+		{
+			name:      "forgejo organisation",
+			forgeType: "forgejo",
+			owner:     "acme",
+			responses: map[string][]response{
+				"GET /api/v1/repos/acme/demo":  {{404, `{}`}},
+				"GET /api/v1/user":             {{200, `{"login":"ebisu"}`}},
+				"POST /api/v1/orgs/acme/repos": {{201, `{}`}},
+			},
+			authHeader: "Authorization",
+			auth:       "token tok",
+			routes:     []string{"GET /api/v1/repos/acme/demo", "GET /api/v1/user", "POST /api/v1/orgs/acme/repos"},
+			body:       map[string]any{"name": "demo", "description": "A demo", "private": true},
+		},
+		{
+			name:      "gitlab user",
+			forgeType: "gitlab",
+			owner:     "ebisu",
+			responses: map[string][]response{
+				"GET /api/v4/projects/ebisu%2Fdemo": {{404, `{"message":"404 Project Not Found"}`}},
+				"GET /api/v4/user":                  {{200, `{"username":"ebisu"}`}},
+				"POST /api/v4/projects":             {{201, `{}`}},
+			},
+			authHeader: "PRIVATE-TOKEN",
+			auth:       "tok",
+			routes:     []string{"GET /api/v4/projects/ebisu%2Fdemo", "GET /api/v4/user", "POST /api/v4/projects"},
+			body:       map[string]any{"name": "demo", "path": "demo", "description": "A demo", "visibility": "private"},
+		},
+		{
+			name:      "gitlab group",
+			forgeType: "gitlab",
+			owner:     "acme",
+			responses: map[string][]response{
+				"GET /api/v4/projects/acme%2Fdemo": {{404, `{}`}},
+				"GET /api/v4/user":                 {{200, `{"username":"ebisu"}`}},
+				"GET /api/v4/namespaces/acme":      {{200, `{"id":7}`}},
+				"POST /api/v4/projects":            {{201, `{}`}},
+			},
+			authHeader: "PRIVATE-TOKEN",
+			auth:       "tok",
+			routes:     []string{"GET /api/v4/projects/acme%2Fdemo", "GET /api/v4/user", "GET /api/v4/namespaces/acme", "POST /api/v4/projects"},
+			body:       map[string]any{"name": "demo", "path": "demo", "description": "A demo", "visibility": "private", "namespace_id": float64(7)},
+		},
+		{
+			name:      "sourcehut",
+			forgeType: "sourcehut",
+			owner:     "~ebisu",
+			responses: map[string][]response{
+				"POST /query": {
+					{200, `{"data":{"user":{"repository":null}}}`},
+					{200, `{"data":{"createRepository":{"id":1}}}`},
+				},
+			},
+			authHeader: "Authorization",
+			auth:       "Bearer tok",
+			routes:     []string{"POST /query", "POST /query"},
+			body:       map[string]any{"name": "demo", "visibility": "PRIVATE", "description": "A demo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeForge(t, tt.responses)
+
+			outcome := ensureOne(t, tt.forgeType, server.URL, tt.owner)
+			if outcome.Error != nil {
+				t.Fatalf("EnsureRepos() error = %v", outcome.Error)
+			}
+
+			if !outcome.Created {
+				t.Error("Created = false, want true")
+			}
+
+			if got := fake.routes(); strings.Join(got, ", ") != strings.Join(tt.routes, ", ") {
+				t.Errorf("requests = %q, want %q", got, tt.routes)
+			}
+
+			last := fake.last()
+
+			if got := last.header.Get(tt.authHeader); got != tt.auth {
+				t.Errorf("%s = %q, want %q", tt.authHeader, got, tt.auth)
+			}
+
+			if got := last.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+
+			body := last.body
+			if tt.forgeType == "sourcehut" {
+				if query, _ := body["query"].(string); !strings.Contains(query, "createRepository") {
+					t.Errorf("query = %q, want createRepository mutation", query)
+				}
+
+				body, _ = body["variables"].(map[string]any)
+			}
+
+			for key, want := range tt.body {
+				if got := body[key]; got != want {
+					t.Errorf("body[%s] = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAlreadyExists(t *testing.T) {
+	tests := []struct {
+		forgeType string
+		owner     string
+		route     string
+		body      string
+	}{
+		{"github", "ebisu", "GET /repos/ebisu/demo", `{"name":"demo"}`},
+		{"gitea", "ebisu", "GET /api/v1/repos/ebisu/demo", `{"name":"demo"}`},
+		{"gitlab", "ebisu", "GET /api/v4/projects/ebisu%2Fdemo", `{"id":1}`},
+		{"sourcehut", "~ebisu", "POST /query", `{"data":{"user":{"repository":{"id":1}}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.forgeType, func(t *testing.T) {
+			fake, server := newFakeForge(t, map[string][]response{tt.route: {{200, tt.body}}})
+
+			outcome := ensureOne(t, tt.forgeType, server.URL, tt.owner)
+			if outcome.Error != nil {
+				t.Fatalf("EnsureRepos() error = %v", outcome.Error)
+			}
+
+			if outcome.Created {
+				t.Error("Created = true, want false for an existing repository")
+			}
+
+			if got := fake.routes(); len(got) != 1 {
+				t.Errorf("requests = %q, want only the existence check", got)
+			}
+		})
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		forgeType string
+		owner     string
+		responses map[string][]response
+		status    int
+		message   string
+	}{
+		{
+			name:      "github name taken",
+			forgeType: "github",
+			owner:     "ebisu",
+			responses: map[string][]response{
+				"GET /repos/ebisu/demo": {{404, `{}`}},
+				"GET /user":             {{200, `{"login":"ebisu"}`}},
+				"POST /user/repos":      {{422, `{"message":"Repository creation failed."}`}},
+			},
+			status:  422,
+			message: "Repository creation failed.",
+		},
+		{
+			name:      "gitea conflict",
+			forgeType: "gitea",
+			owner:     "ebisu",
+			responses: map[string][]response{
+				"GET /api/v1/repos/ebisu/demo": {{404, `{}`}},
+				"GET /api/v1/user":             {{200, `{"login":"ebisu"}`}},
+				"POST /api/v1/user/repos":      {{409, `{"message":"The repository with the same name already exists."}`}},
+			},
+			status:  409,
+			message: "The repository with the same name already exists.",
+		},
+		{
+			name:      "gitlab unauthorised",
+			forgeType: "gitlab",
+			owner:     "ebisu",
+			responses: map[string][]response{
+				"GET /api/v4/projects/ebisu%2Fdemo": {{401, `{"error":"invalid_token"}`}},
+			},
+			status:  401,
+			message: "invalid_token",
+		},
+		{
+			name:      "gitlab plain text",
+			forgeType: "gitlab",
+			owner:     "ebisu",
+			responses: map[string][]response{
+				"GET /api/v4/projects/ebisu%2Fdemo": {{404, `{}`}},
+				"GET /api/v4/user":                  {{200, `{"username":"ebisu"}`}},
+				"POST /api/v4/projects":             {{400, `{"message":{"name":["has already been taken"]}}`}},
+			},
+			status:  400,
+			message: `{"message":{"name":["has already been taken"]}}`,
+		},
+		{
+			name:      "sourcehut graphql",
+			forgeType: "sourcehut",
+			owner:     "~ebisu",
+			responses: map[string][]response{
+				"POST /query": {
+					{200, `{"data":{"user":{"repository":null}}}`},
+					{200, `{"errors":[{"message":"A repository with this name already exists."}]}`},
+				},
+			},
+			message: "sourcehut: A repository with this name already exists.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newFakeForge(t, tt.responses)
+
+			outcome := ensureOne(t, tt.forgeType, server.URL, tt.owner)
+			if outcome.Error == nil {
+				t.Fatal("EnsureRepos() error = nil, want error")
+			}
+
+			if outcome.Created {
+				t.Error("Created = true, want false")
+			}
+
+			var statusErr *StatusError
+
+			if tt.status == 0 {
+				if errors.As(outcome.Error, &statusErr) {
+					t.Errorf("error = %#v, want a non-HTTP error", statusErr)
+				}
+
+				if outcome.Error.Error() != tt.message {
+					t.Errorf("error = %q, want %q", outcome.Error, tt.message)
+				}
+
+				return
+			}
+
+			if !errors.As(outcome.Error, &statusErr) {
+				t.Fatalf("error = %v, want *StatusError", outcome.Error)
+			}
+
+			if statusErr.Status != tt.status || statusErr.Message != tt.message {
+				t.Errorf("StatusError = %d %q, want %d %q", statusErr.Status, statusErr.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
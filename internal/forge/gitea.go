@@ -0,0 +1,124 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+type gitea struct {
+	api   *api
+	login string
+}
+
+func (g *gitea) Exists(ctx context.Context, owner, name string) (bool, error) {
+	err := g.api.do(ctx, http.MethodGet, "/repos/"+url.PathEscape(owner)+"/"+url.PathEscape(name), nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (g *gitea) Create(ctx context.Context, repo Repository) error {
+	login, err := g.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	path := "/user/repos"
+
+	if repo.Owner != login {
+		path = "/orgs/" + url.PathEscape(repo.Owner) + "/repos"
+	}
+
+	return g.api.do(ctx, http.MethodPost, path, map[string]any{
+		"name":        repo.Name,
+		"description": repo.Description,
+		"private":     isPrivate(repo.Metadata),
+	}, nil)
+}
+
+func (g *gitea) currentUser(ctx context.Context) (string, error) {
+	if g.login != "" {
+		return g.login, nil
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+
+	if err := g.api.do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+
+	g.login = user.Login
+
+	return g.login, nil
+}
+
+func (g *gitea) MetadataFields() []string {
+	return []string{FieldDescription, FieldHomepage, FieldTopics, FieldPrivate}
+}
+
+func (g *gitea) Metadata(ctx context.Context, owner, name string) (config.Metadata, error) {
+	path := "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+
+	var repo struct {
+		Description string `json:"description"`
+		Website     string `json:"website"`
+		Private     bool   `json:"private"`
+	}
+
+	if err := g.api.do(ctx, http.MethodGet, path, nil, &repo); err != nil {
+		return config.Metadata{}, err
+	}
+
+	var topics struct {
+		Topics []string `json:"topics"`
+	}
+
+	if err := g.api.do(ctx, http.MethodGet, path+"/topics", nil, &topics); err != nil {
+		return config.Metadata{}, err
+	}
+
+	return config.Metadata{
+		Description: repo.Description,
+		Homepage:    repo.Website,
+		Topics:      topics.Topics,
+		Private:     &repo.Private,
+	}, nil
+}
+
+func (g *gitea) UpdateMetadata(ctx context.Context, repo Repository) error {
+	path := "/repos/" + url.PathEscape(repo.Owner) + "/" + url.PathEscape(repo.Name)
+
+	if body := metadataBody(repo.Metadata, "website"); len(body) > 0 {
+		if err := g.api.do(ctx, http.MethodPatch, path, body, nil); err != nil {
+			return err
+		}
+	}
+
+	if repo.Topics == nil {
+		return nil
+	}
+
+	return g.api.do(ctx, http.MethodPut, path+"/topics", map[string]any{"topics": repo.Topics}, nil)
+}
+
+func (g *gitea) List(ctx context.Context, owner string) ([]Listing, error) {
+	return listPages(func(page int) ([]Listing, error) {
+		var data json.RawMessage
+
+		path := fmt.Sprintf("/users/%s/repos?limit=50&page=%d", url.PathEscape(owner), page)
+		if err := g.api.do(ctx, http.MethodGet, path, nil, &data); err != nil {
+			return nil, err
+		}
+
+		return decodeRepoListing(owner, data)
+	})
+}
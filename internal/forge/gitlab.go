@@ -0,0 +1,151 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+type gitlab struct {
+	api      *api
+	username string
+}
+
+func projectPath(owner, name string) string {
+	return "/projects/" + url.PathEscape(owner+"/"+name)
+}
+
+func (g *gitlab) Exists(ctx context.Context, owner, name string) (bool, error) {
+	err := g.api.do(ctx, http.MethodGet, projectPath(owner, name), nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (g *gitlab) Create(ctx context.Context, repo Repository) error {
+	username, err := g.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]any{
+		"name":        repo.Name,
+		"path":        repo.Name,
+		"description": repo.Description,
+		"visibility":  visibility(isPrivate(repo.Metadata)),
+	}
+
+	if repo.Owner != username {
+		var namespace struct {
+			ID int `json:"id"`
+		}
+
+		if err := g.api.do(ctx, http.MethodGet, "/namespaces/"+url.PathEscape(repo.Owner), nil, &namespace); err != nil {
+			return err
+		}
+
+		body["namespace_id"] = namespace.ID
+	}
+
+	return g.api.do(ctx, http.MethodPost, "/projects", body, nil)
+}
+
+func (g *gitlab) currentUser(ctx context.Context) (string, error) {
+	if g.username != "" {
+		return g.username, nil
+	}
+
+	var user struct {
+		Username string `json:"username"`
+	}
+
+	if err := g.api.do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+
+	g.username = user.Username
+
+	return g.username, nil
+}
+
+func visibility(private bool) string {
+	if private {
+		return "private"
+	}
+
+	return "public"
+}
+
+func (g *gitlab) MetadataFields() []string {
+	return []string{FieldDescription, FieldTopics, FieldPrivate}
+}
+
+func (g *gitlab) Metadata(ctx context.Context, owner, name string) (config.Metadata, error) {
+	var project struct {
+		Description string   `json:"description"`
+		Topics      []string `json:"topics"`
+		Visibility  string   `json:"visibility"`
+	}
+
+	if err := g.api.do(ctx, http.MethodGet, projectPath(owner, name), nil, &project); err != nil {
+		return config.Metadata{}, err
+	}
+
+	private := project.Visibility != "public"
+
+	return config.Metadata{
+		Description: project.Description,
+		Topics:      project.Topics,
+		Private:     &private,
+	}, nil
+}
+
+func (g *gitlab) UpdateMetadata(ctx context.Context, repo Repository) error {
+	body := map[string]any{}
+
+	if repo.Description != "" {
+		body["description"] = repo.Description
+	}
+
+	if repo.Topics != nil {
+		body["topics"] = repo.Topics
+	}
+
+	if repo.Private != nil {
+		body["visibility"] = visibility(*repo.Private)
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	return g.api.do(ctx, http.MethodPut, projectPath(repo.Owner, repo.Name), body, nil)
+}
+
+func (g *gitlab) List(ctx context.Context, owner string) ([]Listing, error) {
+	collection := "/groups/"
+
+	return listPages(func(page int) ([]Listing, error) {
+		var data json.RawMessage
+
+		query := fmt.Sprintf("/projects?per_page=100&page=%d", page)
+
+		err := g.api.do(ctx, http.MethodGet, collection+url.PathEscape(owner)+query, nil, &data)
+		if isNotFound(err) && page == 1 && collection == "/groups/" {
+			collection = "/users/"
+			err = g.api.do(ctx, http.MethodGet, collection+url.PathEscape(owner)+query, nil, &data)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeProjectListing(data)
+	})
+}
@@ -0,0 +1,306 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/giturl"
+)
+
+type Listing struct {
+	Owner       string
+	Name        string
+	Description string
+	Language    string
+	Fork        bool
+	Archived    bool
+	Private     bool
+	CloneURL    string
+}
+
+func (l Listing) FullName() string {
+	return l.Owner + "/" + l.Name
+}
+
+type ListFilter struct {
+	Archived bool
+	Forks    bool
+	Language string
+}
+
+func (f ListFilter) Match(listing Listing) bool {
+	if listing.Archived && !f.Archived {
+		return false
+	}
+
+	if listing.Fork && !f.Forks {
+		return false
+	}
+
+	return f.Language == "" || strings.EqualFold(listing.Language, f.Language)
+}
+
+type Source struct {
+	Kind   string
+	Owner  string
+	Remote string
+	API    config.RemoteDefinition
+}
+
+var defaultHosts = map[string]string{
+	"github":    "github.com",
+	"gitlab":    "gitlab.com",
+	"sourcehut": "git.sr.ht",
+}
+
+func ParseSource(spec string, cfg config.Config) (Source, error) {
+	kind, rest, ok := strings.Cut(spec, ":")
+	if !ok || rest == "" {
+		return Source{}, fmt.Errorf("invalid source (expected <forge>:<owner> or <forge>:<url>): %s", spec)
+	}
+
+	name := cfg.ResolveAlias(kind)
+
+	if def, ok := cfg.Remotes[name]; ok && def.API != nil {
+		return Source{Kind: def.API.Type, Owner: strings.TrimPrefix(strings.Trim(rest, "/"), "~"), Remote: name, API: def}, nil
+	}
+
+	source := Source{Kind: kind, API: config.RemoteDefinition{API: &config.APIDefinition{Type: kind}}}
+	host := defaultHosts[kind]
+
+	switch kind {
+	case "github", "gitea", "forgejo", "gitlab", "sourcehut":
+	default:
+		return Source{}, fmt.Errorf("%w: %s", ErrUnsupported, kind)
+	}
+
+	if strings.Contains(rest, "://") {
+		parsed, err := giturl.Parse(rest)
+		if err != nil {
+			return Source{}, err
+		}
+
+		base := parsed.Scheme + "://" + parsed.Endpoint()
+		host = parsed.Host
+
+		switch {
+		case kind != "github":
+			source.API.API.BaseURL = base
+		case parsed.Host != "github.com":
+			source.API.API.BaseURL = base + "/api/v3"
+		}
+
+		rest = parsed.RepoPath()
+	} else if kind == "gitea" || kind == "forgejo" {
+		return Source{}, fmt.Errorf("%s sources need an instance URL, e.g. %s:https://git.example.com/owner", kind, kind)
+	}
+
+	source.Owner = strings.TrimPrefix(strings.Trim(rest, "/"), "~")
+
+	if source.Owner == "" {
+		return Source{}, fmt.Errorf("source has no owner: %s", spec)
+	}
+
+	source.API.API.Token = matchingToken(cfg, *source.API.API)
+	source.Remote = matchingRemote(cfg, host)
+
+	return source, nil
+}
+
+func matchingRemote(cfg config.Config, host string) string {
+	names := append(slices.Clone(cfg.Defaults.Remotes), slices.Sorted(maps.Keys(cfg.Remotes))...)
+
+	for _, name := range names {
+		if def, ok := cfg.Remotes[name]; ok && strings.EqualFold(giturl.TemplateHost(def.URL), host) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func (s Source) ReportsLanguage() bool {
+	return s.Kind == "github" || s.Kind == "gitea" || s.Kind == "forgejo"
+}
+
+func matchingToken(cfg config.Config, api config.APIDefinition) string {
+	for _, def := range cfg.Remotes {
+		if def.API != nil && def.API.Type == api.Type && strings.TrimSuffix(def.API.BaseURL, "/") == api.BaseURL {
+			return def.API.Token
+		}
+	}
+
+	return ""
+}
+
+func (s Source) List(ctx context.Context, httpClient *http.Client) ([]Listing, error) {
+	client, err := New(s.API, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.List(ctx, s.Owner)
+}
+
+func (s Source) Decode(data []byte) ([]Listing, error) {
+	switch s.Kind {
+	case "github", "gitea", "forgejo":
+		return decodeRepoListing(s.Owner, data)
+	case "gitlab":
+		return decodeProjectListing(data)
+	case "sourcehut":
+		base := strings.TrimSuffix(s.API.API.BaseURL, "/")
+		if base == "" {
+			base = "https://git.sr.ht"
+		}
+
+		listings, _, err := decodeSourcehutListing(base, s.Owner, data)
+
+		return listings, err
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, s.Kind)
+	}
+}
+
+func listPages(fetch func(page int) ([]Listing, error)) ([]Listing, error) {
+	var listings []Listing
+
+	for page := 1; ; page++ {
+		batch, err := fetch(page)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(batch) == 0 {
+			return listings, nil
+		}
+
+		listings = append(listings, batch...)
+	}
+}
+
+func decodeRepoListing(owner string, data []byte) ([]Listing, error) {
+	var repos []struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+		Description string `json:"description"`
+		Language    string `json:"language"`
+		Fork        bool   `json:"fork"`
+		Archived    bool   `json:"archived"`
+		Private     bool   `json:"private"`
+		CloneURL    string `json:"clone_url"`
+	}
+
+	if err := json.Unmarshal(data, &repos); err != nil {
+		return nil, err
+	}
+
+	listings := make([]Listing, len(repos))
+
+	for i, repo := range repos {
+		listings[i] = Listing{
+			Owner:       repo.Owner.Login,
+			Name:        repo.Name,
+			Description: repo.Description,
+			Language:    repo.Language,
+			Fork:        repo.Fork,
+			Archived:    repo.Archived,
+			Private:     repo.Private,
+			CloneURL:    repo.CloneURL,
+		}
+
+		if listings[i].Owner == "" {
+			listings[i].Owner = owner
+		}
+	}
+
+	return listings, nil
+}
+
+func decodeProjectListing(data []byte) ([]Listing, error) {
+	var projects []struct {
+		Path      string `json:"path"`
+		Namespace struct {
+			FullPath string `json:"full_path"`
+		} `json:"namespace"`
+		Description       string          `json:"description"`
+		Archived          bool            `json:"archived"`
+		Visibility        string          `json:"visibility"`
+		ForkedFromProject json.RawMessage `json:"forked_from_project"`
+		HTTPURLToRepo     string          `json:"http_url_to_repo"`
+	}
+
+	if err := json.Unmarshal(data, &projects); err != nil {
+		return nil, err
+	}
+
+	listings := make([]Listing, len(projects))
+
+	for i, project := range projects {
+		listings[i] = Listing{
+			Owner:       project.Namespace.FullPath,
+			Name:        project.Path,
+			Description: project.Description,
+			Fork:        len(project.ForkedFromProject) > 0 && string(project.ForkedFromProject) != "null",
+			Archived:    project.Archived,
+			Private:     project.Visibility != "public",
+			CloneURL:    project.HTTPURLToRepo,
+		}
+	}
+
+	return listings, nil
+}
+
+func decodeSourcehutListing(base, owner string, data []byte) ([]Listing, string, error) {
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	if err := json.Unmarshal(data, &envelope); err == nil && len(envelope.Data) > 0 {
+		data = envelope.Data
+	}
+
+	var page struct {
+		User *struct {
+			Repositories struct {
+				Results []struct {
+					Name        string `json:"name"`
+					Description string `json:"description"`
+					Visibility  string `json:"visibility"`
+				} `json:"results"`
+				Cursor string `json:"cursor"`
+			} `json:"repositories"`
+		} `json:"user"`
+	}
+
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, "", err
+	}
+
+	if page.User == nil {
+		return nil, "", fmt.Errorf("sourcehut: user not found: %s", owner)
+	}
+
+	results := page.User.Repositories.Results
+	listings := make([]Listing, len(results))
+
+	for i, repo := range results {
+		listings[i] = Listing{
+			Owner:       owner,
+			Name:        repo.Name,
+			Description: repo.Description,
+			Private:     repo.Visibility != "PUBLIC",
+			CloneURL:    base + "/~" + owner + "/" + repo.Name,
+		}
+	}
+
+	return listings, page.User.Repositories.Cursor, nil
+}
@@ -0,0 +1,142 @@
+package forge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+func TestDecodeListings(t *testing.T) {
+	tests := []struct {
+		name   string
+		source Source
+		data   string
+		want   []Listing
+	}{
+		{
+			name:   "github",
+			source: Source{Kind: "github", Owner: "ebisu"},
+			data:   `[{"name":"tool","owner":{"login":"ebisu"},"description":"A tool","language":"Go","fork":true,"archived":false,"private":true,"clone_url":"https://github.com/ebisu/tool.git"}]`,
+			want:   []Listing{{Owner: "ebisu", Name: "tool", Description: "A tool", Language: "Go", Fork: true, Private: true, CloneURL: "https://github.com/ebisu/tool.git"}},
+		},
+		{
+			name:   "gitea without owner",
+			source: Source{Kind: "gitea", Owner: "org"},
+			data:   `[{"name":"service","archived":true,"clone_url":"https://git.example.com/org/service.git"}]`,
+			want:   []Listing{{Owner: "org", Name: "service", Archived: true, CloneURL: "https://git.example.com/org/service.git"}},
+		},
+		{
+			name:   "gitlab nested group",
+			source: Source{Kind: "gitlab", Owner: "group"},
+			data:   `[{"path":"proj","namespace":{"full_path":"group/subgroup"},"visibility":"public","forked_from_project":{"id":1},"http_url_to_repo":"https://gitlab.com/group/subgroup/proj.git"},{"path":"own","namespace":{"full_path":"group"},"visibility":"private","forked_from_project":null}]`,
+			want: []Listing{
+				{Owner: "group/subgroup", Name: "proj", Fork: true, CloneURL: "https://gitlab.com/group/subgroup/proj.git"},
+				{Owner: "group", Name: "own", Private: true},
+			},
+		},
+		{
+			name:   "sourcehut",
+			source: Source{Kind: "sourcehut", Owner: "ebisu", API: config.RemoteDefinition{API: &config.APIDefinition{Type: "sourcehut"}}},
+			data:   `{"data":{"user":{"repositories":{"results":[{"name":"tool","description":"A tool","visibility":"UNLISTED"}],"cursor":null}}}}`,
+			want:   []Listing{{Owner: "ebisu", Name: "tool", Description: "A tool", Private: true, CloneURL: "https://git.sr.ht/~ebisu/tool"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.Decode([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSourcehutUnknownUser(t *testing.T) {
+	source := Source{Kind: "sourcehut", Owner: "nobody", API: config.RemoteDefinition{API: &config.APIDefinition{Type: "sourcehut"}}}
+
+	if _, err := source.Decode([]byte(`{"data":{"user":null}}`)); err == nil || !strings.Contains(err.Error(), "user not found") {
+		t.Errorf("Decode() error = %v, want user not found", err)
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  ListFilter
+		listing Listing
+		want    bool
+	}{
+		{"plain", ListFilter{}, Listing{Language: "Go"}, true},
+		{"archived hidden", ListFilter{}, Listing{Archived: true}, false},
+		{"archived shown", ListFilter{Archived: true}, Listing{Archived: true}, true},
+		{"fork hidden", ListFilter{}, Listing{Fork: true}, false},
+		{"fork shown", ListFilter{Forks: true}, Listing{Fork: true}, true},
+		{"language matches", ListFilter{Language: "go"}, Listing{Language: "Go"}, true},
+		{"language differs", ListFilter{Language: "go"}, Listing{Language: "Rust"}, false},
+		{"language unknown", ListFilter{Language: "go"}, Listing{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Match(tt.listing); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	cfg := config.Config{
+		Remotes: map[string]config.RemoteDefinition{
+			"github":   {URL: "git@github.com:${user}/${repo}.git"},
+			"codeberg": {URL: "git@codeberg.org:${user}/${repo}.git", API: &config.APIDefinition{Type: "gitea", BaseURL: "https://codeberg.org", Token: "secret"}},
+			"work":     {URL: "git@git.example.com:${user}/${repo}.git", API: &config.APIDefinition{Type: "gitea", BaseURL: "https://git.example.com", Token: "work-token"}},
+		},
+		Defaults: config.Defaults{Remotes: []string{"github"}},
+	}
+
+	tests := []struct {
+		spec    string
+		kind    string
+		owner   string
+		remote  string
+		baseURL string
+		token   string
+	}{
+		{spec: "github:ebisu", kind: "github", owner: "ebisu", remote: "github"},
+		{spec: "codeberg:ebisu", kind: "gitea", owner: "ebisu", remote: "codeberg", baseURL: "https://codeberg.org", token: "secret"},
+		{spec: "gitea:https://git.example.com/org", kind: "gitea", owner: "org", remote: "work", baseURL: "https://git.example.com", token: "work-token"},
+		{spec: "forgejo:https://forge.example.net/org/", kind: "forgejo", owner: "org", baseURL: "https://forge.example.net"},
+		{spec: "github:https://ghe.example.com/team", kind: "github", owner: "team", baseURL: "https://ghe.example.com/api/v3"},
+		{spec: "gitlab:group/subgroup", kind: "gitlab", owner: "group/subgroup"},
+		{spec: "sourcehut:~ebisu", kind: "sourcehut", owner: "ebisu"},
+	}
+
+	for _, tt := range tests {
+		source, err := ParseSource(tt.spec, cfg)
+		if err != nil {
+			t.Errorf("ParseSource(%s) error = %v", tt.spec, err)
+
+			continue
+		}
+
+		if source.Kind != tt.kind || source.Owner != tt.owner || source.Remote != tt.remote {
+			t.Errorf("ParseSource(%s) = %s %s %s, want %s %s %s", tt.spec, source.Kind, source.Owner, source.Remote, tt.kind, tt.owner, tt.remote)
+		}
+
+		if api := source.API.API; api.BaseURL != tt.baseURL || api.Token != tt.token {
+			t.Errorf("ParseSource(%s) api = %s %s, want %s %s", tt.spec, api.BaseURL, api.Token, tt.baseURL, tt.token)
+		}
+	}
+
+	for _, spec := range []string{"github", "github:", "bitbucket:ebisu", "gitea:org", "gitlab:/"} {
+		if _, err := ParseSource(spec, cfg); err == nil {
+			t.Errorf("ParseSource(%s) succeeded", spec)
+		}
+	}
+}
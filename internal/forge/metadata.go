@@ -0,0 +1,183 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+const (
+	FieldDescription = "description"
+	FieldHomepage    = "homepage"
+	FieldTopics      = "topics"
+	FieldPrivate     = "private"
+)
+
+type Change struct {
+	Field string
+	From  string
+	To    string
+}
+
+type MetadataPlan struct {
+	Repo    string
+	Remote  string
+	Changes []Change
+	Error   error
+
+	client Client
+	update Repository
+}
+
+func (p MetadataPlan) Apply(ctx context.Context) error {
+	if p.Error != nil || len(p.Changes) == 0 {
+		return p.Error
+	}
+
+	return p.client.UpdateMetadata(ctx, p.update)
+}
+
+func PlanMetadata(ctx context.Context, cfg config.Config, repoNames []string, httpClient *http.Client) []MetadataPlan {
+	var plans []MetadataPlan
+
+	clients := make(map[string]Client)
+
+	for _, repoName := range repoNames {
+		repo := cfg.Repos[repoName]
+
+		for _, remoteName := range APIRemotes(cfg, repo) {
+			target, ok := repo.Targets[remoteName]
+			if !ok {
+				continue
+			}
+
+			plan := MetadataPlan{Repo: repoName, Remote: remoteName}
+
+			client, ok := clients[remoteName]
+			if !ok {
+				var err error
+
+				client, err = New(cfg.Remotes[remoteName], httpClient)
+				if err != nil {
+					plan.Error = err
+					plans = append(plans, plan)
+
+					continue
+				}
+
+				clients[remoteName] = client
+			}
+
+			current, err := client.Metadata(ctx, target.User, target.Repo)
+			if err != nil {
+				plan.Error = err
+				plans = append(plans, plan)
+
+				continue
+			}
+
+			plan.client = client
+			plan.update = Repository{Owner: target.User, Name: target.Repo}
+			plan.Changes = diffMetadata(current, repo.Metadata, client.MetadataFields(), &plan.update.Metadata)
+
+			plans = append(plans, plan)
+		}
+	}
+
+	return plans
+}
+
+func FetchMetadata(ctx context.Context, cfg config.Config, repoName, remoteName string, httpClient *http.Client) (config.Metadata, []string, error) {
+	repo := cfg.Repos[repoName]
+
+	def, ok := cfg.Remotes[remoteName]
+	if !ok || def.API == nil {
+		return config.Metadata{}, nil, fmt.Errorf("remote has no api definition: %s", remoteName)
+	}
+
+	target, ok := repo.Targets[remoteName]
+	if !ok {
+		return config.Metadata{}, nil, fmt.Errorf("%s does not use remote: %s", repoName, remoteName)
+	}
+
+	client, err := New(def, httpClient)
+	if err != nil {
+		return config.Metadata{}, nil, err
+	}
+
+	metadata, err := client.Metadata(ctx, target.User, target.Repo)
+	if err != nil {
+		return config.Metadata{}, nil, err
+	}
+
+	return metadata, client.MetadataFields(), nil
+}
+
+func diffMetadata(current, desired config.Metadata, fields []string, update *config.Metadata) []Change {
+	var changes []Change
+
+	for _, field := range fields {
+		switch field {
+		case FieldDescription:
+			if desired.Description != "" && desired.Description != current.Description {
+				changes = append(changes, Change{Field: field, From: current.Description, To: desired.Description})
+				update.Description = desired.Description
+			}
+		case FieldHomepage:
+			if desired.Homepage != "" && desired.Homepage != current.Homepage {
+				changes = append(changes, Change{Field: field, From: current.Homepage, To: desired.Homepage})
+				update.Homepage = desired.Homepage
+			}
+		case FieldTopics:
+			if desired.Topics != nil && !sameTopics(desired.Topics, current.Topics) {
+				changes = append(changes, Change{
+					Field: field,
+					From:  strings.Join(current.Topics, ", "),
+					To:    strings.Join(desired.Topics, ", "),
+				})
+				update.Topics = desired.Topics
+			}
+		case FieldPrivate:
+			if desired.Private != nil && (current.Private == nil || *current.Private != *desired.Private) {
+				changes = append(changes, Change{
+					Field: field,
+					From:  strconv.FormatBool(isPrivate(current)),
+					To:    strconv.FormatBool(*desired.Private),
+				})
+				update.Private = desired.Private
+			}
+		}
+	}
+
+	return changes
+}
+
+func sameTopics(a, b []string) bool {
+	a = slices.Sorted(slices.Values(a))
+	b = slices.Sorted(slices.Values(b))
+
+	return slices.Equal(a, b)
+}
+
+func metadataBody(metadata config.Metadata, homepageKey string) map[string]any {
+	body := map[string]any{}
+
+	if metadata.Description != "" {
+		body["description"] = metadata.Description
+	}
+
+	if metadata.Homepage != "" {
+		body[homepageKey] = metadata.Homepage
+	}
+
+	if metadata.Private != nil {
+		body["private"] = *metadata.Private
+	}
+
+	return body
+}
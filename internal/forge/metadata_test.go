@@ -0,0 +1,145 @@
+package forge
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+func TestDiffMetadata(t *testing.T) {
+	public, private := false, true
+	allFields := []string{FieldDescription, FieldHomepage, FieldTopics, FieldPrivate}
+
+	tests := []struct {
+		name    string
+		current config.Metadata
+		desired config.Metadata
+		fields  []string
+		changes []Change
+		update  config.Metadata
+	}{
+		{
+			name:    "in step",
+			current: config.Metadata{Description: "A tool", Topics: []string{"go", "cli"}, Private: &public},
+			desired: config.Metadata{Description: "A tool", Topics: []string{"cli", "go"}, Private: &public},
+			fields:  allFields,
+		},
+		{
+			name:    "unset fields are left alone",
+			current: config.Metadata{Description: "Remote text", Homepage: "https://old.example", Topics: []string{"go"}},
+			fields:  allFields,
+		},
+		{
+			name:    "every field",
+			current: config.Metadata{Description: "Old", Homepage: "https://old.example", Topics: []string{"go"}, Private: &public},
+			desired: config.Metadata{Description: "New", Homepage: "https://new.example", Topics: []string{"go", "cli"}, Private: &private},
+			fields:  allFields,
+			changes: []Change{
+				{Field: FieldDescription, From: "Old", To: "New"},
+				{Field: FieldHomepage, From: "https://old.example", To: "https://new.example"},
+				{Field: FieldTopics, From: "go", To: "go, cli"},
+				{Field: FieldPrivate, From: "false", To: "true"},
+			},
+			update: config.Metadata{Description: "New", Homepage: "https://new.example", Topics: []string{"go", "cli"}, Private: &private},
+		},
+		{
+			name:    "clearing topics",
+			current: config.Metadata{Topics: []string{"go"}},
+			desired: config.Metadata{Topics: []string{}},
+			fields:  allFields,
+			changes: []Change{{Field: FieldTopics, From: "go", To: ""}},
+			update:  config.Metadata{Topics: []string{}},
+		},
+		{
+			name:    "fields the forge lacks",
+			current: config.Metadata{Description: "Old"},
+			desired: config.Metadata{Description: "New", Homepage: "https://new.example", Topics: []string{"go"}},
+			fields:  []string{FieldDescription, FieldPrivate},
+			changes: []Change{{Field: FieldDescription, From: "Old", To: "New"}},
+			update:  config.Metadata{Description: "New"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update config.Metadata
+
+			changes := diffMetadata(tt.current, tt.desired, tt.fields, &update)
+
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("changes = %+v, want %+v", changes, tt.changes)
+			}
+
+			if !reflect.DeepEqual(update, tt.update) {
+				t.Errorf("update = %+v, want %+v", update, tt.update)
+			}
+		})
+	}
+}
+
+func TestPlanAndApplyMetadata(t *testing.T) {
+	githubForge, githubServer := newFakeForge(t, map[string][]response{
+		"GET /repos/ebisu/demo":        {{200, `{"description":"Old","homepage":"https://demo.example","topics":["go"],"private":false}`}},
+		"PATCH /repos/ebisu/demo":      {{200, `{}`}},
+		"PUT /repos/ebisu/demo/topics": {{200, `{}`}},
+	})
+	gitlabForge, gitlabServer := newFakeForge(t, map[string][]response{
+		"GET /api/v4/projects/ebisu%2Fdemo": {{200, `{"description":"New","topics":["cli","go"],"visibility":"public"}`}},
+	})
+
+	cfg := config.Config{
+		Remotes: map[string]config.RemoteDefinition{
+			"github": {API: &config.APIDefinition{Type: "github", BaseURL: githubServer.URL}},
+			"gitlab": {API: &config.APIDefinition{Type: "gitlab", BaseURL: gitlabServer.URL}},
+			"plain":  {URL: "git@example.com:${user}/${repo}.git"},
+		},
+		Repos: map[string]config.Repo{
+			"ebisu/demo": {
+				Remotes: config.RepoRemotes{"github": "", "gitlab": "", "plain": ""},
+				Targets: map[string]config.Target{
+					"github": {User: "ebisu", Repo: "demo"},
+					"gitlab": {User: "ebisu", Repo: "demo"},
+					"plain":  {User: "ebisu", Repo: "demo"},
+				},
+				Metadata: config.Metadata{Description: "New", Homepage: "https://demo.example", Topics: []string{"go", "cli"}},
+			},
+		},
+	}
+
+	plans := PlanMetadata(context.Background(), cfg, []string{"ebisu/demo"}, nil)
+
+	if len(plans) != 2 || plans[0].Remote != "github" || plans[1].Remote != "gitlab" {
+		t.Fatalf("plans = %+v, want github and gitlab", plans)
+	}
+
+	want := []Change{{Field: FieldDescription, From: "Old", To: "New"}, {Field: FieldTopics, From: "go", To: "go, cli"}}
+
+	if !reflect.DeepEqual(plans[0].Changes, want) {
+		t.Errorf("github changes = %+v, want %+v", plans[0].Changes, want)
+	}
+
+	if len(plans[1].Changes) != 0 {
+		t.Errorf("gitlab changes = %+v, want none", plans[1].Changes)
+	}
+
+	for _, plan := range plans {
+		if err := plan.Apply(context.Background()); err != nil {
+			t.Errorf("%s Apply() error = %v", plan.Remote, err)
+		}
+	}
+
+	if body := githubForge.requests[1].body; !reflect.DeepEqual(body, map[string]any{"description": "New"}) {
+		t.Errorf("PATCH body = %v", body)
+	}
+
+	if body := githubForge.last().body; !reflect.DeepEqual(body["names"], []any{"go", "cli"}) {
+		t.Errorf("topics body = %v", body)
+	}
+
+	if routes := gitlabForge.routes(); !slices.Equal(routes, []string{"GET /api/v4/projects/ebisu%2Fdemo"}) {
+		t.Errorf("gitlab routes = %v, want only the read", routes)
+	}
+}
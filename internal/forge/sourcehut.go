@@ -0,0 +1,200 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+type sourcehut struct {
+	api *api
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+func (s *sourcehut) query(ctx context.Context, query string, variables map[string]any, out any) error {
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphQLError  `json:"errors"`
+	}
+
+	err := s.api.do(ctx, http.MethodPost, "/query", map[string]any{
+		"query":     query,
+		"variables": variables,
+	}, &response)
+	if err != nil {
+		return err
+	}
+
+	if len(response.Errors) > 0 {
+		messages := make([]string, len(response.Errors))
+
+		for i, e := range response.Errors {
+			messages[i] = e.Message
+		}
+
+		return fmt.Errorf("sourcehut: %s", strings.Join(messages, "; "))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Data, out)
+}
+
+func (s *sourcehut) Exists(ctx context.Context, owner, name string) (bool, error) {
+	var data struct {
+		User *struct {
+			Repository *struct {
+				ID int `json:"id"`
+			} `json:"repository"`
+		} `json:"user"`
+	}
+
+	err := s.query(ctx, `query($username: String!, $name: String!) {
+  user(username: $username) { repository(name: $name) { id } }
+}`, map[string]any{
+		"username": strings.TrimPrefix(owner, "~"),
+		"name":     name,
+	}, &data)
+	if err != nil {
+		return false, err
+	}
+
+	return data.User != nil && data.User.Repository != nil, nil
+}
+
+func (s *sourcehut) Create(ctx context.Context, repo Repository) error {
+	visibility := "PUBLIC"
+
+	if isPrivate(repo.Metadata) {
+		visibility = "PRIVATE"
+	}
+
+	return s.query(ctx, `mutation($name: String!, $visibility: Visibility!, $description: String) {
+  createRepository(name: $name, visibility: $visibility, description: $description) { id }
+}`, map[string]any{
+		"name":        repo.Name,
+		"visibility":  visibility,
+		"description": repo.Description,
+	}, nil)
+}
+
+func (s *sourcehut) MetadataFields() []string {
+	return []string{FieldDescription, FieldPrivate}
+}
+
+type sourcehutRepository struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+}
+
+func (s *sourcehut) repository(ctx context.Context, owner, name string) (*sourcehutRepository, error) {
+	var data struct {
+		User *struct {
+			Repository *sourcehutRepository `json:"repository"`
+		} `json:"user"`
+	}
+
+	err := s.query(ctx, `query($username: String!, $name: String!) {
+  user(username: $username) { repository(name: $name) { id description visibility } }
+}`, map[string]any{
+		"username": strings.TrimPrefix(owner, "~"),
+		"name":     name,
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.User == nil || data.User.Repository == nil {
+		return nil, fmt.Errorf("sourcehut: repository not found: %s/%s", owner, name)
+	}
+
+	return data.User.Repository, nil
+}
+
+func (s *sourcehut) Metadata(ctx context.Context, owner, name string) (config.Metadata, error) {
+	repo, err := s.repository(ctx, owner, name)
+	if err != nil {
+		return config.Metadata{}, err
+	}
+
+	private := repo.Visibility != "PUBLIC"
+
+	return config.Metadata{
+		Description: repo.Description,
+		Private:     &private,
+	}, nil
+}
+
+func (s *sourcehut) UpdateMetadata(ctx context.Context, repo Repository) error {
+	input := map[string]any{}
+
+	if repo.Description != "" {
+		input["description"] = repo.Description
+	}
+
+	if repo.Private != nil {
+		input["visibility"] = "PUBLIC"
+
+		if *repo.Private {
+			input["visibility"] = "PRIVATE"
+		}
+	}
+
+	if len(input) == 0 {
+		return nil
+	}
+
+	existing, err := s.repository(ctx, repo.Owner, repo.Name)
+	if err != nil {
+		return err
+	}
+
+	return s.query(ctx, `mutation($id: Int!, $input: RepoInput!) {
+  updateRepository(id: $id, input: $input) { id }
+}`, map[string]any{
+		"id":    existing.ID,
+		"input": input,
+	}, nil)
+}
+
+func (s *sourcehut) List(ctx context.Context, owner string) ([]Listing, error) {
+	var listings []Listing
+	var cursor *string
+
+	for {
+		var data json.RawMessage
+
+		err := s.query(ctx, `query($username: String!, $cursor: Cursor) {
+  user(username: $username) { repositories(cursor: $cursor) { results { name description visibility } cursor } }
+}`, map[string]any{
+			"username": strings.TrimPrefix(owner, "~"),
+			"cursor":   cursor,
+		}, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		page, next, err := decodeSourcehutListing(s.api.baseURL, strings.TrimPrefix(owner, "~"), data)
+		if err != nil {
+			return nil, err
+		}
+
+		listings = append(listings, page...)
+
+		if next == "" {
+			return listings, nil
+		}
+
+		cursor = &next
+	}
+}
@@ -0,0 +1,65 @@
+package git
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/redact"
+)
+
+const credentialHelper = `!f() { test "$1" = get && printf 'username=%s\npassword=%s\n' "$MUGI_GIT_USERNAME" "$MUGI_GIT_PASSWORD"; }; f`
+
+type credential struct {
+	username string
+	password string
+}
+
+func (c credential) empty() bool {
+	return c.username == "" && c.password == ""
+}
+
+func splitCredential(rawURL string) (string, credential) {
+	if !strings.HasPrefix(rawURL, "https://") && !strings.HasPrefix(rawURL, "http://") {
+		return rawURL, credential{}
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL, credential{}
+	}
+
+	username := parsed.User.Username()
+	password, hasPassword := parsed.User.Password()
+
+	if !hasPassword && !redact.IsSecret(username) {
+		return rawURL, credential{}
+	}
+
+	parsed.User = nil
+
+	return parsed.String(), credential{username: username, password: password}
+}
+
+func StripCredentials(rawURL string) string {
+	stripped, _ := splitCredential(rawURL)
+
+	return stripped
+}
+
+func (c Client) WithCredentials(rawURL string) Client {
+	_, c.credential = splitCredential(rawURL)
+
+	return c
+}
+
+func (c credential) apply(command Command) Command {
+	if c.empty() || len(command.Argv) == 0 || command.Argv[0] != "git" {
+		return command
+	}
+
+	argv := []string{"git", "-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}
+	command.Argv = append(argv, command.Argv[1:]...)
+	command.Env = append(command.Env, "MUGI_GIT_USERNAME="+c.username, "MUGI_GIT_PASSWORD="+c.password)
+
+	return command
+}
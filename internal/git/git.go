@@ -1,11 +1,9 @@
 package git
 
 import (
-	"bytes"
 	"context"
 	"errors"
-	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/ebisu/mugi/internal/remote"
@@ -13,10 +11,6 @@ import (
 
 const sshEnv = "GIT_SSH_COMMAND=ssh -o StrictHostKeyChecking=accept-new"
 
-func gitEnv() []string {
-	return append(os.Environ(), sshEnv)
-}
-
 type Result struct {
 	Repo     string
 	Remote   string
@@ -28,7 +22,7 @@ type Result struct {
 func (r *Result) setError(err error) {
 	r.Error = err
 
-	var exitErr *exec.ExitError
+	var exitErr interface{ ExitCode() int }
 
 	if errors.As(err, &exitErr) {
 		r.ExitCode = exitErr.ExitCode()
@@ -41,23 +35,28 @@ func (r *Result) setError(err error) {
 	}
 }
 
-func Execute(ctx context.Context, op remote.Operation, repoPath, remoteName string, force bool) Result {
-	result := Result{
-		Repo:   repoPath,
-		Remote: remoteName,
-	}
+type Client struct {
+	runner     Runner
+	credential credential
+}
 
-	args := buildArgs(op, remoteName, repoPath, force)
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Dir = repoPath
-	cmd.Env = gitEnv()
+func New(runner Runner) Client {
+	return Client{runner: runner}
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func (c Client) run(ctx context.Context, command Command) (Output, error) {
+	command = c.credential.apply(command)
+
+	if c.runner == nil {
+		return ExecRunner{}.Run(ctx, command)
+	}
+
+	return c.runner.Run(ctx, command)
+}
 
-	err := cmd.Run()
-	result.Output = strings.TrimSpace(stdout.String() + stderr.String())
+func (c Client) exec(ctx context.Context, result Result, command Command) Result {
+	output, err := c.run(ctx, command)
+	result.Output = strings.TrimSpace(output.Stdout + output.Stderr)
 
 	if err != nil {
 		result.setError(err)
@@ -66,10 +65,33 @@ func Execute(ctx context.Context, op remote.Operation, repoPath, remoteName stri
 	return result
 }
 
-func buildArgs(op remote.Operation, remoteName, repoPath string, force bool) []string {
+func (c Client) output(ctx context.Context, dir string, args ...string) (string, bool) {
+	output, err := c.run(ctx, Command{Dir: dir, Argv: append([]string{"git"}, args...)})
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(output.Stdout), true
+}
+
+func (c Client) Execute(ctx context.Context, op remote.Operation, repoPath, remoteName string, force bool, refspecs ...string) Result {
+	args := c.buildArgs(ctx, op, remoteName, repoPath, force)
+
+	if op == remote.Push {
+		args = append(args, refspecs...)
+	}
+
+	return c.exec(ctx, Result{Repo: repoPath, Remote: remoteName}, Command{
+		Dir:  repoPath,
+		Argv: append([]string{"git"}, args...),
+		Env:  []string{sshEnv},
+	})
+}
+
+func (c Client) buildArgs(ctx context.Context, op remote.Operation, remoteName, repoPath string, force bool) []string {
 	switch op {
 	case remote.Pull:
-		branch := currentBranch(repoPath)
+		branch := c.CurrentBranch(ctx, repoPath)
 		if branch == "" {
 			branch = "HEAD"
 		}
@@ -88,132 +110,178 @@ func buildArgs(op remote.Operation, remoteName, repoPath string, force bool) []s
 	}
 }
 
-func currentBranch(repoPath string) string {
-	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-	cmd.Dir = repoPath
+func (c Client) CurrentBranch(ctx context.Context, repoPath string) string {
+	branch, _ := c.output(ctx, repoPath, "rev-parse", "--abbrev-ref", "HEAD")
 
-	out, err := cmd.Output()
-	if err != nil {
-		return ""
-	}
+	return branch
+}
 
-	return strings.TrimSpace(string(out))
+func (c Client) IsRepo(ctx context.Context, path string) bool {
+	_, ok := c.output(ctx, path, "rev-parse", "--git-dir")
+
+	return ok
 }
 
-func IsRepo(path string) bool {
-	cmd := exec.Command("git", "rev-parse", "--git-dir")
-	cmd.Dir = path
+func (c Client) Clone(ctx context.Context, url, path string) Result {
+	url, c.credential = splitCredential(url)
 
-	return cmd.Run() == nil
+	return c.exec(ctx, Result{Repo: path, Remote: "origin"}, Command{
+		Argv: []string{"git", "clone", url, path},
+		Env:  []string{sshEnv},
+	})
 }
 
-func Clone(ctx context.Context, url, path string) Result {
-	result := Result{
-		Repo:   path,
-		Remote: "origin",
-	}
+func (c Client) AddRemote(ctx context.Context, repoPath, name, url string) Result {
+	return c.exec(ctx, Result{Repo: repoPath, Remote: name}, Command{
+		Dir:  repoPath,
+		Argv: []string{"git", "remote", "add", name, StripCredentials(url)},
+	})
+}
 
-	cmd := exec.CommandContext(ctx, "git", "clone", url, path)
-	cmd.Env = gitEnv()
+func (c Client) RenameRemote(ctx context.Context, repoPath, oldName, newName string) Result {
+	return c.exec(ctx, Result{Repo: repoPath, Remote: newName}, Command{
+		Dir:  repoPath,
+		Argv: []string{"git", "remote", "rename", oldName, newName},
+	})
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func (c Client) HasRemote(ctx context.Context, repoPath, name string) bool {
+	_, ok := c.output(ctx, repoPath, "remote", "get-url", name)
 
-	err := cmd.Run()
-	result.Output = strings.TrimSpace(stdout.String() + stderr.String())
+	return ok
+}
+
+func (c Client) SetRemoteURL(ctx context.Context, repoPath, name, url string) Result {
+	return c.exec(ctx, Result{Repo: repoPath, Remote: name}, Command{
+		Dir:  repoPath,
+		Argv: []string{"git", "remote", "set-url", name, StripCredentials(url)},
+	})
+}
+
+func (c Client) GetRemoteURL(ctx context.Context, repoPath, name string) string {
+	url, _ := c.output(ctx, repoPath, "remote", "get-url", name)
 
+	return url
+}
+
+func (c Client) Remotes(ctx context.Context, repoPath string) (string, error) {
+	output, err := c.run(ctx, Command{Dir: repoPath, Argv: []string{"git", "remote", "-v"}})
 	if err != nil {
-		result.setError(err)
+		return "", err
 	}
 
-	return result
+	return output.Stdout, nil
 }
 
-func AddRemote(ctx context.Context, repoPath, name, url string) Result {
-	result := Result{
-		Repo:   repoPath,
-		Remote: name,
-	}
+func (c Client) ConfigRegexp(ctx context.Context, repoPath, pattern string) string {
+	output, _ := c.output(ctx, repoPath, "config", "--get-regexp", pattern)
 
-	cmd := exec.CommandContext(ctx, "git", "remote", "add", name, url)
-	cmd.Dir = repoPath
+	return output
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func (c Client) RevParse(ctx context.Context, repoPath, rev string) string {
+	sha, _ := c.output(ctx, repoPath, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
 
-	err := cmd.Run()
-	result.Output = strings.TrimSpace(stdout.String() + stderr.String())
+	return sha
+}
 
-	if err != nil {
-		result.setError(err)
-	}
+func (c Client) IsAncestor(ctx context.Context, repoPath, ancestor, descendant string) bool {
+	_, ok := c.output(ctx, repoPath, "merge-base", "--is-ancestor", ancestor, descendant)
 
-	return result
+	return ok
 }
 
-func RenameRemote(ctx context.Context, repoPath, oldName, newName string) Result {
-	result := Result{
-		Repo:   repoPath,
-		Remote: newName,
+func (c Client) FastForward(ctx context.Context, repoPath, branch, target string) Result {
+	argv := []string{"git", "update-ref", "refs/heads/" + branch, target}
+
+	if branch == c.CurrentBranch(ctx, repoPath) {
+		argv = []string{"git", "merge", "--ff-only", target}
 	}
 
-	cmd := exec.CommandContext(ctx, "git", "remote", "rename", oldName, newName)
-	cmd.Dir = repoPath
+	return c.exec(ctx, Result{Repo: repoPath}, Command{Dir: repoPath, Argv: argv})
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func (c Client) RunCommand(ctx context.Context, repoPath string, argv []string) Result {
+	return c.exec(ctx, Result{Repo: repoPath}, Command{
+		Dir:  repoPath,
+		Argv: argv,
+		Env:  []string{sshEnv},
+	})
+}
+
+func (c Client) LsRemote(ctx context.Context, repoPath, url string) (map[string]string, Result) {
+	result := Result{Repo: repoPath}
+
+	command := Command{
+		Env: []string{"GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o StrictHostKeyChecking=accept-new -o BatchMode=yes"},
+	}
 
-	err := cmd.Run()
-	result.Output = strings.TrimSpace(stdout.String() + stderr.String())
+	if c.IsRepo(ctx, repoPath) {
+		command.Dir = repoPath
+	}
+
+	url, c.credential = splitCredential(url)
+	command.Argv = []string{"git", "ls-remote", "--refs", url}
 
+	output, err := c.run(ctx, command)
 	if err != nil {
+		result.Output = strings.TrimSpace(output.Stderr)
 		result.setError(err)
+
+		return nil, result
 	}
 
-	return result
+	return parseRefs(output.Stdout, "\t"), result
 }
 
-func HasRemote(repoPath, name string) bool {
-	cmd := exec.Command("git", "remote", "get-url", name)
-	cmd.Dir = repoPath
+func (c Client) LocalRefs(ctx context.Context, repoPath string) map[string]string {
+	out, ok := c.output(ctx, repoPath, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	if !ok {
+		return nil
+	}
 
-	return cmd.Run() == nil
+	return parseRefs(out, " ")
 }
 
-func SetRemoteURL(ctx context.Context, repoPath, name, url string) Result {
-	result := Result{
-		Repo:   repoPath,
-		Remote: name,
-	}
+func parseRefs(output, separator string) map[string]string {
+	refs := make(map[string]string)
 
-	cmd := exec.CommandContext(ctx, "git", "remote", "set-url", name, url)
-	cmd.Dir = repoPath
+	for _, line := range strings.Split(output, "\n") {
+		sha, ref, ok := strings.Cut(strings.TrimSpace(line), separator)
+		if !ok {
+			continue
+		}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+		if strings.HasPrefix(ref, "refs/heads/") || strings.HasPrefix(ref, "refs/tags/") {
+			refs[ref] = sha
+		}
+	}
 
-	err := cmd.Run()
-	result.Output = strings.TrimSpace(stdout.String() + stderr.String())
+	return refs
+}
 
-	if err != nil {
-		result.setError(err)
+func (c Client) CommonDir(ctx context.Context, repoPath string) string {
+	dir, ok := c.output(ctx, repoPath, "rev-parse", "--git-common-dir")
+	if !ok || dir == "" {
+		return ""
 	}
 
-	return result
-}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repoPath, dir)
+	}
 
-func GetRemoteURL(repoPath, name string) string {
-	cmd := exec.Command("git", "remote", "get-url", name)
-	cmd.Dir = repoPath
+	return filepath.Clean(dir)
+}
 
-	out, err := cmd.Output()
-	if err != nil {
+func (c Client) GitPath(ctx context.Context, repoPath, name string) string {
+	path, ok := c.output(ctx, repoPath, "rev-parse", "--git-path", name)
+	if !ok {
 		return ""
 	}
 
-	return strings.TrimSpace(string(out))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoPath, path)
+	}
+
+	return path
 }
@@ -0,0 +1,94 @@
+package git_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/git/gittest"
+	"github.com/ebisu/mugi/internal/remote"
+)
+
+func TestExecuteArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       remote.Operation
+		force    bool
+		refspecs []string
+		branch   gittest.Response
+		want     []string
+	}{
+		{
+			name:   "pull current branch",
+			op:     remote.Pull,
+			branch: gittest.Response{Stdout: "main\n"},
+			want:   []string{"git", "pull", "origin", "main"},
+		},
+		{
+			name:   "pull without branch",
+			op:     remote.Pull,
+			branch: gittest.Response{Exit: 128},
+			want:   []string{"git", "pull", "origin", "HEAD"},
+		},
+		{
+			name: "push",
+			op:   remote.Push,
+			want: []string{"git", "push", "origin"},
+		},
+		{
+			name:  "force push",
+			op:    remote.Push,
+			force: true,
+			want:  []string{"git", "push", "--force", "origin"},
+		},
+		{
+			name:     "push refspecs",
+			op:       remote.Push,
+			refspecs: []string{"main", "v1.0"},
+			want:     []string{"git", "push", "origin", "main", "v1.0"},
+		},
+		{
+			name:     "fetch ignores refspecs",
+			op:       remote.Fetch,
+			refspecs: []string{"main"},
+			want:     []string{"git", "fetch", "origin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gittest.NewFake().On("git rev-parse --abbrev-ref HEAD", tt.branch)
+
+			result := git.New(fake).Execute(context.Background(), tt.op, "/repo", "origin", tt.force, tt.refspecs...)
+			if result.Error != nil {
+				t.Fatalf("Execute() error = %v", result.Error)
+			}
+
+			calls := fake.Calls()
+			last := calls[len(calls)-1]
+
+			if !slices.Equal(last.Argv, tt.want) {
+				t.Errorf("argv = %q, want %q", last.Argv, tt.want)
+			}
+
+			if last.Dir != "/repo" {
+				t.Errorf("dir = %q, want /repo", last.Dir)
+			}
+		})
+	}
+}
+
+func TestExecuteFailure(t *testing.T) {
+	fake := gittest.NewFake().On("git push origin", gittest.Response{Stderr: "rejected\n", Exit: 1})
+
+	result := git.New(fake).Execute(context.Background(), remote.Push, "/repo", "origin", false)
+
+	if result.Error == nil {
+		t.Fatal("Execute() error = nil, want failure")
+	}
+
+	if result.ExitCode != 1 || result.Output != "rejected" {
+		t.Errorf("result = %d %q, want 1 %q", result.ExitCode, result.Output, "rejected")
+	}
+}
@@ -0,0 +1,107 @@
+package gittest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ebisu/mugi/internal/git"
+)
+
+type Response struct {
+	Stdout string
+	Stderr string
+	Exit   int
+}
+
+type ExitError int
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func (e ExitError) ExitCode() int {
+	return int(e)
+}
+
+type Fake struct {
+	mu        sync.Mutex
+	responses map[string][]Response
+	calls     []git.Command
+}
+
+func NewFake() *Fake {
+	return &Fake{responses: make(map[string][]Response)}
+}
+
+func (f *Fake) On(argv string, responses ...Response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses[argv] = append(f.responses[argv], responses...)
+
+	return f
+}
+
+func (f *Fake) OnDir(dir, argv string, responses ...Response) *Fake {
+	return f.On(dir+": "+argv, responses...)
+}
+
+func (f *Fake) Run(ctx context.Context, command git.Command) (git.Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, git.Command{
+		Dir:  command.Dir,
+		Argv: slices.Clone(command.Argv),
+		Env:  slices.Clone(command.Env),
+	})
+
+	if err := ctx.Err(); err != nil {
+		return git.Output{}, err
+	}
+
+	argv := strings.Join(command.Argv, " ")
+
+	for _, key := range []string{command.Dir + ": " + argv, argv} {
+		queue := f.responses[key]
+		if len(queue) == 0 {
+			continue
+		}
+
+		response := queue[0]
+
+		if len(queue) > 1 {
+			f.responses[key] = queue[1:]
+		}
+
+		output := git.Output{Stdout: response.Stdout, Stderr: response.Stderr}
+
+		if response.Exit != 0 {
+			return output, ExitError(response.Exit)
+		}
+
+		return output, nil
+	}
+
+	return git.Output{}, nil
+}
+
+func (f *Fake) Calls() []git.Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slices.Clone(f.calls)
+}
+
+func (f *Fake) Argv() []string {
+	var argv []string
+
+	for _, call := range f.Calls() {
+		argv = append(argv, strings.Join(call.Argv, " "))
+	}
+
+	return argv
+}
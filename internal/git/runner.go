@@ -0,0 +1,42 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+)
+
+type Command struct {
+	Dir  string
+	Argv []string
+	Env  []string
+}
+
+type Output struct {
+	Stdout string
+	Stderr string
+}
+
+type Runner interface {
+	Run(ctx context.Context, cmd Command) (Output, error)
+}
+
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, command Command) (Output, error) {
+	cmd := exec.CommandContext(ctx, command.Argv[0], command.Argv[1:]...)
+	cmd.Dir = command.Dir
+
+	if len(command.Env) > 0 {
+		cmd.Env = append(os.Environ(), command.Env...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	return Output{Stdout: stdout.String(), Stderr: stderr.String()}, err
+}
@@ -0,0 +1,67 @@
+package giturl
+
+import (
+	"fmt"
+	"strings"
+)
+
+func ApplyFilter(filter, value string) (string, error) {
+	name, args, _ := strings.Cut(filter, ":")
+
+	switch name {
+	case "lower":
+		return strings.ToLower(value), nil
+	case "upper":
+		return strings.ToUpper(value), nil
+	case "replace":
+		old, replacement, ok := strings.Cut(args, ":")
+		if !ok {
+			return "", fmt.Errorf("replace filter requires replace:old:new")
+		}
+
+		return strings.ReplaceAll(value, old, replacement), nil
+	case "trim_prefix":
+		return strings.TrimPrefix(value, args), nil
+	case "trim_suffix":
+		return strings.TrimSuffix(value, args), nil
+	default:
+		return "", fmt.Errorf("unknown filter: %s", name)
+	}
+}
+
+func invertFilters(filters []string, filtered string) (string, bool) {
+	value := filtered
+
+	for i := len(filters) - 1; i >= 0; i-- {
+		name, args, _ := strings.Cut(filters[i], ":")
+
+		switch name {
+		case "lower", "upper":
+		case "replace":
+			old, replacement, ok := strings.Cut(args, ":")
+			if !ok || replacement == "" {
+				return "", false
+			}
+
+			value = strings.ReplaceAll(value, replacement, old)
+		case "trim_prefix":
+			value = args + value
+		case "trim_suffix":
+			value += args
+		default:
+			return "", false
+		}
+	}
+
+	forward := value
+
+	for _, filter := range filters {
+		var err error
+
+		if forward, err = ApplyFilter(filter, forward); err != nil {
+			return "", false
+		}
+	}
+
+	return value, forward == filtered
+}
@@ -0,0 +1,416 @@
+package giturl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/git"
+)
+
+type URL struct {
+	Scheme   string
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Path     string
+	SCP      bool
+}
+
+var defaultPorts = map[string]string{
+	"ssh":   "22",
+	"git":   "9418",
+	"http":  "80",
+	"https": "443",
+}
+
+func Parse(raw string) (URL, error) {
+	raw = strings.TrimSpace(raw)
+
+	if raw == "" {
+		return URL{}, fmt.Errorf("empty url")
+	}
+
+	if strings.Contains(raw, "://") {
+		return parseStandard(raw)
+	}
+
+	if u, ok := parseSCP(raw); ok {
+		return u, nil
+	}
+
+	return URL{Scheme: "file", Path: raw}, nil
+}
+
+func parseStandard(raw string) (URL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return URL{}, fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+
+	u := URL{
+		Scheme: strings.ToLower(parsed.Scheme),
+		Host:   strings.ToLower(parsed.Hostname()),
+		Port:   parsed.Port(),
+		Path:   parsed.Path,
+	}
+
+	if strings.HasPrefix(u.Scheme, "git+ssh") || strings.HasPrefix(u.Scheme, "ssh+git") {
+		u.Scheme = "ssh"
+	}
+
+	if parsed.User != nil {
+		u.User = parsed.User.Username()
+		u.Password, _ = parsed.User.Password()
+	}
+
+	return u, nil
+}
+
+func parseSCP(raw string) (URL, bool) {
+	colon := strings.Index(raw, ":")
+	if colon == -1 {
+		return URL{}, false
+	}
+
+	if slash := strings.Index(raw, "/"); slash != -1 && slash < colon {
+		return URL{}, false
+	}
+
+	host := raw[:colon]
+
+	if len(host) == 1 {
+		return URL{}, false
+	}
+
+	u := URL{Scheme: "ssh", Path: raw[colon+1:], SCP: true}
+
+	if user, rest, ok := strings.Cut(host, "@"); ok {
+		u.User = user
+		host = rest
+	}
+
+	if host == "" {
+		return URL{}, false
+	}
+
+	u.Host = strings.ToLower(strings.Trim(host, "[]"))
+
+	return u, true
+}
+
+func (u URL) String() string {
+	if u.SCP {
+		host := u.Host
+
+		if u.User != "" {
+			host = u.User + "@" + host
+		}
+
+		return host + ":" + u.Path
+	}
+
+	if u.Scheme == "file" && u.Host == "" {
+		if strings.HasPrefix(u.Path, "/") {
+			return "file://" + u.Path
+		}
+
+		return u.Path
+	}
+
+	built := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+
+	if u.Port != "" {
+		built.Host += ":" + u.Port
+	}
+
+	if u.Password != "" {
+		built.User = url.UserPassword(u.User, u.Password)
+	} else if u.User != "" {
+		built.User = url.User(u.User)
+	}
+
+	return built.String()
+}
+
+func (u URL) Transport() string {
+	switch u.Scheme {
+	case "http", "https":
+		return "http"
+	default:
+		return u.Scheme
+	}
+}
+
+func (u URL) Endpoint() string {
+	port := u.Port
+
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	if port == "" {
+		return u.Host
+	}
+
+	return u.Host + ":" + port
+}
+
+func (u URL) RepoPath() string {
+	path := strings.Trim(u.Path, "/")
+	path = strings.TrimSuffix(path, ".git")
+
+	return strings.TrimSuffix(path, "/")
+}
+
+func (u URL) RepoName() string {
+	segments := strings.Split(u.RepoPath(), "/")
+
+	for i, segment := range segments {
+		segments[i] = strings.TrimPrefix(segment, "~")
+	}
+
+	switch len(segments) {
+	case 0:
+		return ""
+	case 1:
+		return segments[0]
+	default:
+		return segments[len(segments)-2] + "/" + segments[len(segments)-1]
+	}
+}
+
+func (u URL) Equivalent(other URL) bool {
+	return u.Transport() == other.Transport() &&
+		u.Endpoint() == other.Endpoint() &&
+		u.RepoPath() == other.RepoPath()
+}
+
+type Rewrites map[string]string
+
+func LoadRewrites(ctx context.Context, client git.Client, dir string) Rewrites {
+	rewrites := make(Rewrites)
+
+	out := client.ConfigRegexp(ctx, dir, `^url\..*\.insteadof$`)
+
+	for line := range strings.SplitSeq(out, "\n") {
+		key, prefix, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+
+		base := strings.TrimPrefix(key, "url.")
+		base = base[:len(base)-len(".insteadof")]
+
+		rewrites[prefix] = base
+	}
+
+	return rewrites
+}
+
+func (r Rewrites) Apply(raw string) string {
+	var longest string
+
+	for prefix := range r {
+		if strings.HasPrefix(raw, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+
+	if longest == "" {
+		return raw
+	}
+
+	return r[longest] + strings.TrimPrefix(raw, longest)
+}
+
+type Template struct {
+	base     URL
+	pattern  *regexp.Regexp
+	filtered []filteredCapture
+}
+
+type filteredCapture struct {
+	group   string
+	name    string
+	filters []string
+}
+
+var placeholderPattern = regexp.MustCompile(`\$\$|\$\{([^}]*)\}`)
+
+func TemplateHost(template string) string {
+	masked, _ := mask(template)
+
+	base, err := Parse(masked)
+	if err != nil {
+		return ""
+	}
+
+	return base.Host
+}
+
+func CompileTemplate(template string) (*Template, error) {
+	masked, placeholders := mask(template)
+
+	base, err := Parse(masked)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range placeholders {
+		if strings.Contains(base.Host, sentinel(i)) {
+			return nil, fmt.Errorf("template host must be literal: %s", template)
+		}
+
+		if strings.Contains(base.User, sentinel(i)) {
+			base.User = ""
+		}
+	}
+
+	t := &Template{base: base}
+	seen := make(map[string]bool)
+	pattern := regexp.QuoteMeta(URL{Path: base.Path}.RepoPath())
+
+	for i, placeholder := range placeholders {
+		pattern = strings.Replace(pattern, sentinel(i), t.capturePattern(i, placeholder, seen), 1)
+	}
+
+	compiled, err := regexp.Compile("^" + pattern + "$")
+	if err != nil {
+		return nil, err
+	}
+
+	t.pattern = compiled
+
+	return t, nil
+}
+
+func mask(template string) (string, []string) {
+	var placeholders []string
+
+	masked := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if placeholder == "$$" {
+			return "$"
+		}
+
+		placeholders = append(placeholders, placeholder)
+
+		return sentinel(len(placeholders) - 1)
+	})
+
+	return masked, placeholders
+}
+
+func sentinel(index int) string {
+	return fmt.Sprintf("mugi%dvar", index)
+}
+
+func (t *Template) capturePattern(index int, placeholder string, seen map[string]bool) string {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(placeholder, "${"), "}"), "|")
+	name := strings.TrimSpace(parts[0])
+
+	if len(parts) > 1 {
+		pattern := `[^/]+?`
+
+		switch name {
+		case "name":
+			pattern = `[^/]+?/[^/]+?`
+		case "owner":
+			name = "user"
+		case "user", "repo":
+		default:
+			return pattern
+		}
+
+		capture := filteredCapture{group: fmt.Sprintf("f%d", index), name: name}
+
+		for _, filter := range parts[1:] {
+			capture.filters = append(capture.filters, strings.TrimSpace(filter))
+		}
+
+		t.filtered = append(t.filtered, capture)
+
+		return "(?P<" + capture.group + ">" + pattern + ")"
+	}
+
+	group := func(name, pattern string) string {
+		if seen[name] {
+			return pattern
+		}
+
+		seen[name] = true
+
+		return "(?P<" + name + ">" + pattern + ")"
+	}
+
+	switch name {
+	case "user", "owner":
+		return group("user", `[^/]+?`)
+	case "repo":
+		return group("repo", `[^/]+?`)
+	case "name":
+		return group("user", `[^/]+?`) + "/" + group("repo", `[^/]+?`)
+	default:
+		return `[^/]*?`
+	}
+}
+
+func (t *Template) Match(u URL) (map[string]string, bool) {
+	if t.base.Transport() != u.Transport() || t.base.Endpoint() != u.Endpoint() {
+		return nil, false
+	}
+
+	if u.Transport() != "http" && t.base.User != "" && u.User != "" && t.base.User != u.User {
+		return nil, false
+	}
+
+	groups := t.pattern.FindStringSubmatch(u.RepoPath())
+	if groups == nil {
+		return nil, false
+	}
+
+	values := make(map[string]string)
+	captured := make(map[string]string)
+
+	for i, name := range t.pattern.SubexpNames() {
+		if name != "" {
+			captured[name] = groups[i]
+		}
+	}
+
+	for _, name := range []string{"user", "repo"} {
+		if value, ok := captured[name]; ok {
+			values[name] = value
+		}
+	}
+
+	for _, capture := range t.filtered {
+		value, ok := invertFilters(capture.filters, captured[capture.group])
+		if !ok {
+			continue
+		}
+
+		if capture.name != "name" {
+			if _, set := values[capture.name]; !set {
+				values[capture.name] = value
+			}
+
+			continue
+		}
+
+		if i := strings.LastIndex(value, "/"); i > 0 {
+			if _, set := values["user"]; !set {
+				values["user"] = value[:i]
+			}
+
+			if _, set := values["repo"]; !set {
+				values["repo"] = value[i+1:]
+			}
+		}
+	}
+
+	return values, true
+}
@@ -0,0 +1,82 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type Env struct {
+	Repo     string
+	Remote   string
+	Op       string
+	ExitCode int
+}
+
+func (e Env) environ() []string {
+	return append(os.Environ(),
+		"MUGI_REPO="+e.Repo,
+		"MUGI_REMOTE="+e.Remote,
+		"MUGI_OP="+e.Op,
+		"MUGI_EXIT_CODE="+strconv.Itoa(e.ExitCode),
+	)
+}
+
+type Error struct {
+	Hook     string
+	ExitCode int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s hook failed (exit %d)", e.Hook, e.ExitCode)
+}
+
+func Run(ctx context.Context, name, command, dir string, env Env) (string, error) {
+	if command == "" {
+		return "", nil
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = env.environ()
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err == nil {
+		return strings.TrimSpace(output.String()), nil
+	}
+
+	exitCode := 1
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+
+	text := strings.TrimSpace(output.String())
+
+	if text == "" {
+		text = err.Error()
+	}
+
+	return text, &Error{Hook: name, ExitCode: exitCode}
+}
+
+func ExitCode(err error) int {
+	var hookErr *Error
+
+	if errors.As(err, &hookErr) {
+		return hookErr.ExitCode
+	}
+
+	return 1
+}
@@ -0,0 +1,190 @@
+package manage
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/ebisu/mugi/internal/git"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnreachable = "unreachable"
+	StatusAuth        = "auth"
+	StatusSkipped     = "skipped"
+)
+
+const (
+	IssueUnreachable   = "unreachable"
+	IssueAuth          = "auth"
+	IssueMissing       = "missing"
+	IssueMismatch      = "mismatch"
+	IssueLocalMismatch = "local_mismatch"
+)
+
+const checkConcurrency = 8
+
+type CheckTarget struct {
+	Repo   string
+	Remote string
+	URL    string
+	Path   string
+	Skip   string
+}
+
+type RemoteHealth struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Skip   string `json:"skip,omitempty"`
+	Refs   int    `json:"refs"`
+
+	refs map[string]string
+}
+
+type Issue struct {
+	Kind   string            `json:"kind"`
+	Remote string            `json:"remote,omitempty"`
+	Ref    string            `json:"ref,omitempty"`
+	SHAs   map[string]string `json:"shas,omitempty"`
+	Detail string            `json:"detail,omitempty"`
+}
+
+type RepoHealth struct {
+	Repo    string         `json:"repo"`
+	Remotes []RemoteHealth `json:"remotes"`
+	Issues  []Issue        `json:"issues"`
+}
+
+var authFailure = regexp.MustCompile(`(?i)authentication failed|permission denied|could not read (username|password)|access denied|invalid credentials|the requested url returned error: 40[13]\b`)
+
+func Check(ctx context.Context, runner git.Runner, targets []CheckTarget) []RepoHealth {
+	client := git.New(runner)
+	healths := make([]RemoteHealth, len(targets))
+	semaphore := make(chan struct{}, checkConcurrency)
+
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			healths[i] = checkRemote(ctx, client, target)
+		}()
+	}
+
+	wg.Wait()
+
+	var repos []RepoHealth
+
+	index := make(map[string]int)
+	paths := make(map[string]string)
+
+	for i, target := range targets {
+		position, ok := index[target.Repo]
+		if !ok {
+			position = len(repos)
+			index[target.Repo] = position
+			paths[target.Repo] = target.Path
+
+			repos = append(repos, RepoHealth{Repo: target.Repo})
+		}
+
+		repos[position].Remotes = append(repos[position].Remotes, healths[i])
+	}
+
+	for i := range repos {
+		repos[i].Issues = compareRefs(repos[i].Remotes, client.LocalRefs(ctx, paths[repos[i].Repo]))
+	}
+
+	return repos
+}
+
+func checkRemote(ctx context.Context, client git.Client, target CheckTarget) RemoteHealth {
+	health := RemoteHealth{Name: target.Remote, URL: target.URL, Status: StatusOK}
+
+	if target.Skip != "" {
+		health.Status = StatusSkipped
+		health.Skip = target.Skip
+
+		return health
+	}
+
+	refs, result := client.LsRemote(ctx, target.Path, target.URL)
+	if result.Error != nil {
+		health.Status = StatusUnreachable
+		health.Error = result.Output
+
+		if authFailure.MatchString(result.Output) {
+			health.Status = StatusAuth
+		}
+
+		return health
+	}
+
+	health.refs = refs
+	health.Refs = len(refs)
+
+	return health
+}
+
+func compareRefs(remotes []RemoteHealth, local map[string]string) []Issue {
+	issues := []Issue{}
+	seen := make(map[string]bool)
+
+	for _, remote := range remotes {
+		switch remote.Status {
+		case StatusUnreachable:
+			issues = append(issues, Issue{Kind: IssueUnreachable, Remote: remote.Name, Detail: remote.Error})
+		case StatusAuth:
+			issues = append(issues, Issue{Kind: IssueAuth, Remote: remote.Name, Detail: remote.Error})
+		case StatusOK:
+			for ref := range remote.refs {
+				seen[ref] = true
+			}
+		}
+	}
+
+	for _, ref := range slices.Sorted(maps.Keys(seen)) {
+		shas := make(map[string]string)
+
+		for _, remote := range remotes {
+			if remote.Status != StatusOK {
+				continue
+			}
+
+			sha, ok := remote.refs[ref]
+			if !ok {
+				issues = append(issues, Issue{Kind: IssueMissing, Remote: remote.Name, Ref: ref})
+
+				continue
+			}
+
+			shas[remote.Name] = sha
+
+			if localSHA, ok := local[ref]; ok && localSHA != sha {
+				issues = append(issues, Issue{
+					Kind:   IssueLocalMismatch,
+					Remote: remote.Name,
+					Ref:    ref,
+					SHAs:   map[string]string{"local": localSHA, remote.Name: sha},
+				})
+			}
+		}
+
+		if len(slices.Compact(slices.Sorted(maps.Values(shas)))) > 1 {
+			issues = append(issues, Issue{Kind: IssueMismatch, Ref: ref, SHAs: shas})
+		}
+	}
+
+	return issues
+}
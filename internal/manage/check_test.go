@@ -0,0 +1,136 @@
+package manage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/git/gittest"
+)
+
+func TestCheckClassifiesFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		status string
+	}{
+		{"http unauthorized", "fatal: unable to access 'https://example.com/a.git/': The requested URL returned error: 401", StatusAuth},
+		{"http forbidden", "fatal: unable to access 'https://example.com/a.git/': The requested URL returned error: 403", StatusAuth},
+		{"ssh key", "git@example.com: Permission denied (publickey).", StatusAuth},
+		{"prompt disabled", "fatal: could not read Username for 'https://example.com': terminal prompts disabled", StatusAuth},
+		{"not found", "fatal: unable to access 'https://example.com/a.git/': The requested URL returned error: 404", StatusUnreachable},
+		{"status digits in host", "fatal: unable to access 'https://git401.example.com/a.git/': Could not resolve host: git401.example.com", StatusUnreachable},
+		{"status digits in port", "ssh: connect to host example.com port 4030: Connection refused", StatusUnreachable},
+		{"server error", "fatal: unable to access 'https://example.com/a.git/': The requested URL returned error: 4031", StatusUnreachable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gittest.NewFake()
+			fake.On("git ls-remote --refs https://example.com/a.git", gittest.Response{Stderr: tt.stderr, Exit: 128})
+
+			repos := Check(context.Background(), fake, []CheckTarget{{Repo: "ebisu/a", Remote: "origin", URL: "https://example.com/a.git", Path: t.TempDir()}})
+
+			if got := repos[0].Remotes[0].Status; got != tt.status {
+				t.Errorf("status = %s, want %s", got, tt.status)
+			}
+
+			if len(repos[0].Issues) != 1 || repos[0].Issues[0].Kind != tt.status {
+				t.Errorf("issues = %+v, want one %s issue", repos[0].Issues, tt.status)
+			}
+		})
+	}
+}
+
+func TestCheckSkipsTargets(t *testing.T) {
+	fake := gittest.NewFake()
+
+	repos := Check(context.Background(), fake, []CheckTarget{{Repo: "ebisu/a", Remote: "origin", URL: "https://example.com/a.git", Path: t.TempDir(), Skip: "path shared with ebisu/b"}})
+
+	if remote := repos[0].Remotes[0]; remote.Status != StatusSkipped || remote.Skip != "path shared with ebisu/b" {
+		t.Errorf("remote = %+v, want skipped", remote)
+	}
+
+	if len(repos[0].Issues) != 0 {
+		t.Errorf("issues = %+v, want none", repos[0].Issues)
+	}
+
+	for _, argv := range fake.Argv() {
+		if strings.Contains(argv, "ls-remote") {
+			t.Errorf("skipped remote was queried: %v", argv)
+		}
+	}
+}
+
+func TestCompareRefs(t *testing.T) {
+	healthy := func(name string, refs map[string]string) RemoteHealth {
+		return RemoteHealth{Name: name, Status: StatusOK, refs: refs}
+	}
+
+	tests := []struct {
+		name    string
+		remotes []RemoteHealth
+		local   map[string]string
+		want    []Issue
+	}{
+		{
+			name: "in step",
+			remotes: []RemoteHealth{
+				healthy("github", map[string]string{"refs/heads/main": "a1", "refs/tags/v1": "t1"}),
+				healthy("codeberg", map[string]string{"refs/heads/main": "a1", "refs/tags/v1": "t1"}),
+			},
+			local: map[string]string{"refs/heads/main": "a1"},
+			want:  []Issue{},
+		},
+		{
+			name: "missing tag",
+			remotes: []RemoteHealth{
+				healthy("github", map[string]string{"refs/heads/main": "a1", "refs/tags/v1": "t1"}),
+				healthy("codeberg", map[string]string{"refs/heads/main": "a1"}),
+			},
+			want: []Issue{{Kind: IssueMissing, Remote: "codeberg", Ref: "refs/tags/v1"}},
+		},
+		{
+			name: "diverged branch",
+			remotes: []RemoteHealth{
+				healthy("github", map[string]string{"refs/heads/main": "a1"}),
+				healthy("codeberg", map[string]string{"refs/heads/main": "b2"}),
+			},
+			local: map[string]string{"refs/heads/main": "a1"},
+			want: []Issue{
+				{Kind: IssueLocalMismatch, Remote: "codeberg", Ref: "refs/heads/main", SHAs: map[string]string{"local": "a1", "codeberg": "b2"}},
+				{Kind: IssueMismatch, Ref: "refs/heads/main", SHAs: map[string]string{"github": "a1", "codeberg": "b2"}},
+			},
+		},
+		{
+			name: "local only ref ignored",
+			remotes: []RemoteHealth{
+				healthy("github", map[string]string{"refs/heads/main": "a1"}),
+			},
+			local: map[string]string{"refs/heads/main": "a1", "refs/heads/wip": "c3"},
+			want:  []Issue{},
+		},
+		{
+			name: "failed and skipped remotes",
+			remotes: []RemoteHealth{
+				healthy("github", map[string]string{"refs/heads/main": "a1"}),
+				{Name: "gitlab", Status: StatusAuth, Error: "denied"},
+				{Name: "backup", Status: StatusUnreachable, Error: "timeout"},
+				{Name: "archive", Status: StatusSkipped, Skip: "path shared"},
+			},
+			want: []Issue{
+				{Kind: IssueAuth, Remote: "gitlab", Detail: "denied"},
+				{Kind: IssueUnreachable, Remote: "backup", Detail: "timeout"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareRefs(tt.remotes, tt.local); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareRefs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package manage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/remote"
+)
+
+const UpstreamRemote = "upstream"
+
+type BranchStatus int
+
+const (
+	BranchUpToDate BranchStatus = iota
+	BranchForwarded
+	BranchCreated
+	BranchAhead
+	BranchDiverged
+	BranchMissing
+	BranchFailed
+)
+
+type BranchUpdate struct {
+	Branch string
+	Status BranchStatus
+	From   string
+	To     string
+	Output string
+}
+
+type ForkUpdate struct {
+	Repo     string
+	Path     string
+	Branches []BranchUpdate
+	Skip     string
+	Error    error
+}
+
+func (u ForkUpdate) Pushable(ctx context.Context, runner git.Runner, remoteName string) (push, diverged []string) {
+	client := git.New(runner)
+
+	for _, branch := range u.Branches {
+		switch branch.Status {
+		case BranchUpToDate, BranchForwarded, BranchCreated:
+		default:
+			continue
+		}
+
+		pushed := client.RevParse(ctx, u.Path, "refs/remotes/"+remoteName+"/"+branch.Branch)
+
+		switch {
+		case pushed == branch.To:
+		case pushed == "" || client.IsAncestor(ctx, u.Path, pushed, branch.To):
+			push = append(push, branch.Branch)
+		default:
+			diverged = append(diverged, branch.Branch)
+		}
+	}
+
+	return push, diverged
+}
+
+func Forks(cfg config.Config, name string) ([]string, error) {
+	if name != remote.All {
+		fullName, repo, found := cfg.FindRepo(name)
+		if !found {
+			return nil, fmt.Errorf("repository not found: %s", name)
+		}
+
+		if repo.Upstream == nil {
+			return nil, fmt.Errorf("%s has no upstream", fullName)
+		}
+
+		return []string{fullName}, nil
+	}
+
+	var names []string
+
+	for _, fullName := range sortedRepoNames(cfg) {
+		if cfg.Repos[fullName].Upstream != nil {
+			names = append(names, fullName)
+		}
+	}
+
+	return names, nil
+}
+
+func UpdateFork(ctx context.Context, runner git.Runner, name string, repo config.Repo) ForkUpdate {
+	client := git.New(runner)
+	path := repo.ExpandPath()
+	update := ForkUpdate{Repo: name, Path: path}
+
+	if !client.IsRepo(ctx, path) {
+		update.Error = fmt.Errorf("no working copy at %s (run mugi pull first)", path)
+
+		return update
+	}
+
+	var result git.Result
+
+	switch current := client.GetRemoteURL(ctx, path, UpstreamRemote); {
+	case current == "":
+		result = client.AddRemote(ctx, path, UpstreamRemote, repo.Upstream.URL)
+	case current != git.StripCredentials(repo.Upstream.URL):
+		result = client.SetRemoteURL(ctx, path, UpstreamRemote, repo.Upstream.URL)
+	}
+
+	if result.Error == nil {
+		result = client.WithCredentials(repo.Upstream.URL).Execute(ctx, remote.Fetch, path, UpstreamRemote, false)
+	}
+
+	if result.Error != nil {
+		update.Error = fmt.Errorf("%s", result.Output)
+
+		return update
+	}
+
+	branches := repo.Upstream.Branches
+
+	if len(branches) == 0 {
+		current := client.CurrentBranch(ctx, path)
+		if current == "" || current == "HEAD" {
+			update.Skip = "detached HEAD and no fork branches configured"
+
+			return update
+		}
+
+		branches = []string{current}
+	}
+
+	for _, branch := range branches {
+		update.Branches = append(update.Branches, forwardBranch(ctx, client, path, branch))
+	}
+
+	return update
+}
+
+func forwardBranch(ctx context.Context, client git.Client, path, branch string) BranchUpdate {
+	update := BranchUpdate{Branch: branch}
+
+	target := client.RevParse(ctx, path, "refs/remotes/"+UpstreamRemote+"/"+branch)
+	if target == "" {
+		update.Status = BranchMissing
+
+		return update
+	}
+
+	local := client.RevParse(ctx, path, "refs/heads/"+branch)
+	update.From, update.To = local, target
+
+	switch {
+	case local == target:
+		update.Status = BranchUpToDate
+
+		return update
+	case local == "":
+		update.Status = BranchCreated
+	case client.IsAncestor(ctx, path, target, local):
+		update.Status = BranchAhead
+
+		return update
+	case client.IsAncestor(ctx, path, local, target):
+		update.Status = BranchForwarded
+	default:
+		update.Status = BranchDiverged
+
+		return update
+	}
+
+	if result := client.FastForward(ctx, path, branch, target); result.Error != nil {
+		update.Status = BranchFailed
+		update.Output = result.Output
+	}
+
+	return update
+}
@@ -0,0 +1,126 @@
+package manage
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git/gittest"
+)
+
+const upstreamURL = "https://github.com/other/tool.git"
+
+func revParse(ref string) string {
+	return "git rev-parse --verify --quiet " + ref + "^{commit}"
+}
+
+func notAncestor(ancestor, descendant string) (string, gittest.Response) {
+	return "git merge-base --is-ancestor " + ancestor + " " + descendant, gittest.Response{Exit: 1}
+}
+
+func forkRepo(path string, branches ...string) config.Repo {
+	return config.Repo{Path: path, Upstream: &config.Upstream{URL: upstreamURL, Branches: branches}}
+}
+
+func TestUpdateFork(t *testing.T) {
+	path := t.TempDir()
+
+	fake := gittest.NewFake()
+	fake.On("git remote get-url upstream", gittest.Response{Stdout: upstreamURL + "\n"})
+	fake.On(revParse("refs/remotes/upstream/same"), gittest.Response{Stdout: "a1\n"})
+	fake.On(revParse("refs/heads/same"), gittest.Response{Stdout: "a1\n"})
+	fake.On(revParse("refs/remotes/upstream/behind"), gittest.Response{Stdout: "b2\n"})
+	fake.On(revParse("refs/heads/behind"), gittest.Response{Stdout: "b1\n"})
+	fake.On(notAncestor("b2", "b1"))
+	fake.On(revParse("refs/remotes/upstream/ahead"), gittest.Response{Stdout: "c1\n"})
+	fake.On(revParse("refs/heads/ahead"), gittest.Response{Stdout: "c2\n"})
+	fake.On(revParse("refs/remotes/upstream/split"), gittest.Response{Stdout: "d2\n"})
+	fake.On(revParse("refs/heads/split"), gittest.Response{Stdout: "d1\n"})
+	fake.On(notAncestor("d2", "d1"))
+	fake.On(notAncestor("d1", "d2"))
+	fake.On(revParse("refs/remotes/upstream/new"), gittest.Response{Stdout: "e1\n"})
+	fake.On("git rev-parse --abbrev-ref HEAD", gittest.Response{Stdout: "same\n"})
+
+	update := UpdateFork(context.Background(), fake, "ebisu/tool", forkRepo(path, "same", "behind", "ahead", "split", "new", "gone"))
+	if update.Error != nil || update.Skip != "" {
+		t.Fatalf("UpdateFork() error = %v, skip = %q", update.Error, update.Skip)
+	}
+
+	want := []BranchUpdate{
+		{Branch: "same", Status: BranchUpToDate, From: "a1", To: "a1"},
+		{Branch: "behind", Status: BranchForwarded, From: "b1", To: "b2"},
+		{Branch: "ahead", Status: BranchAhead, From: "c2", To: "c1"},
+		{Branch: "split", Status: BranchDiverged, From: "d1", To: "d2"},
+		{Branch: "new", Status: BranchCreated, To: "e1"},
+		{Branch: "gone", Status: BranchMissing},
+	}
+
+	if !reflect.DeepEqual(update.Branches, want) {
+		t.Errorf("branches = %+v, want %+v", update.Branches, want)
+	}
+
+	argv := fake.Argv()
+
+	for _, command := range []string{"git fetch upstream", "git update-ref refs/heads/behind b2", "git update-ref refs/heads/new e1"} {
+		if !slices.Contains(argv, command) {
+			t.Errorf("missing %q in %v", command, argv)
+		}
+	}
+
+	for _, command := range argv {
+		if command == "git update-ref refs/heads/split d2" || command == "git update-ref refs/heads/ahead c1" {
+			t.Errorf("unexpected %q", command)
+		}
+	}
+}
+
+func TestUpdateForkSkipsDetachedHead(t *testing.T) {
+	fake := gittest.NewFake()
+	fake.On("git remote get-url upstream", gittest.Response{Stdout: upstreamURL + "\n"})
+	fake.On("git rev-parse --abbrev-ref HEAD", gittest.Response{Stdout: "HEAD\n"})
+
+	update := UpdateFork(context.Background(), fake, "ebisu/tool", forkRepo(t.TempDir()))
+
+	if update.Skip == "" || len(update.Branches) != 0 {
+		t.Errorf("update = %+v, want a skip without branches", update)
+	}
+
+	if argv := fake.Argv(); slices.ContainsFunc(argv, func(command string) bool {
+		return command == revParse("refs/remotes/upstream/HEAD")
+	}) {
+		t.Errorf("detached HEAD was treated as a branch: %v", argv)
+	}
+}
+
+func TestPushable(t *testing.T) {
+	update := ForkUpdate{
+		Path: "/src/tool",
+		Branches: []BranchUpdate{
+			{Branch: "same", Status: BranchUpToDate, From: "a1", To: "a1"},
+			{Branch: "behind", Status: BranchForwarded, From: "b1", To: "b2"},
+			{Branch: "new", Status: BranchCreated, To: "e1"},
+			{Branch: "rewritten", Status: BranchUpToDate, From: "f1", To: "f1"},
+			{Branch: "ahead", Status: BranchAhead, From: "c2", To: "c1"},
+			{Branch: "split", Status: BranchDiverged, From: "d1", To: "d2"},
+			{Branch: "gone", Status: BranchMissing},
+		},
+	}
+
+	fake := gittest.NewFake()
+	fake.On(revParse("refs/remotes/github/same"), gittest.Response{Stdout: "a1\n"})
+	fake.On(revParse("refs/remotes/github/behind"), gittest.Response{Stdout: "b1\n"})
+	fake.On(revParse("refs/remotes/github/rewritten"), gittest.Response{Stdout: "f0\n"})
+	fake.On(notAncestor("f0", "f1"))
+
+	push, diverged := update.Pushable(context.Background(), fake, "github")
+
+	if want := []string{"behind", "new"}; !slices.Equal(push, want) {
+		t.Errorf("push = %v, want %v", push, want)
+	}
+
+	if want := []string{"rewritten"}; !slices.Equal(diverged, want) {
+		t.Errorf("diverged = %v, want %v", diverged, want)
+	}
+}
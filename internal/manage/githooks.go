@@ -0,0 +1,303 @@
+package manage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ebisu/mugi/internal/git"
+)
+
+const (
+	GitHookPostCommit           = "post-commit"
+	GitHookReferenceTransaction = "reference-transaction"
+)
+
+const (
+	GitHookInstalled = "installed"
+	GitHookUpdated   = "updated"
+	GitHookRemoved   = "removed"
+	GitHookSkipped   = "skipped"
+)
+
+const (
+	gitHookMarker  = "# Installed by mugi hooks install"
+	chainedSuffix  = ".mugi-chained"
+	queuePending   = "mugi-push.pending"
+	queueLock      = "mugi-push.lock"
+	queueLog       = "mugi-push.log"
+	queueLogLimit  = 1 << 20
+	staleQueueLock = 30 * time.Minute
+)
+
+var GitHooks = []string{GitHookPostCommit, GitHookReferenceTransaction}
+
+type GitHookChange struct {
+	Repo    string
+	Hook    string
+	Path    string
+	Status  string
+	Reason  string
+	Chained bool
+}
+
+func InstallGitHook(ctx context.Context, runner git.Runner, name, repoPath, hook, executable, configPath string) (GitHookChange, error) {
+	client := git.New(runner)
+	change := GitHookChange{Repo: name, Hook: hook, Status: GitHookSkipped}
+
+	if _, err := os.Stat(repoPath); err != nil {
+		change.Reason = "no working copy"
+
+		return change, nil
+	}
+
+	change.Path = client.GitPath(ctx, repoPath, "hooks/"+hook)
+	if change.Path == "" {
+		change.Reason = "not a git repository"
+
+		return change, nil
+	}
+
+	if hooksDir := filepath.Dir(change.Path); !within(client.CommonDir(ctx, repoPath), hooksDir) {
+		change.Reason = "core.hooksPath points outside the repository: " + hooksDir
+
+		return change, nil
+	}
+
+	for _, other := range GitHooks {
+		if other != hook {
+			if _, err := removeGitHook(client.GitPath(ctx, repoPath, "hooks/"+other)); err != nil {
+				return change, err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(change.Path), 0o755); err != nil {
+		return change, err
+	}
+
+	chained := change.Path + chainedSuffix
+	change.Status = GitHookInstalled
+
+	existing, err := os.ReadFile(change.Path)
+
+	switch {
+	case err == nil && isGitHook(existing):
+		change.Status = GitHookUpdated
+	case err == nil:
+		if _, err := os.Stat(chained); err == nil {
+			return change, fmt.Errorf("%s: both %s and %s exist", name, change.Path, chained)
+		}
+
+		if err := os.Rename(change.Path, chained); err != nil {
+			return change, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return change, err
+	}
+
+	if _, err := os.Stat(chained); err == nil {
+		change.Chained = true
+	}
+
+	script := gitHookScript(hook, name, executable, configPath)
+
+	if err := os.WriteFile(change.Path, []byte(script), 0o755); err != nil {
+		return change, err
+	}
+
+	return change, nil
+}
+
+func UninstallGitHooks(ctx context.Context, runner git.Runner, name, repoPath string) ([]GitHookChange, error) {
+	client := git.New(runner)
+	var changes []GitHookChange
+
+	if _, err := os.Stat(repoPath); err != nil {
+		return nil, nil
+	}
+
+	for _, hook := range GitHooks {
+		path := client.GitPath(ctx, repoPath, "hooks/"+hook)
+		if path == "" {
+			return nil, nil
+		}
+
+		change := GitHookChange{Repo: name, Hook: hook, Path: path, Status: GitHookRemoved}
+
+		removed, err := removeGitHook(path)
+		if err != nil {
+			return changes, err
+		}
+
+		if !removed {
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			change.Chained = true
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+func within(root, path string) bool {
+	if root == "" {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func removeGitHook(path string) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !isGitHook(existing)) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(path + chainedSuffix); err == nil {
+		if err := os.Rename(path+chainedSuffix, path); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+func isGitHook(script []byte) bool {
+	return strings.Contains(string(script), gitHookMarker)
+}
+
+func gitHookScript(hook, name, executable, configPath string) string {
+	var b strings.Builder
+
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString(gitHookMarker + "; remove with mugi hooks uninstall\n\n")
+
+	chain := `"$0` + chainedSuffix + `" "$@"`
+
+	if hook == GitHookReferenceTransaction {
+		b.WriteString("input=$(cat)\n\n")
+
+		chain = `printf '%s\n' "$input" | ` + chain
+	}
+
+	fmt.Fprintf(&b, "if [ -x \"$0%s\" ]; then\n\t%s || exit $?\nfi\n\n", chainedSuffix, chain)
+
+	if hook == GitHookReferenceTransaction {
+		b.WriteString("[ \"$1\" = committed ] || exit 0\n")
+		b.WriteString("printf '%s\\n' \"$input\" | grep -q ' refs/heads/' || exit 0\n\n")
+	}
+
+	argv := []string{executable}
+
+	if configPath != "" {
+		argv = append(argv, "-c", configPath)
+	}
+
+	argv = append(argv, "hooks", "run", name)
+
+	for i, arg := range argv {
+		argv[i] = shellQuote(arg)
+	}
+
+	fmt.Fprintf(&b, "(unset GIT_DIR GIT_WORK_TREE GIT_INDEX_FILE; exec %s) </dev/null >/dev/null 2>&1 &\n", strings.Join(argv, " "))
+
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func RunQueued(gitDir string, run func(io.Writer)) error {
+	pending := filepath.Join(gitDir, queuePending)
+	lock := filepath.Join(gitDir, queueLock)
+
+	if err := os.WriteFile(pending, nil, 0o644); err != nil {
+		return err
+	}
+
+	for {
+		if !acquireQueue(lock) {
+			return nil
+		}
+
+		for exists(pending) {
+			os.Remove(pending)
+
+			log, err := openQueueLog(filepath.Join(gitDir, queueLog))
+			if err != nil {
+				os.Remove(lock)
+
+				return err
+			}
+
+			fmt.Fprintf(log, "--- %s\n", time.Now().Format(time.RFC3339))
+			run(log)
+			log.Close()
+		}
+
+		os.Remove(lock)
+
+		if !exists(pending) {
+			return nil
+		}
+	}
+}
+
+func openQueueLog(path string) (*os.File, error) {
+	if info, err := os.Stat(path); err == nil && info.Size() > queueLogLimit {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return nil, err
+		}
+	}
+
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+}
+
+func acquireQueue(lock string) bool {
+	file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err == nil {
+		fmt.Fprintf(file, "%d\n", os.Getpid())
+		file.Close()
+
+		return true
+	}
+
+	if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleQueueLock {
+		if os.Remove(lock) == nil {
+			return acquireQueue(lock)
+		}
+	}
+
+	return false
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
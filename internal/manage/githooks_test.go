@@ -0,0 +1,112 @@
+package manage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/git/gittest"
+)
+
+func TestInstallGitHook(t *testing.T) {
+	tests := []struct {
+		name      string
+		hooksPath func(repo string) string
+		status    string
+		reason    string
+	}{
+		{
+			name:      "repository hooks",
+			hooksPath: func(repo string) string { return filepath.Join(repo, ".git", "hooks") },
+			status:    GitHookInstalled,
+		},
+		{
+			name:      "shared hooks path",
+			hooksPath: func(string) string { return filepath.Join(os.TempDir(), "shared-hooks") },
+			status:    GitHookSkipped,
+			reason:    "core.hooksPath points outside the repository",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			hooksDir := tt.hooksPath(repo)
+
+			fake := gittest.NewFake().
+				On("git rev-parse --git-common-dir", gittest.Response{Stdout: ".git\n"})
+
+			for _, hook := range GitHooks {
+				fake.On("git rev-parse --git-path hooks/"+hook, gittest.Response{Stdout: filepath.Join(hooksDir, hook) + "\n"})
+			}
+
+			change, err := InstallGitHook(context.Background(), fake, "ebisu/demo", repo, GitHookReferenceTransaction, "/usr/bin/mugi", "")
+			if err != nil {
+				t.Fatalf("InstallGitHook() error = %v", err)
+			}
+
+			if change.Status != tt.status || !strings.HasPrefix(change.Reason, tt.reason) {
+				t.Errorf("change = %+v, want status %s reason %q", change, tt.status, tt.reason)
+			}
+
+			_, err = os.Stat(filepath.Join(hooksDir, GitHookReferenceTransaction))
+			if written := err == nil; written != (tt.status == GitHookInstalled) {
+				t.Errorf("hook written = %v, want %v", written, tt.status == GitHookInstalled)
+			}
+		})
+	}
+}
+
+func TestReferenceTransactionScript(t *testing.T) {
+	script := gitHookScript(GitHookReferenceTransaction, "ebisu/demo", "/usr/bin/mugi", "")
+
+	if !strings.Contains(script, "grep -q ' refs/heads/' || exit 0\n") {
+		t.Errorf("script does not filter on refs/heads:\n%s", script)
+	}
+
+	if strings.Contains(script, "refs/tags") {
+		t.Errorf("script reacts to tag updates:\n%s", script)
+	}
+
+	if !strings.Contains(script, "exec '/usr/bin/mugi' 'hooks' 'run' 'ebisu/demo'") {
+		t.Errorf("script does not run the queued push:\n%s", script)
+	}
+}
+
+func TestRunQueuedAppendsLog(t *testing.T) {
+	gitDir := t.TempDir()
+
+	for _, output := range []string{"first\n", "second\n"} {
+		if err := RunQueued(gitDir, func(log io.Writer) { io.WriteString(log, output) }); err != nil {
+			t.Fatalf("RunQueued() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(gitDir, queueLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if log := string(data); strings.Count(log, "--- ") != 2 || !strings.Contains(log, "first\n") || !strings.Contains(log, "second\n") {
+		t.Errorf("log = %q, want both runs", log)
+	}
+
+	if err := os.WriteFile(filepath.Join(gitDir, queueLog), make([]byte, queueLogLimit+1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunQueued(gitDir, func(log io.Writer) { io.WriteString(log, "third\n") }); err != nil {
+		t.Fatalf("RunQueued() error = %v", err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(gitDir, queueLog)); !strings.HasSuffix(string(data), "third\n") || len(data) > 100 {
+		t.Errorf("log after rotation = %q, want only the latest run", data)
+	}
+
+	if _, err := os.Stat(filepath.Join(gitDir, queueLog+".1")); err != nil {
+		t.Errorf("rotated log missing: %v", err)
+	}
+}
@@ -1,13 +1,18 @@
 package manage
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/giturl"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,22 +22,132 @@ type RepoInfo struct {
 	Remotes map[string]string
 }
 
-func Add(path, configPath string, remoteDefs map[string]config.RemoteDefinition) error {
+type RemoteSuggestion struct {
+	Name     string
+	URL      string
+	Template string
+}
+
+type Candidate struct {
+	Info        RepoInfo
+	Suggestions []RemoteSuggestion
+	entry       *yaml.Node
+}
+
+const ImportRemote = "origin"
+
+var skipDirs = []string{".git", ".cache", ".cargo", ".npm", ".rustup", ".gradle", ".m2", ".venv", ".Trash", "node_modules"}
+
+type remoteMatch struct {
+	Definition string
+	User       string
+	Repo       string
+	URL        string
+}
+
+type discovery struct {
+	path      string
+	matches   map[string]remoteMatch
+	unmatched map[string]string
+	upstream  string
+}
+
+func Add(ctx context.Context, runner git.Runner, path, configPath string, cfg config.Config) (RepoInfo, []RemoteSuggestion, error) {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
+		return RepoInfo{}, nil, fmt.Errorf("invalid path: %w", err)
 	}
 
-	if !isGitRepo(absPath) {
-		return fmt.Errorf("not a git repository: %s", absPath)
+	client := git.New(runner)
+
+	if !client.IsRepo(ctx, absPath) {
+		return RepoInfo{}, nil, fmt.Errorf("not a git repository: %s", absPath)
 	}
 
-	info, err := extractRepoInfo(absPath, remoteDefs)
+	info, entry, suggestions, err := extractRepoInfo(ctx, client, absPath, cfg)
 	if err != nil {
-		return err
+		return RepoInfo{}, nil, err
+	}
+
+	if _, exists := cfg.Repos[info.Name]; exists {
+		return info, nil, fmt.Errorf("repository already tracked: %s", info.Name)
+	}
+
+	if err := appendToConfig(configPath, Candidate{Info: info, entry: entry}); err != nil {
+		return info, nil, err
+	}
+
+	return info, suggestions, nil
+}
+
+func Scan(ctx context.Context, runner git.Runner, root string, depth int, cfg config.Config) ([]Candidate, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+
+	paths, err := findRepos(absRoot, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+
+	client := git.New(runner)
+	seen := make(map[string]bool)
+
+	for _, path := range paths {
+		if _, _, tracked := cfg.FindRepoByPath(path); tracked {
+			continue
+		}
+
+		info, entry, suggestions, err := extractRepoInfo(ctx, client, path, cfg)
+		if err != nil {
+			continue
+		}
+
+		if _, exists := cfg.Repos[info.Name]; exists || seen[info.Name] {
+			continue
+		}
+
+		seen[info.Name] = true
+
+		candidates = append(candidates, Candidate{
+			Info:        info,
+			Suggestions: suggestions,
+			entry:       entry,
+		})
+	}
+
+	return candidates, nil
+}
+
+func AddCandidates(configPath string, candidates []Candidate) error {
+	if len(candidates) == 0 {
+		return nil
 	}
 
-	return appendToConfig(configPath, info)
+	return appendToConfig(configPath, candidates...)
+}
+
+func ImportCandidate(name, remote, cloneURL string, cfg config.Config) (Candidate, error) {
+	candidate := Candidate{
+		Info:  RepoInfo{Name: name, Remotes: make(map[string]string)},
+		entry: &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle},
+	}
+
+	switch {
+	case remote != "" && slices.Contains(cfg.Defaults.Remotes, remote):
+	case remote != "":
+		appendPair(candidate.entry, "remotes", stringSequence([]string{remote}))
+	case cloneURL == "":
+		return Candidate{}, fmt.Errorf("%s: no remote matches the source and the forge reported no clone URL", name)
+	default:
+		appendPair(candidate.entry, "remotes", stringSequence([]string{ImportRemote}))
+		appendPair(candidate.entry, ImportRemote, scalarNode(cloneURL))
+	}
+
+	return candidate, nil
 }
 
 func Remove(name, configPath string) error {
@@ -68,42 +183,392 @@ func List(configPath string) ([]RepoInfo, error) {
 	return repos, nil
 }
 
-func isGitRepo(path string) bool {
-	cmd := exec.Command("git", "rev-parse", "--git-dir")
-	cmd.Dir = path
+func findRepos(root string, depth int) ([]string, error) {
+	var repos []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+
+			return fs.SkipDir
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if path != root && slices.Contains(skipDirs, entry.Name()) {
+			return fs.SkipDir
+		}
+
+		if isRepoDir(path) {
+			repos = append(repos, path)
+
+			return fs.SkipDir
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if relative != "." && strings.Count(relative, string(filepath.Separator))+1 >= depth {
+			return fs.SkipDir
+		}
+
+		return nil
+	})
+
+	return repos, err
+}
+
+func isRepoDir(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		return true
+	}
+
+	for _, name := range []string{"objects", "refs"} {
+		if info, err := os.Stat(filepath.Join(path, name)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(path, "HEAD"))
+
+	return err == nil && !info.IsDir()
+}
+
+func extractRepoInfo(ctx context.Context, client git.Client, path string, cfg config.Config) (RepoInfo, *yaml.Node, []RemoteSuggestion, error) {
+	found, err := discoverRemotes(ctx, client, path, cfg.Remotes)
+	if err != nil {
+		return RepoInfo{}, nil, nil, err
+	}
+
+	info, entry := compactEntry(found, cfg)
+
+	return info, entry, suggestRemotes(found.unmatched, info.Name), nil
+}
+
+func discoverRemotes(ctx context.Context, client git.Client, path string, remoteDefs map[string]config.RemoteDefinition) (discovery, error) {
+	out, err := client.Remotes(ctx, path)
+	if err != nil {
+		return discovery{path: path}, fmt.Errorf("failed to get remotes: %w", err)
+	}
+
+	return classifyRemotes(path, parseRemotes(out), remoteDefs, giturl.LoadRewrites(ctx, client, path)), nil
+}
+
+func classifyRemotes(path string, remotes map[string]string, remoteDefs map[string]config.RemoteDefinition, rewrites giturl.Rewrites) discovery {
+	found := discovery{
+		path:      path,
+		matches:   make(map[string]remoteMatch),
+		unmatched: make(map[string]string),
+	}
+
+	names := slices.Collect(maps.Keys(remotes))
+
+	sortByPreference(names, []string{"origin"})
+
+	for _, remoteName := range names {
+		url := remotes[remoteName]
+
+		if remoteName == UpstreamRemote {
+			found.upstream = url
+
+			continue
+		}
 
-	return cmd.Run() == nil
+		if config.IsRepoKey(remoteName) {
+			continue
+		}
+
+		if match, ok := matchRemoteURL(url, remoteDefs, rewrites); ok {
+			if _, seen := found.matches[match.Definition]; !seen {
+				found.matches[match.Definition] = match
+			}
+		} else {
+			found.unmatched[remoteName] = url
+		}
+	}
+
+	return found
 }
 
-func extractRepoInfo(path string, remoteDefs map[string]config.RemoteDefinition) (RepoInfo, error) {
+func compactEntry(found discovery, cfg config.Config) (RepoInfo, *yaml.Node) {
+	user, repoName := canonicalName(found, cfg.Defaults.Remotes)
 	info := RepoInfo{
-		Path:    path,
+		Name:    repoName,
+		Path:    found.path,
 		Remotes: make(map[string]string),
 	}
 
-	cmd := exec.Command("git", "remote", "-v")
-	cmd.Dir = path
+	if user != "" {
+		info.Name = user + "/" + repoName
+	}
+
+	entry := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+
+	remoteNames := make([]string, 0, len(found.matches)+len(found.unmatched))
+
+	for name := range found.matches {
+		remoteNames = append(remoteNames, name)
+	}
+
+	for name := range found.unmatched {
+		remoteNames = append(remoteNames, name)
+	}
+
+	sortByPreference(remoteNames, cfg.Defaults.Remotes)
+
+	if len(found.unmatched) > 0 || !sameSet(remoteNames, cfg.Defaults.Remotes) {
+		appendPair(entry, "remotes", stringSequence(remoteNames))
+	}
+
+	for _, name := range remoteNames {
+		if url, ok := found.unmatched[name]; ok {
+			appendPair(entry, name, scalarNode(url))
+
+			info.Remotes[name] = url
+
+			continue
+		}
+
+		match := found.matches[name]
+		override := &yaml.Node{Kind: yaml.MappingNode}
+
+		if match.User != "" && match.User != user {
+			appendPair(override, "user", scalarNode(match.User))
+		}
+
+		if match.Repo != "" && match.Repo != repoName {
+			appendPair(override, "repo", scalarNode(match.Repo))
+		}
+
+		if len(override.Content) > 0 {
+			appendPair(entry, name, override)
+		}
+
+		info.Remotes[name] = match.URL
+	}
+
+	host := ""
+
+	for _, name := range remoteNames {
+		if url, err := giturl.Parse(info.Remotes[name]); err == nil {
+			host = url.Host
+
+			break
+		}
+	}
+
+	if found.upstream != "" {
+		fork := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+		appendPair(fork, "upstream", scalarNode(found.upstream))
+		appendPair(entry, "fork", fork)
+	}
+
+	if !isDefaultPath(found.path, info.Name, host, cfg.Defaults) {
+		entry.Content = append([]*yaml.Node{scalarNode("path"), scalarNode(found.path)}, entry.Content...)
+	}
+
+	if len(entry.Content) > 0 {
+		entry.Style = 0
+	}
+
+	return info, entry
+}
+
+func canonicalName(found discovery, preferred []string) (user, repo string) {
+	names := make([]string, 0, len(found.matches))
+
+	for name := range found.matches {
+		names = append(names, name)
+	}
 
-	out, err := cmd.Output()
+	sortByPreference(names, preferred)
+
+	for _, name := range names {
+		match := found.matches[name]
+
+		if match.Repo == "" {
+			continue
+		}
+
+		if repo == "" {
+			user, repo = match.User, match.Repo
+		}
+
+		if user == "" && match.User != "" && match.Repo == repo {
+			user = match.User
+		}
+	}
+
+	if repo != "" {
+		return user, repo
+	}
+
+	inferred := inferRepoName(found.path, found.unmatched)
+
+	if u, r, ok := strings.Cut(inferred, "/"); ok {
+		return u, r
+	}
+
+	return "", inferred
+}
+
+func isDefaultPath(path, name, host string, defaults config.Defaults) bool {
+	templatePath, err := defaults.RepoPath(name, host, nil)
+	if err != nil || templatePath == "" {
+		return false
+	}
+
+	defaultPath, err := filepath.Abs(config.Repo{Path: templatePath}.ExpandPath())
 	if err != nil {
-		return info, fmt.Errorf("failed to get remotes: %w", err)
+		return false
 	}
 
-	remoteURLs := parseRemotes(string(out))
+	return defaultPath == path
+}
 
-	for remoteName, url := range remoteURLs {
-		knownRemote := matchRemoteURL(url, remoteDefs)
+func sortByPreference(names, preferred []string) {
+	rank := func(name string) int {
+		if i := slices.Index(preferred, name); i != -1 {
+			return i
+		}
 
-		if knownRemote != "" {
-			info.Remotes[knownRemote] = url
-		} else {
-			info.Remotes[remoteName] = url
+		return len(preferred)
+	}
+
+	slices.SortFunc(names, func(a, b string) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+
+		return strings.Compare(a, b)
+	})
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, name := range a {
+		if !slices.Contains(b, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func suggestRemotes(unmatched map[string]string, repoName string) []RemoteSuggestion {
+	var suggestions []RemoteSuggestion
+
+	if !strings.Contains(repoName, "/") {
+		return nil
+	}
+
+	for name, url := range unmatched {
+		if extractRepoNameFromURL(url) != repoName {
+			continue
+		}
+
+		i := strings.LastIndex(url, repoName)
+		template := url[:i] + "${user}/${repo}" + url[i+len(repoName):]
+
+		suggestions = append(suggestions, RemoteSuggestion{
+			Name:     name,
+			URL:      url,
+			Template: template,
+		})
+	}
+
+	slices.SortFunc(suggestions, func(a, b RemoteSuggestion) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return suggestions
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func appendPair(mapping *yaml.Node, key string, value *yaml.Node) {
+	mapping.Content = append(mapping.Content, scalarNode(key), value)
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func removeKey(mapping *yaml.Node, key string) bool {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return false
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func renameKey(mapping *yaml.Node, oldKey, newKey string) bool {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return false
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == oldKey {
+			mapping.Content[i].Value = newKey
+
+			return true
 		}
 	}
 
-	info.Name = inferRepoName(path, remoteURLs)
+	return false
+}
+
+func stringSequence(values []string) *yaml.Node {
+	sequence := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+
+	for _, value := range values {
+		sequence.Content = append(sequence.Content, scalarNode(value))
+	}
 
-	return info, nil
+	return sequence
+}
+
+func sequenceValues(sequence *yaml.Node) []string {
+	if sequence == nil || sequence.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	values := make([]string, 0, len(sequence.Content))
+
+	for _, item := range sequence.Content {
+		values = append(values, item.Value)
+	}
+
+	return values
 }
 
 func parseRemotes(output string) map[string]string {
@@ -124,25 +589,41 @@ func parseRemotes(output string) map[string]string {
 	return remotes
 }
 
-func matchRemoteURL(url string, remoteDefs map[string]config.RemoteDefinition) string {
-	for name, def := range remoteDefs {
-		template := def.URL
+func matchRemoteURL(rawURL string, remoteDefs map[string]config.RemoteDefinition, rewrites giturl.Rewrites) (remoteMatch, bool) {
+	url, err := giturl.Parse(rewrites.Apply(rawURL))
+	if err != nil {
+		return remoteMatch{}, false
+	}
 
-		if template == "" {
+	names := make([]string, 0, len(remoteDefs))
+
+	for name := range remoteDefs {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		if remoteDefs[name].URL == "" {
 			continue
 		}
 
-		pattern := strings.ReplaceAll(template, "${user}", "")
-		pattern = strings.ReplaceAll(pattern, "${repo}", "")
-
-		base := strings.Split(pattern, ":")[0]
+		template, err := giturl.CompileTemplate(rewrites.Apply(remoteDefs[name].URL))
+		if err != nil {
+			continue
+		}
 
-		if strings.Contains(url, base) || strings.Contains(url, name) {
-			return name
+		if values, ok := template.Match(url); ok {
+			return remoteMatch{
+				Definition: name,
+				User:       values["user"],
+				Repo:       values["repo"],
+				URL:        rawURL,
+			}, true
 		}
 	}
 
-	return ""
+	return remoteMatch{}, false
 }
 
 func inferRepoName(path string, remotes map[string]string) string {
@@ -154,117 +635,123 @@ func inferRepoName(path string, remotes map[string]string) string {
 		}
 	}
 
-	return filepath.Base(path)
+	return strings.TrimSuffix(filepath.Base(path), ".git")
 }
 
-func extractRepoNameFromURL(url string) string {
-	url = strings.TrimSuffix(url, ".git")
-
-	if strings.Contains(url, ":") {
-		parts := strings.Split(url, ":")
-
-		if len(parts) == 2 {
-			return strings.TrimPrefix(parts[1], "~")
-		}
-	}
-
-	if strings.Contains(url, "/") {
-		parts := strings.Split(url, "/")
-
-		if len(parts) >= 2 {
-			return parts[len(parts)-2] + "/" + parts[len(parts)-1]
-		}
+func extractRepoNameFromURL(rawURL string) string {
+	url, err := giturl.Parse(rawURL)
+	if err != nil {
+		return ""
 	}
 
-	return ""
+	return url.RepoName()
 }
 
-func appendToConfig(configPath string, info RepoInfo) error {
-	data, err := os.ReadFile(configPath)
+func appendToConfig(configPath string, candidates ...Candidate) error {
+	raw, err := readConfig(configPath)
 	if err != nil {
 		return err
 	}
 
-	var raw map[string]yaml.Node
-
-	if err := yaml.Unmarshal(data, &raw); err != nil {
-		return err
-	}
-
 	reposNode, ok := raw["repos"]
 	if !ok {
 		return fmt.Errorf("repos section not found in config")
 	}
 
-	repoEntry := map[string]any{
-		"path":    info.Path,
-		"remotes": info.Remotes,
+	if reposNode.Kind == yaml.ScalarNode && reposNode.Tag == "!!null" {
+		reposNode = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
 	}
 
-	entryBytes, err := yaml.Marshal(map[string]any{info.Name: repoEntry})
-	if err != nil {
-		return err
+	if reposNode.Kind != yaml.MappingNode {
+		return fmt.Errorf("repos section is not a mapping")
 	}
 
-	var entryNode yaml.Node
+	for _, candidate := range candidates {
+		reposNode.Content = append(reposNode.Content, scalarNode(candidate.Info.Name), candidate.entry)
+	}
+
+	raw["repos"] = reposNode
 
-	if err := yaml.Unmarshal(entryBytes, &entryNode); err != nil {
+	return writeConfig(configPath, raw)
+}
+
+func removeFromConfig(configPath, name string) error {
+	raw, err := readConfig(configPath)
+	if err != nil {
 		return err
 	}
 
-	if reposNode.Kind == yaml.MappingNode && len(entryNode.Content) > 0 && len(entryNode.Content[0].Content) >= 2 {
-		reposNode.Content = append(reposNode.Content, entryNode.Content[0].Content...)
-		raw["repos"] = reposNode
+	reposNode, ok := raw["repos"]
+	if !ok {
+		return fmt.Errorf("repos section not found in config")
 	}
 
-	output, err := yaml.Marshal(raw)
-	if err != nil {
-		return err
+	if reposNode.Kind != yaml.MappingNode {
+		return fmt.Errorf("repos section is not a mapping")
+	}
+
+	if !removeKey(&reposNode, name) {
+		return fmt.Errorf("repository %s is not defined in %s", name, configPath)
 	}
 
-	return os.WriteFile(configPath, output, 0o644)
+	raw["repos"] = reposNode
+
+	return writeConfig(configPath, raw)
 }
 
-func removeFromConfig(configPath, name string) error {
+func readConfig(configPath string) (map[string]yaml.Node, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var raw map[string]yaml.Node
 
 	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	if raw == nil {
+		raw = make(map[string]yaml.Node)
+	}
+
+	return raw, nil
+}
+
+func writeConfig(configPath string, raw map[string]yaml.Node) error {
+	output, err := yaml.Marshal(raw)
+	if err != nil {
 		return err
 	}
 
-	reposNode, ok := raw["repos"]
-	if !ok {
-		return fmt.Errorf("repos section not found in config")
+	mode := fs.FileMode(0o644)
+
+	if info, err := os.Stat(configPath); err == nil {
+		mode = info.Mode().Perm()
 	}
 
-	if reposNode.Kind != yaml.MappingNode {
-		return fmt.Errorf("repos section is not a mapping")
+	temp, err := os.CreateTemp(filepath.Dir(configPath), ".config-*.yaml")
+	if err != nil {
+		return err
 	}
 
-	var newContent []*yaml.Node
+	defer os.Remove(temp.Name())
 
-	for i := 0; i < len(reposNode.Content); i += 2 {
-		if i+1 >= len(reposNode.Content) {
-			break
-		}
+	if _, err := temp.Write(output); err != nil {
+		temp.Close()
 
-		if reposNode.Content[i].Value != name {
-			newContent = append(newContent, reposNode.Content[i], reposNode.Content[i+1])
-		}
+		return err
 	}
 
-	reposNode.Content = newContent
-	raw["repos"] = reposNode
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
 
-	output, err := yaml.Marshal(raw)
-	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, output, 0o644)
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), configPath)
 }
@@ -0,0 +1,356 @@
+package manage
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git/gittest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFindRepos(t *testing.T) {
+	root := t.TempDir()
+
+	mkdir := func(parts ...string) {
+		t.Helper()
+
+		if err := os.MkdirAll(filepath.Join(append([]string{root}, parts...)...), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bare := func(parts ...string) {
+		t.Helper()
+
+		mkdir(append(parts, "objects")...)
+		mkdir(append(parts, "refs")...)
+
+		if err := os.WriteFile(filepath.Join(append(append([]string{root}, parts...), "HEAD")...), []byte("ref: refs/heads/main\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mkdir("work", "app", ".git")
+	bare(".dotfiles")
+	bare("mirrors", "tool.git")
+	mkdir(".cache", "vendored", ".git")
+	mkdir("work", "web", "node_modules", "dep", ".git")
+
+	repos, err := findRepos(root, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, repo := range repos {
+		repos[i], _ = filepath.Rel(root, repo)
+	}
+
+	slices.Sort(repos)
+
+	want := []string{".dotfiles", "mirrors/tool.git", "work/app"}
+
+	if !slices.Equal(repos, want) {
+		t.Errorf("findRepos() = %q, want %q", repos, want)
+	}
+}
+
+const discoveryConfig = `remotes:
+  github:
+    url: git@github.com:${user}/${repo}.git
+  codeberg:
+    url: git@codeberg.org:${user}/${repo}.git
+defaults:
+  remotes: [github, codeberg]
+repos:
+`
+
+const insteadOf = `git config --get-regexp ^url\..*\.insteadof$`
+
+func loadDiscoveryConfig(t *testing.T) (string, config.Config) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(path, []byte(discoveryConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path, cfg
+}
+
+func remoteList(remotes ...string) string {
+	var out string
+
+	for i := 0; i < len(remotes); i += 2 {
+		out += remotes[i] + "\t" + remotes[i+1] + " (fetch)\n" + remotes[i] + "\t" + remotes[i+1] + " (push)\n"
+	}
+
+	return out
+}
+
+func TestAddDiscoversRemotesThroughRunner(t *testing.T) {
+	configPath, cfg := loadDiscoveryConfig(t)
+	path := t.TempDir()
+
+	fake := gittest.NewFake()
+	fake.OnDir(path, "git remote -v", gittest.Response{Stdout: remoteList("origin", "gh:ebisu/tool.git", "backup", "git@codeberg.org:ebisu/tool.git", "mirror", "https://example.com/ebisu/tool.git")})
+	fake.OnDir(path, insteadOf, gittest.Response{Stdout: "url.git@github.com:.insteadof gh:\n"})
+
+	info, suggestions, err := Add(context.Background(), fake, path, configPath, cfg)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if info.Name != "ebisu/tool" || info.Path != path {
+		t.Errorf("Add() = %+v, want ebisu/tool at %s", info, path)
+	}
+
+	if len(suggestions) != 1 || suggestions[0].Name != "mirror" {
+		t.Errorf("suggestions = %+v, want mirror", suggestions)
+	}
+
+	want := []string{"git rev-parse --git-dir", "git remote -v", insteadOf}
+	if got := fake.Argv(); !slices.Equal(got, want) {
+		t.Errorf("git calls = %q, want %q", got, want)
+	}
+
+	for _, call := range fake.Calls() {
+		if call.Dir != path {
+			t.Errorf("%q ran in %s, want %s", call.Argv, call.Dir, path)
+		}
+	}
+
+	saved, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, ok := saved.Repos["ebisu/tool"]
+	if !ok {
+		t.Fatal("ebisu/tool missing from config after Add()")
+	}
+
+	if repo.Remotes["mirror"] != "https://example.com/ebisu/tool.git" {
+		t.Errorf("remotes = %v, want mirror kept verbatim", repo.Remotes)
+	}
+}
+
+func TestAddRejectsNonRepository(t *testing.T) {
+	configPath, cfg := loadDiscoveryConfig(t)
+
+	fake := gittest.NewFake()
+	fake.On("git rev-parse --git-dir", gittest.Response{Stderr: "fatal: not a git repository", Exit: 128})
+
+	if _, _, err := Add(context.Background(), fake, t.TempDir(), configPath, cfg); err == nil {
+		t.Fatal("Add() error = nil, want not a git repository")
+	}
+
+	if got := fake.Argv(); len(got) != 1 {
+		t.Errorf("git calls = %q, want only the repository check", got)
+	}
+}
+
+func TestScanDiscoversRemotesThroughRunner(t *testing.T) {
+	_, cfg := loadDiscoveryConfig(t)
+	root := t.TempDir()
+
+	for _, name := range []string{"app", "broken", "fork"} {
+		if err := os.MkdirAll(filepath.Join(root, name, ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := gittest.NewFake()
+	fake.OnDir(filepath.Join(root, "app"), "git remote -v", gittest.Response{Stdout: remoteList("origin", "git@github.com:ebisu/app.git")})
+	fake.OnDir(filepath.Join(root, "broken"), "git remote -v", gittest.Response{Stderr: "fatal: not a git repository", Exit: 128})
+	fake.OnDir(filepath.Join(root, "fork"), "git remote -v", gittest.Response{Stdout: remoteList("origin", "git@codeberg.org:ebisu/app.git")})
+
+	candidates, err := Scan(context.Background(), fake, root, 2, cfg)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	if len(candidates) != 1 || candidates[0].Info.Name != "ebisu/app" || candidates[0].Info.Path != filepath.Join(root, "app") {
+		t.Errorf("Scan() = %+v, want only ebisu/app", candidates)
+	}
+}
+
+func TestCompactEntryForkAndRepoKeys(t *testing.T) {
+	configPath, cfg := loadDiscoveryConfig(t)
+
+	remotes := map[string]string{
+		"origin":   "git@github.com:ebisu/tool.git",
+		"upstream": "git@github.com:other/tool.git",
+		"path":     "https://example.com/ebisu/tool.git",
+		"vendor":   "https://vendor.example/archive/tool-src.git",
+	}
+
+	info, entry := compactEntry(classifyRemotes("/src/tool", remotes, cfg.Remotes, nil), cfg)
+
+	out, err := yaml.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `path: /src/tool
+remotes: [github, vendor]
+vendor: https://vendor.example/archive/tool-src.git
+fork: {upstream: 'git@github.com:other/tool.git'}
+`
+
+	if string(out) != want {
+		t.Errorf("entry =\n%s\nwant\n%s", out, want)
+	}
+
+	if err := AddCandidates(configPath, []Candidate{{Info: info, entry: entry}}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := saved.Repos["ebisu/tool"]
+
+	if repo.Upstream == nil || repo.Upstream.URL != remotes["upstream"] {
+		t.Errorf("upstream = %+v, want %s", repo.Upstream, remotes["upstream"])
+	}
+
+	if got := slices.Sorted(maps.Keys(repo.Remotes)); !slices.Equal(got, []string{"github", "vendor"}) {
+		t.Errorf("remotes = %v, want github and vendor only", repo.Remotes)
+	}
+}
+
+func TestSuggestRemotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		repo     string
+		template string
+	}{
+		{"user and repo", "https://example.com/ebisu/tool.git", "ebisu/tool", "https://example.com/${user}/${repo}.git"},
+		{"scp", "git@git.example.com:ebisu/tool", "ebisu/tool", "git@git.example.com:${user}/${repo}"},
+		{"other project", "https://github.com/other/fork.git", "ebisu/fork", ""},
+		{"no user", "https://example.com/tool.git", "tool", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestions := suggestRemotes(map[string]string{"mirror": tt.url}, tt.repo)
+
+			if tt.template == "" {
+				if len(suggestions) != 0 {
+					t.Errorf("suggestRemotes() = %+v, want none", suggestions)
+				}
+
+				return
+			}
+
+			if len(suggestions) != 1 || suggestions[0].Template != tt.template {
+				t.Errorf("suggestRemotes() = %+v, want %s", suggestions, tt.template)
+			}
+		})
+	}
+}
+
+func TestImportCandidate(t *testing.T) {
+	configPath, cfg := loadDiscoveryConfig(t)
+
+	tests := []struct {
+		name     string
+		repo     string
+		remote   string
+		cloneURL string
+		want     string
+		remotes  map[string]string
+	}{
+		{
+			name:    "default remote",
+			repo:    "ebisu/tool",
+			remote:  "github",
+			want:    "{}\n",
+			remotes: map[string]string{"github": "git@github.com:ebisu/tool.git", "codeberg": "git@codeberg.org:ebisu/tool.git"},
+		},
+		{
+			name:    "configured remote outside defaults",
+			repo:    "ebisu/other",
+			remote:  "codeberg",
+			want:    "{remotes: [codeberg]}\n",
+			remotes: map[string]string{"codeberg": "git@codeberg.org:ebisu/other.git"},
+		},
+		{
+			name:     "unconfigured forge",
+			repo:     "org/service",
+			cloneURL: "https://git.example.com/org/service.git",
+			want:     "{remotes: [origin], origin: 'https://git.example.com/org/service.git'}\n",
+			remotes:  map[string]string{"origin": "https://git.example.com/org/service.git"},
+		},
+	}
+
+	cfg.Defaults.Remotes = []string{"github"}
+
+	var candidates []Candidate
+
+	for _, tt := range tests {
+		candidate, err := ImportCandidate(tt.repo, tt.remote, tt.cloneURL, cfg)
+		if err != nil {
+			t.Fatalf("%s: ImportCandidate() error = %v", tt.name, err)
+		}
+
+		out, err := yaml.Marshal(candidate.entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(out) != tt.want {
+			t.Errorf("%s: entry = %s, want %s", tt.name, out, tt.want)
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if _, err := ImportCandidate("org/empty", "", "", cfg); err == nil {
+		t.Error("ImportCandidate() without remote or clone URL succeeded")
+	}
+
+	if err := AddCandidates(configPath, candidates); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		if got := saved.Repos[tt.repo].Remotes; !maps.Equal(got, tt.remotes) {
+			t.Errorf("%s: remotes = %v, want %v", tt.name, got, tt.remotes)
+		}
+	}
+}
+
+func TestMatchRemoteURLFilteredTemplate(t *testing.T) {
+	remoteDefs := map[string]config.RemoteDefinition{
+		"sourcehut": {URL: "git@git.sr.ht:~${user}/${repo|lower}"},
+	}
+
+	match, ok := matchRemoteURL("git@git.sr.ht:~ebisu/windmark", remoteDefs, nil)
+	if !ok {
+		t.Fatal("matchRemoteURL() found no match")
+	}
+
+	if match.Definition != "sourcehut" || match.User != "ebisu" || match.Repo != "windmark" {
+		t.Errorf("matchRemoteURL() = %+v, want sourcehut ebisu/windmark", match)
+	}
+}
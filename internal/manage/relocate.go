@@ -0,0 +1,164 @@
+package manage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/giturl"
+	"github.com/ebisu/mugi/internal/remote"
+)
+
+type Move struct {
+	Repo  string
+	From  string
+	To    string
+	Error error
+}
+
+func Relocate(ctx context.Context, runner git.Runner, cfg config.Config, name, from string, dryRun bool) ([]Move, error) {
+	if from == "" {
+		from = cfg.Defaults.PathPrefix
+	}
+
+	if from == "" {
+		return nil, fmt.Errorf("no previous path prefix to relocate from (set --from)")
+	}
+
+	names := sortedRepoNames(cfg)
+	claims := make(map[string][]string)
+
+	for _, repoName := range names {
+		if source := legacySource(cfg, repoName, from); source != "" {
+			claims[source] = append(claims[source], repoName)
+		}
+	}
+
+	if name != remote.All {
+		fullName, _, found := cfg.FindRepo(name)
+		if !found {
+			return nil, fmt.Errorf("repository not found: %s", name)
+		}
+
+		names = []string{fullName}
+	}
+
+	client := git.New(runner)
+
+	var moves []Move
+
+	for _, repoName := range names {
+		source := legacySource(cfg, repoName, from)
+		if source == "" {
+			continue
+		}
+
+		destination := cfg.Repos[repoName].ExpandPath()
+
+		if filepath.Clean(source) == filepath.Clean(destination) {
+			continue
+		}
+
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+
+		move := Move{Repo: repoName, From: source, To: destination}
+
+		if claimants := claims[source]; len(claimants) > 1 {
+			owner, err := cloneOwner(ctx, client, cfg, source, claimants)
+
+			switch {
+			case err != nil && repoName != claimants[0]:
+				continue
+			case err != nil:
+				move.Error = err
+			case owner != repoName:
+				continue
+			}
+		}
+
+		if !dryRun && move.Error == nil {
+			move.Error = moveDirectory(source, destination)
+		}
+
+		moves = append(moves, move)
+	}
+
+	return moves, nil
+}
+
+func legacySource(cfg config.Config, name, from string) string {
+	if cfg.Repos[name].Sources["path"] != config.SourceDefault {
+		return ""
+	}
+
+	legacy := config.Defaults{PathPrefix: from}.LegacyPath(name)
+
+	return config.Repo{Path: legacy}.ExpandPath()
+}
+
+func cloneOwner(ctx context.Context, client git.Client, cfg config.Config, path string, claimants []string) (string, error) {
+	out, err := client.Remotes(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("%s is claimed by %s and its remotes cannot be read: %w", path, strings.Join(claimants, " and "), err)
+	}
+
+	var urls []giturl.URL
+
+	for _, raw := range parseRemotes(out) {
+		if url, err := giturl.Parse(raw); err == nil {
+			urls = append(urls, url)
+		}
+	}
+
+	var owners []string
+
+	for _, name := range claimants {
+		if sharesRemote(urls, cfg.Repos[name].Remotes) {
+			owners = append(owners, name)
+		}
+	}
+
+	switch len(owners) {
+	case 1:
+		return owners[0], nil
+	case 0:
+		return "", fmt.Errorf("%s is claimed by %s but its remotes match none of them", path, strings.Join(claimants, " and "))
+	default:
+		return "", fmt.Errorf("%s is claimed by %s and its remotes match more than one", path, strings.Join(owners, " and "))
+	}
+}
+
+func sharesRemote(urls []giturl.URL, remotes config.RepoRemotes) bool {
+	for _, raw := range remotes {
+		expected, err := giturl.Parse(git.StripCredentials(raw))
+		if err != nil {
+			continue
+		}
+
+		for _, url := range urls {
+			if strings.EqualFold(url.Host, expected.Host) && url.RepoPath() == expected.RepoPath() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func moveDirectory(source, destination string) error {
+	if _, err := os.Stat(destination); err == nil {
+		return fmt.Errorf("destination already exists: %s", destination)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+		return err
+	}
+
+	return os.Rename(source, destination)
+}
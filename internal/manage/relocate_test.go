@@ -0,0 +1,85 @@
+package manage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git/gittest"
+)
+
+func TestRelocateSharedLegacyPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		moved  string
+		err    string
+	}{
+		{name: "first owner", remote: "git@github.com:gemrest/windmark.git", moved: "gemrest/windmark"},
+		{name: "second owner", remote: "https://github.com/fuwn/windmark", moved: "fuwn/windmark"},
+		{name: "no owner", remote: "git@example.com:someone/windmark.git", err: "match none of them"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			legacy := filepath.Join(root, "old")
+			clone := filepath.Join(legacy, "windmark")
+			path := filepath.Join(root, "config.yaml")
+
+			if err := os.MkdirAll(filepath.Join(clone, ".git"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			content := "remotes:\n  github:\n    url: git@github.com:${user}/${repo}.git\n" +
+				"defaults:\n  remotes: [github]\n  path_template: " + root + "/src/${user}/${repo}\n" +
+				"repos:\n  gemrest/windmark:\n  fuwn/windmark:\n"
+
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := config.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fake := gittest.NewFake()
+			fake.OnDir(clone, "git remote -v", gittest.Response{Stdout: "origin\t" + tt.remote + " (fetch)\norigin\t" + tt.remote + " (push)\n"})
+
+			moves, err := Relocate(context.Background(), fake, cfg, "all", legacy, false)
+			if err != nil {
+				t.Fatalf("Relocate() error = %v", err)
+			}
+
+			if len(moves) != 1 {
+				t.Fatalf("moves = %+v, want one", moves)
+			}
+
+			move := moves[0]
+
+			if tt.err != "" {
+				if move.Error == nil || !strings.Contains(move.Error.Error(), tt.err) {
+					t.Errorf("move error = %v, want %q", move.Error, tt.err)
+				}
+
+				if _, err := os.Stat(clone); err != nil {
+					t.Errorf("working copy moved although its owner is unclear: %v", err)
+				}
+
+				return
+			}
+
+			if move.Error != nil || move.Repo != tt.moved {
+				t.Fatalf("move = %+v, want %s moved", move, tt.moved)
+			}
+
+			if _, err := os.Stat(filepath.Join(root, "src", tt.moved, ".git")); err != nil {
+				t.Errorf("working copy not at %s: %v", tt.moved, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package manage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git"
+	"gopkg.in/yaml.v3"
+)
+
+var operationSections = []string{"pull", "push", "fetch"}
+
+func AddRemote(configPath, name, url string, aliases []string) error {
+	raw, err := readConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	remotesNode := raw["remotes"]
+
+	if remotesNode.Kind != yaml.MappingNode {
+		remotesNode = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	for _, candidate := range append([]string{name}, aliases...) {
+		if err := checkRemoteName(&remotesNode, candidate, ""); err != nil {
+			return err
+		}
+	}
+
+	definition := &yaml.Node{Kind: yaml.MappingNode}
+
+	if len(aliases) > 0 {
+		appendPair(definition, "aliases", stringSequence(aliases))
+	}
+
+	appendPair(definition, "url", scalarNode(url))
+	appendPair(&remotesNode, name, definition)
+
+	raw["remotes"] = remotesNode
+
+	return writeConfig(configPath, raw)
+}
+
+func RemoveRemote(configPath, name string) error {
+	raw, err := readConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	remotesNode := raw["remotes"]
+
+	if !removeKey(&remotesNode, name) {
+		return fmt.Errorf("remote not found: %s", name)
+	}
+
+	raw["remotes"] = remotesNode
+
+	without := func(item *yaml.Node) bool {
+		return item.Value == name
+	}
+
+	if defaultsNode, ok := raw["defaults"]; ok {
+		for _, list := range defaultRemoteLists(&defaultsNode) {
+			list.Content = slices.DeleteFunc(list.Content, without)
+		}
+	}
+
+	if reposNode, ok := raw["repos"]; ok && reposNode.Kind == yaml.MappingNode {
+		for i := 1; i < len(reposNode.Content); i += 2 {
+			entry := reposNode.Content[i]
+
+			removeKey(entry, name)
+
+			if remotes := mappingValue(entry, "remotes"); remotes != nil {
+				if remotes.Kind == yaml.SequenceNode {
+					remotes.Content = slices.DeleteFunc(remotes.Content, without)
+				}
+
+				removeKey(remotes, name)
+			}
+		}
+	}
+
+	return writeConfig(configPath, raw)
+}
+
+func RenameRemote(configPath, oldName, newName string) error {
+	raw, err := readConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	remotesNode := raw["remotes"]
+
+	if err := checkRemoteName(&remotesNode, newName, oldName); err != nil {
+		return err
+	}
+
+	if !renameKey(&remotesNode, oldName, newName) {
+		return fmt.Errorf("remote not found: %s", oldName)
+	}
+
+	raw["remotes"] = remotesNode
+
+	if defaultsNode, ok := raw["defaults"]; ok {
+		for _, list := range defaultRemoteLists(&defaultsNode) {
+			renameInSequence(list, oldName, newName)
+		}
+	}
+
+	if reposNode, ok := raw["repos"]; ok && reposNode.Kind == yaml.MappingNode {
+		for i := 1; i < len(reposNode.Content); i += 2 {
+			entry := reposNode.Content[i]
+
+			renameKey(entry, oldName, newName)
+
+			if remotes := mappingValue(entry, "remotes"); remotes != nil {
+				renameInSequence(remotes, oldName, newName)
+				renameKey(remotes, oldName, newName)
+			}
+		}
+	}
+
+	return writeConfig(configPath, raw)
+}
+
+func RenameWorkingCopyRemotes(ctx context.Context, runner git.Runner, cfg config.Config, oldName, newName string) []git.Result {
+	client := git.New(runner)
+	var results []git.Result
+
+	for _, name := range sortedRepoNames(cfg) {
+		if _, ok := cfg.Repos[name].Remotes[oldName]; !ok {
+			continue
+		}
+
+		path := cfg.Repos[name].ExpandPath()
+
+		if !client.IsRepo(ctx, path) || !client.HasRemote(ctx, path, oldName) {
+			continue
+		}
+
+		result := client.RenameRemote(ctx, path, oldName, newName)
+		result.Repo = name
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func ReposUsingRemote(cfg config.Config, name string) []RepoInfo {
+	var repos []RepoInfo
+
+	for _, repoName := range sortedRepoNames(cfg) {
+		repo := cfg.Repos[repoName]
+
+		url, ok := repo.Remotes[name]
+		if !ok {
+			continue
+		}
+
+		repos = append(repos, RepoInfo{
+			Name:    repoName,
+			Path:    repo.ExpandPath(),
+			Remotes: map[string]string{name: url},
+		})
+	}
+
+	return repos
+}
+
+func checkRemoteName(remotesNode *yaml.Node, name, self string) error {
+	if config.IsRepoKey(name) {
+		return fmt.Errorf("remote name is reserved for repo settings: %s", name)
+	}
+
+	if remotesNode.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(remotesNode.Content); i += 2 {
+		defined := remotesNode.Content[i].Value
+
+		if defined == name && defined != self {
+			return fmt.Errorf("remote already defined: %s", name)
+		}
+
+		if defined != self && slices.Contains(sequenceValues(mappingValue(remotesNode.Content[i+1], "aliases")), name) {
+			return fmt.Errorf("%s is already an alias of remote %s", name, defined)
+		}
+	}
+
+	return nil
+}
+
+func sortedRepoNames(cfg config.Config) []string {
+	names := cfg.AllRepos()
+
+	slices.Sort(names)
+
+	return names
+}
+
+func defaultRemoteLists(defaultsNode *yaml.Node) []*yaml.Node {
+	var lists []*yaml.Node
+
+	if list := mappingValue(defaultsNode, "remotes"); list != nil {
+		lists = append(lists, list)
+	}
+
+	for _, section := range operationSections {
+		if list := mappingValue(mappingValue(defaultsNode, section), "remotes"); list != nil {
+			lists = append(lists, list)
+		}
+	}
+
+	return lists
+}
+
+func renameInSequence(sequence *yaml.Node, oldValue, newValue string) {
+	if sequence.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, item := range sequence.Content {
+		if item.Value == oldValue {
+			item.Value = newValue
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package manage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git/gittest"
+)
+
+const remoteFixture = `remotes:
+  github:
+    aliases: [gh]
+    url: git@github.com:${user}/${repo}.git
+  codeberg:
+    url: git@codeberg.org:${user}/${repo}.git
+defaults:
+  remotes: [github, codeberg]
+  push:
+    remotes: [codeberg]
+repos:
+  ebisu/demo:
+  ebisu/tool:
+    remotes: [github, codeberg]
+    codeberg:
+      repo: tool-mirror
+  ebisu/legacy:
+    remotes:
+      github: git@github.com:ebisu/legacy.git
+      codeberg: git@codeberg.org:ebisu/legacy.git
+`
+
+func writeRemoteFixture(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(path, []byte(remoteFixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func repoRemoteNames(cfg config.Config, name string) []string {
+	names := make([]string, 0, len(cfg.Repos[name].Remotes))
+
+	for remoteName := range cfg.Repos[name].Remotes {
+		names = append(names, remoteName)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func TestRemoteCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   func(path string) error
+		err   string
+		check func(t *testing.T, cfg config.Config)
+	}{
+		{
+			name: "add",
+			run: func(path string) error {
+				return AddRemote(path, "sourcehut", "git@git.sr.ht:~${user}/${repo}", []string{"srht"})
+			},
+			check: func(t *testing.T, cfg config.Config) {
+				if def := cfg.Remotes["sourcehut"]; def.URL != "git@git.sr.ht:~${user}/${repo}" || !slices.Equal(def.Aliases, []string{"srht"}) {
+					t.Errorf("sourcehut = %+v", def)
+				}
+			},
+		},
+		{
+			name: "add existing",
+			run:  func(path string) error { return AddRemote(path, "github", "x", nil) },
+			err:  "remote already defined: github",
+		},
+		{
+			name: "add alias as name",
+			run:  func(path string) error { return AddRemote(path, "gh", "x", nil) },
+			err:  "gh is already an alias of remote github",
+		},
+		{
+			name: "add name as alias",
+			run:  func(path string) error { return AddRemote(path, "mirror", "x", []string{"codeberg"}) },
+			err:  "remote already defined: codeberg",
+		},
+		{
+			name: "add repo key",
+			run:  func(path string) error { return AddRemote(path, "path", "x", nil) },
+			err:  "reserved for repo settings: path",
+		},
+		{
+			name: "remove",
+			run:  func(path string) error { return RemoveRemote(path, "codeberg") },
+			check: func(t *testing.T, cfg config.Config) {
+				if _, ok := cfg.Remotes["codeberg"]; ok {
+					t.Error("codeberg still defined")
+				}
+
+				if !slices.Equal(cfg.Defaults.Remotes, []string{"github"}) || len(cfg.Defaults.Push.Remotes) != 0 {
+					t.Errorf("defaults = %v, push %v", cfg.Defaults.Remotes, cfg.Defaults.Push.Remotes)
+				}
+
+				for _, repo := range []string{"ebisu/demo", "ebisu/tool", "ebisu/legacy"} {
+					if got := repoRemoteNames(cfg, repo); !slices.Equal(got, []string{"github"}) {
+						t.Errorf("%s remotes = %v, want github", repo, got)
+					}
+				}
+			},
+		},
+		{
+			name: "remove unknown",
+			run:  func(path string) error { return RemoveRemote(path, "gitlab") },
+			err:  "remote not found: gitlab",
+		},
+		{
+			name: "rename",
+			run:  func(path string) error { return RenameRemote(path, "codeberg", "cb") },
+			check: func(t *testing.T, cfg config.Config) {
+				if !slices.Equal(cfg.Defaults.Remotes, []string{"github", "cb"}) || !slices.Equal(cfg.Defaults.Push.Remotes, []string{"cb"}) {
+					t.Errorf("defaults = %v, push %v", cfg.Defaults.Remotes, cfg.Defaults.Push.Remotes)
+				}
+
+				if got := cfg.Repos["ebisu/tool"].Remotes["cb"]; got != "git@codeberg.org:ebisu/tool-mirror.git" {
+					t.Errorf("ebisu/tool cb = %q, want the repo override kept", got)
+				}
+
+				if got := cfg.Repos["ebisu/legacy"].Remotes["cb"]; got != "git@codeberg.org:ebisu/legacy.git" {
+					t.Errorf("ebisu/legacy cb = %q", got)
+				}
+			},
+		},
+		{
+			name: "rename onto alias",
+			run:  func(path string) error { return RenameRemote(path, "codeberg", "gh") },
+			err:  "gh is already an alias of remote github",
+		},
+		{
+			name: "rename onto repo key",
+			run:  func(path string) error { return RenameRemote(path, "codeberg", "tags") },
+			err:  "reserved for repo settings: tags",
+		},
+		{
+			name: "rename onto existing",
+			run:  func(path string) error { return RenameRemote(path, "codeberg", "github") },
+			err:  "remote already defined: github",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeRemoteFixture(t)
+
+			err := tt.run(path)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				if data, _ := os.ReadFile(path); string(data) != remoteFixture {
+					t.Error("config rewritten after a rejected change")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			cfg, err := config.Load(path)
+			if err != nil {
+				t.Fatalf("config.Load() after change: %v", err)
+			}
+
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestRenameWorkingCopyRemotes(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "config.yaml")
+
+	content := "remotes:\n  codeberg:\n    url: git@codeberg.org:${user}/${repo}.git\n  github:\n    url: git@github.com:${user}/${repo}.git\n" +
+		"repos:\n  ebisu/uses:\n    path: " + root + "/uses\n    remotes: [codeberg]\n  ebisu/other:\n    path: " + root + "/other\n    remotes: [github]\n"
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := gittest.NewFake()
+
+	results := RenameWorkingCopyRemotes(context.Background(), fake, cfg, "codeberg", "cb")
+
+	if len(results) != 1 || results[0].Repo != "ebisu/uses" {
+		t.Errorf("results = %+v, want only ebisu/uses", results)
+	}
+
+	for _, call := range fake.Calls() {
+		if call.Dir == filepath.Join(root, "other") {
+			t.Errorf("ran %q in a repository that does not use codeberg", call.Argv)
+		}
+	}
+}
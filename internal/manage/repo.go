@@ -0,0 +1,297 @@
+package manage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func SetRepoRemotes(configPath string, cfg config.Config, name string, changes []string) (string, []string, error) {
+	fullName, repo, found := cfg.FindRepo(name)
+	if !found {
+		return "", nil, fmt.Errorf("repository not found: %s", name)
+	}
+
+	raw, err := readConfig(configPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	entry, err := repoEntry(raw, fullName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	remotesNode := mappingValue(entry, "remotes")
+
+	if remotesNode != nil && remotesNode.Kind == yaml.MappingNode {
+		return "", nil, fmt.Errorf("%s uses a remotes map; convert it to a remotes list first", fullName)
+	}
+
+	remotes := slices.Clone(cfg.Defaults.Remotes)
+
+	if remotesNode != nil {
+		remotes = sequenceValues(remotesNode)
+	}
+
+	for _, change := range changes {
+		if remoteName, ok := strings.CutPrefix(change, "-"); ok {
+			remoteName = cfg.ResolveAlias(remoteName)
+
+			if !slices.Contains(remotes, remoteName) {
+				return "", nil, fmt.Errorf("%s does not use remote: %s", fullName, remoteName)
+			}
+
+			remotes = slices.DeleteFunc(remotes, func(r string) bool { return r == remoteName })
+
+			continue
+		}
+
+		remoteName := cfg.ResolveAlias(strings.TrimPrefix(change, "+"))
+
+		if _, defined := cfg.Remotes[remoteName]; !defined && !hasURLOverride(entry, remoteName) {
+			return "", nil, fmt.Errorf("remote not found: %s", remoteName)
+		}
+
+		if !slices.Contains(remotes, remoteName) {
+			remotes = append(remotes, remoteName)
+		}
+	}
+
+	if sameSet(remotes, cfg.Defaults.Remotes) {
+		removeKey(entry, "remotes")
+	} else {
+		setValue(entry, "remotes", stringSequence(remotes))
+	}
+
+	for remoteName := range repo.Remotes {
+		if !slices.Contains(remotes, remoteName) {
+			if override := mappingValue(entry, remoteName); override != nil && override.Kind == yaml.MappingNode && !hasURLOverride(entry, remoteName) {
+				removeKey(entry, remoteName)
+			}
+		}
+	}
+
+	return fullName, remotes, writeConfig(configPath, raw)
+}
+
+func SetRepoFields(configPath string, cfg config.Config, name string, assignments []string) (string, error) {
+	fullName, _, found := cfg.FindRepo(name)
+	if !found {
+		return "", fmt.Errorf("repository not found: %s", name)
+	}
+
+	raw, err := readConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := repoEntry(raw, fullName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, assignment := range assignments {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return "", fmt.Errorf("invalid assignment (expected key=value): %s", assignment)
+		}
+
+		if err := setField(entry, cfg, key, value); err != nil {
+			return "", err
+		}
+	}
+
+	return fullName, writeConfig(configPath, raw)
+}
+
+func SetRepoMetadata(configPath string, cfg config.Config, name string, metadata config.Metadata, fields []string) (string, error) {
+	fullName, _, found := cfg.FindRepo(name)
+	if !found {
+		return "", fmt.Errorf("repository not found: %s", name)
+	}
+
+	raw, err := readConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := repoEntry(raw, fullName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, field := range fields {
+		var value string
+
+		switch field {
+		case "description":
+			value = metadata.Description
+		case "homepage":
+			value = metadata.Homepage
+		case "topics":
+			value = strings.Join(metadata.Topics, ",")
+		case "private":
+			if metadata.Private != nil {
+				value = strconv.FormatBool(*metadata.Private)
+			}
+		default:
+			continue
+		}
+
+		if err := setField(entry, cfg, field, value); err != nil {
+			return "", err
+		}
+	}
+
+	return fullName, writeConfig(configPath, raw)
+}
+
+func setField(entry *yaml.Node, cfg config.Config, key, value string) error {
+	switch key {
+	case "path":
+		if value == "" {
+			removeKey(entry, "path")
+		} else {
+			setValue(entry, "path", scalarNode(value))
+		}
+
+		return nil
+	case "description", "homepage", "private":
+		if value == "" {
+			removeKey(entry, key)
+		} else {
+			node := scalarNode(value)
+
+			if key == "private" {
+				private, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("invalid boolean for private: %s", value)
+				}
+
+				node = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(private)}
+			}
+
+			setValue(entry, key, node)
+		}
+
+		return nil
+	case "mode":
+		switch value {
+		case "", config.ModeNormal:
+			removeKey(entry, "mode")
+		case config.ModeMirror, config.ModeArchive:
+			setValue(entry, "mode", scalarNode(value))
+		default:
+			return fmt.Errorf("invalid mode (expected normal, mirror or archive): %s", value)
+		}
+
+		return nil
+	case "tags", "topics":
+		if value == "" {
+			removeKey(entry, key)
+		} else {
+			setValue(entry, key, stringSequence(strings.Split(value, ",")))
+		}
+
+		return nil
+	}
+
+	remoteName, field, ok := strings.Cut(key, ".")
+	if !ok {
+		return fmt.Errorf("unknown field: %s", key)
+	}
+
+	remoteName = cfg.ResolveAlias(remoteName)
+	override := mappingValue(entry, remoteName)
+
+	switch field {
+	case "url":
+		if override == nil || override.Kind != yaml.MappingNode {
+			if value == "" {
+				removeKey(entry, remoteName)
+			} else {
+				setValue(entry, remoteName, scalarNode(value))
+			}
+
+			return nil
+		}
+	case "user", "repo":
+	case "direction":
+		switch value {
+		case "", config.DirectionPull, config.DirectionPush, config.DirectionBoth:
+		default:
+			return fmt.Errorf("invalid direction (expected pull, push or both): %s", value)
+		}
+	default:
+		return fmt.Errorf("unknown field: %s", key)
+	}
+
+	if override == nil {
+		override = &yaml.Node{Kind: yaml.MappingNode}
+	} else if override.Kind != yaml.MappingNode {
+		override = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalarNode("url"), scalarNode(override.Value)}}
+	}
+
+	if value == "" {
+		removeKey(override, field)
+	} else {
+		setValue(override, field, scalarNode(value))
+	}
+
+	if len(override.Content) == 0 {
+		removeKey(entry, remoteName)
+	} else if url := mappingValue(override, "url"); url != nil && len(override.Content) == 2 {
+		setValue(entry, remoteName, url)
+	} else {
+		setValue(entry, remoteName, override)
+	}
+
+	return nil
+}
+
+func repoEntry(raw map[string]yaml.Node, fullName string) (*yaml.Node, error) {
+	reposNode, ok := raw["repos"]
+	if !ok || reposNode.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("repos section not found in config")
+	}
+
+	entry := mappingValue(&reposNode, fullName)
+	if entry == nil {
+		return nil, fmt.Errorf("repository not defined in config: %s", fullName)
+	}
+
+	if entry.Kind != yaml.MappingNode {
+		*entry = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	entry.Style = 0
+
+	return entry, nil
+}
+
+func hasURLOverride(entry *yaml.Node, remoteName string) bool {
+	override := mappingValue(entry, remoteName)
+
+	if override != nil && override.Kind == yaml.MappingNode {
+		override = mappingValue(override, "url")
+	}
+
+	return override != nil && override.Kind == yaml.ScalarNode
+}
+
+func setValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+
+			return
+		}
+	}
+
+	appendPair(mapping, key, value)
+}
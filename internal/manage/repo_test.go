@@ -0,0 +1,303 @@
+package manage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+const repoFixture = `remotes:
+  github:
+    aliases: [gh]
+    url: git@github.com:${user}/${repo}.git
+  codeberg:
+    aliases: [cb]
+    url: git@codeberg.org:${user}/${repo}.git
+  sourcehut:
+    url: git@git.sr.ht:~${user}/${repo}
+defaults:
+  remotes: [github, codeberg]
+repos:
+  ebisu/demo:
+  ebisu/tool:
+    remotes: [github, sourcehut]
+    sourcehut:
+      repo: tool-mirror
+  ebisu/custom:
+    remotes: [github, vendor]
+    vendor: https://vendor.example/custom.git
+  ebisu/legacy:
+    remotes:
+      github: git@github.com:ebisu/legacy.git
+`
+
+func loadRepoFixture(t *testing.T) (string, config.Config) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(path, []byte(repoFixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path, cfg
+}
+
+func TestSetRepoRemotes(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    string
+		changes []string
+		err     string
+		want    []string
+		urls    map[string]string
+		entry   string
+	}{
+		{
+			name:    "add to defaults",
+			repo:    "demo",
+			changes: []string{"+sourcehut"},
+			want:    []string{"codeberg", "github", "sourcehut"},
+			entry:   "remotes: [github, codeberg, sourcehut]",
+		},
+		{
+			name:    "replace by alias",
+			repo:    "demo",
+			changes: []string{"+sourcehut", "-cb"},
+			want:    []string{"github", "sourcehut"},
+		},
+		{
+			name:    "back to defaults",
+			repo:    "tool",
+			changes: []string{"+codeberg", "-sourcehut"},
+			want:    []string{"codeberg", "github"},
+			entry:   "ebisu/tool: {}",
+		},
+		{
+			name:    "drop keeps url override",
+			repo:    "custom",
+			changes: []string{"-vendor"},
+			want:    []string{"github"},
+			entry:   "vendor: https://vendor.example/custom.git",
+		},
+		{
+			name:    "re-add url override",
+			repo:    "custom",
+			changes: []string{"-vendor", "+vendor"},
+			want:    []string{"github", "vendor"},
+			urls:    map[string]string{"vendor": "https://vendor.example/custom.git"},
+		},
+		{
+			name:    "unknown remote",
+			repo:    "demo",
+			changes: []string{"+gitlab"},
+			err:     "remote not found: gitlab",
+		},
+		{
+			name:    "remove unused",
+			repo:    "demo",
+			changes: []string{"-sourcehut"},
+			err:     "ebisu/demo does not use remote: sourcehut",
+		},
+		{
+			name:    "remotes map",
+			repo:    "legacy",
+			changes: []string{"+codeberg"},
+			err:     "uses a remotes map",
+		},
+		{
+			name:    "unknown repo",
+			repo:    "missing",
+			changes: []string{"+codeberg"},
+			err:     "repository not found: missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cfg := loadRepoFixture(t)
+
+			fullName, _, err := SetRepoRemotes(path, cfg, tt.repo, tt.changes)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("SetRepoRemotes() error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("SetRepoRemotes() error = %v", err)
+			}
+
+			saved, err := config.Load(path)
+			if err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+
+			if got := repoRemoteNames(saved, fullName); !slices.Equal(got, tt.want) {
+				t.Errorf("remotes = %v, want %v", got, tt.want)
+			}
+
+			for remoteName, url := range tt.urls {
+				if got := saved.Repos[fullName].Remotes[remoteName]; got != url {
+					t.Errorf("%s = %s, want %s", remoteName, got, url)
+				}
+			}
+
+			if tt.entry != "" {
+				data, _ := os.ReadFile(path)
+
+				if !strings.Contains(string(data), tt.entry) {
+					t.Errorf("config missing %q:\n%s", tt.entry, data)
+				}
+			}
+		})
+	}
+}
+
+func TestSetRepoFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		assignments []string
+		err         string
+		check       func(t *testing.T, repo config.Repo)
+	}{
+		{
+			name:        "path and mode",
+			assignments: []string{"path=/work/tool", "mode=mirror"},
+			check: func(t *testing.T, repo config.Repo) {
+				if repo.Path != "/work/tool" || repo.Mode != config.ModeMirror {
+					t.Errorf("path = %s mode = %s", repo.Path, repo.Mode)
+				}
+			},
+		},
+		{
+			name:        "invalid private",
+			assignments: []string{"description=A tool", "private=yes"},
+			err:         "invalid boolean for private: yes",
+		},
+		{
+			name:        "metadata values",
+			assignments: []string{"description=A tool", "topics=go,cli", "private=true", "tags=work"},
+			check: func(t *testing.T, repo config.Repo) {
+				if repo.Metadata.Description != "A tool" || !slices.Equal(repo.Metadata.Topics, []string{"go", "cli"}) {
+					t.Errorf("metadata = %+v", repo.Metadata)
+				}
+
+				if repo.Metadata.Private == nil || !*repo.Metadata.Private {
+					t.Errorf("private = %v, want true", repo.Metadata.Private)
+				}
+
+				if !slices.Equal(repo.Tags, []string{"work"}) {
+					t.Errorf("tags = %v", repo.Tags)
+				}
+			},
+		},
+		{
+			name:        "remote override fields",
+			assignments: []string{"sourcehut.repo=", "gh.user=fuwn", "gh.direction=push"},
+			check: func(t *testing.T, repo config.Repo) {
+				if got := repo.Remotes["sourcehut"]; got != "git@git.sr.ht:~ebisu/tool" {
+					t.Errorf("sourcehut = %s", got)
+				}
+
+				if got := repo.Remotes["github"]; got != "git@github.com:fuwn/tool.git" {
+					t.Errorf("github = %s", got)
+				}
+
+				if got := repo.Direction("github"); got != config.DirectionPush {
+					t.Errorf("github direction = %s", got)
+				}
+			},
+		},
+		{
+			name:        "url override then field",
+			assignments: []string{"sourcehut.url=https://example.com/tool.git", "sourcehut.repo=", "sourcehut.direction=pull"},
+			check: func(t *testing.T, repo config.Repo) {
+				if got := repo.Remotes["sourcehut"]; got != "https://example.com/tool.git" {
+					t.Errorf("sourcehut = %s", got)
+				}
+
+				if got := repo.Direction("sourcehut"); got != config.DirectionPull {
+					t.Errorf("sourcehut direction = %s", got)
+				}
+			},
+		},
+		{
+			name:        "clear",
+			assignments: []string{"mode=mirror", "mode=", "path=/work/tool", "path="},
+			check: func(t *testing.T, repo config.Repo) {
+				if repo.Mode != config.ModeNormal || repo.Path == "/work/tool" {
+					t.Errorf("path = %s mode = %s", repo.Path, repo.Mode)
+				}
+			},
+		},
+		{name: "invalid mode", assignments: []string{"mode=frozen"}, err: "invalid mode"},
+		{name: "invalid direction", assignments: []string{"github.direction=sideways"}, err: "invalid direction"},
+		{name: "unknown field", assignments: []string{"colour=red"}, err: "unknown field: colour"},
+		{name: "unknown remote field", assignments: []string{"github.branch=main"}, err: "unknown field: github.branch"},
+		{name: "missing value", assignments: []string{"path"}, err: "invalid assignment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cfg := loadRepoFixture(t)
+
+			_, err := SetRepoFields(path, cfg, "tool", tt.assignments)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("SetRepoFields() error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("SetRepoFields() error = %v", err)
+			}
+
+			saved, err := config.Load(path)
+			if err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+
+			tt.check(t, saved.Repos["ebisu/tool"])
+		})
+	}
+}
+
+func TestSetRepoMetadata(t *testing.T) {
+	path, cfg := loadRepoFixture(t)
+
+	private := false
+	metadata := config.Metadata{Description: "From GitHub", Homepage: "https://demo.example", Topics: []string{"go"}, Private: &private}
+
+	if _, err := SetRepoMetadata(path, cfg, "demo", metadata, []string{"description", "topics", "private"}); err != nil {
+		t.Fatalf("SetRepoMetadata() error = %v", err)
+	}
+
+	saved, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := saved.Repos["ebisu/demo"].Metadata
+
+	if got.Description != "From GitHub" || !slices.Equal(got.Topics, []string{"go"}) || got.Private == nil || *got.Private {
+		t.Errorf("metadata = %+v", got)
+	}
+
+	if got.Homepage != "" {
+		t.Errorf("homepage = %s, want it left alone because the forge does not report it", got.Homepage)
+	}
+}
@@ -0,0 +1,412 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/redact"
+	"github.com/ebisu/mugi/pkg/mugi"
+)
+
+const (
+	StatusFailure  = "failure"
+	StatusRecovery = "recovery"
+	StatusSuccess  = "success"
+)
+
+const requestTimeout = 10 * time.Second
+
+var formats = map[string]string{
+	"slack":  `{"text": {{json .Text}}}`,
+	"matrix": `{"msgtype": "m.text", "body": {{json .Text}}}`,
+	"ntfy":   `{{.Text}}`,
+}
+
+type Failure struct {
+	Repo   string `json:"repo"`
+	Remote string `json:"remote"`
+	Output string `json:"output"`
+}
+
+type Report struct {
+	Key       string    `json:"key"`
+	Operation string    `json:"operation"`
+	Target    string    `json:"target"`
+	Status    string    `json:"status"`
+	Host      string    `json:"host"`
+	Time      time.Time `json:"time"`
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+	Blocked   int       `json:"blocked"`
+	Skipped   int       `json:"skipped"`
+	Failures  []Failure `json:"failures"`
+	Title     string    `json:"title"`
+	Summary   string    `json:"summary"`
+	Text      string    `json:"text"`
+}
+
+func NewReport(key, operation, target string, finished []mugi.Finished) Report {
+	host, _ := os.Hostname()
+	summary := mugi.Summarize(finished)
+
+	report := Report{
+		Key:       key,
+		Operation: operation,
+		Target:    target,
+		Host:      host,
+		Time:      time.Now(),
+		Succeeded: summary.Succeeded,
+		Failed:    summary.Failed,
+		Blocked:   summary.Blocked,
+		Skipped:   summary.Skipped,
+		Failures:  []Failure{},
+	}
+
+	for _, f := range finished {
+		if f.Status != mugi.StatusFailed && f.Status != mugi.StatusBlocked {
+			continue
+		}
+
+		output, _, _ := strings.Cut(strings.TrimSpace(f.Result.Output), "\n")
+
+		report.Failures = append(report.Failures, Failure{
+			Repo:   f.Task.RepoName,
+			Remote: f.Task.RemoteName,
+			Output: redact.String(output),
+		})
+	}
+
+	parts := []string{fmt.Sprintf("%d succeeded", report.Succeeded)}
+
+	if report.Failed > 0 {
+		parts = append([]string{fmt.Sprintf("%d failed", report.Failed)}, parts...)
+	}
+
+	if report.Blocked > 0 {
+		parts = append(parts, fmt.Sprintf("%d blocked by hooks", report.Blocked))
+	}
+
+	if report.Skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped", report.Skipped))
+	}
+
+	report.Summary = strings.Join(parts, ", ")
+
+	return report
+}
+
+func (r Report) Failing() bool {
+	return r.Failed > 0 || r.Blocked > 0
+}
+
+func Dispatch(ctx context.Context, sinks []config.NotifySink, report Report) []error {
+	if len(sinks) == 0 {
+		return nil
+	}
+
+	failedBefore, err := remember(report.Key, report.Failing())
+	if err != nil {
+		return []error{err}
+	}
+
+	report.Status = StatusSuccess
+
+	if report.Failing() {
+		report.Status = StatusFailure
+	} else if failedBefore {
+		report.Status = StatusRecovery
+	}
+
+	report.Title, report.Text = describe(report)
+
+	var errs []error
+
+	for _, sink := range sinks {
+		if !sink.Fires(report.Status) {
+			continue
+		}
+
+		if err := Send(ctx, sink, report); err != nil {
+			errs = append(errs, fmt.Errorf("notify %s: %w", sink.Type, err))
+		}
+	}
+
+	return errs
+}
+
+func describe(report Report) (string, string) {
+	var title string
+
+	switch report.Status {
+	case StatusFailure:
+		title = fmt.Sprintf("mugi %s failed for %s", report.Operation, report.Target)
+	case StatusRecovery:
+		title = fmt.Sprintf("mugi %s recovered for %s", report.Operation, report.Target)
+	default:
+		title = fmt.Sprintf("mugi %s succeeded for %s", report.Operation, report.Target)
+	}
+
+	if report.Host != "" {
+		title += " on " + report.Host
+	}
+
+	lines := []string{title, report.Summary}
+
+	for _, failure := range report.Failures {
+		lines = append(lines, fmt.Sprintf("✗ %s → %s: %s", failure.Repo, failure.Remote, failure.Output))
+	}
+
+	return title, strings.Join(lines, "\n")
+}
+
+func Send(ctx context.Context, sink config.NotifySink, report Report) error {
+	if report.Title == "" {
+		report.Title, report.Text = describe(report)
+	}
+
+	report.Title, report.Text = redact.String(report.Title), redact.String(report.Text)
+
+	switch sink.Type {
+	case config.NotifyWebhook:
+		return sendWebhook(ctx, sink, report)
+	case config.NotifySendmail:
+		return sendMail(ctx, sink, report)
+	case config.NotifyNotifySend:
+		return sendDesktop(ctx, sink, report)
+	default:
+		return fmt.Errorf("unknown sink type: %s", sink.Type)
+	}
+}
+
+func sendWebhook(ctx context.Context, sink config.NotifySink, report Report) error {
+	body, err := renderPayload(sink, report)
+	if err != nil {
+		return err
+	}
+
+	method := sink.Method
+
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if sink.Format == "ntfy" {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		req.Header.Set("Title", report.Title)
+
+		if report.Status == StatusFailure {
+			req.Header.Set("Priority", "high")
+		}
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for key, value := range sink.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", redact.String(sink.URL), resp.Status)
+	}
+
+	return nil
+}
+
+func renderPayload(sink config.NotifySink, report Report) ([]byte, error) {
+	text := sink.Template
+
+	if text == "" {
+		text = formats[sink.Format]
+	}
+
+	if text == "" {
+		return json.Marshal(report)
+	}
+
+	tmpl, err := template.New("payload").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, report); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func sendMail(ctx context.Context, sink config.NotifySink, report Report) error {
+	command := sink.Command
+
+	if command == "" {
+		command = "sendmail"
+	}
+
+	var message strings.Builder
+
+	if sink.From != "" {
+		fmt.Fprintf(&message, "From: %s\n", sink.From)
+	}
+
+	fmt.Fprintf(&message, "To: %s\n", strings.Join(sink.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\n", report.Title)
+	message.WriteString("Content-Type: text/plain; charset=utf-8\n\n")
+	message.WriteString(report.Text + "\n")
+
+	cmd := exec.CommandContext(ctx, command, "-oi", "-t")
+	cmd.Stdin = strings.NewReader(message.String())
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func sendDesktop(ctx context.Context, sink config.NotifySink, report Report) error {
+	command := sink.Command
+
+	if command == "" {
+		command = "notify-send"
+	}
+
+	urgency := "normal"
+
+	if report.Status == StatusFailure {
+		urgency = "critical"
+	}
+
+	body := strings.TrimPrefix(report.Text, report.Title+"\n")
+
+	cmd := exec.CommandContext(ctx, command, "--app-name=mugi", "--urgency="+urgency, report.Title, body)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func statePath() (string, error) {
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "mugi", "notify.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "state", "mugi", "notify.json"), nil
+}
+
+func loadState() (map[string]bool, string, error) {
+	path, err := statePath()
+	if err != nil {
+		return nil, "", err
+	}
+
+	state := make(map[string]bool)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, path, nil
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return make(map[string]bool), path, nil
+	}
+
+	return state, path, nil
+}
+
+var stateMu sync.Mutex
+
+func remember(key string, failing bool) (bool, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	state, path, err := loadState()
+	if err != nil {
+		return false, err
+	}
+
+	failedBefore := state[key]
+
+	if failedBefore == failing {
+		return failedBefore, nil
+	}
+
+	if failing {
+		state[key] = true
+	} else {
+		delete(state, key)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return failedBefore, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return failedBefore, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "notify-*.json")
+	if err != nil {
+		return failedBefore, err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return failedBefore, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+
+		return failedBefore, err
+	}
+
+	return failedBefore, os.Rename(tmp.Name(), path)
+}
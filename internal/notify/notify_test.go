@@ -0,0 +1,267 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/redact"
+	"github.com/ebisu/mugi/pkg/mugi"
+)
+
+type delivery struct {
+	header http.Header
+	body   string
+}
+
+type receiver struct {
+	mu         sync.Mutex
+	deliveries []delivery
+}
+
+func newReceiver(t *testing.T) (*receiver, string) {
+	t.Helper()
+
+	r := &receiver{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.deliveries = append(r.deliveries, delivery{header: req.Header.Clone(), body: string(body)})
+		r.mu.Unlock()
+	}))
+
+	t.Cleanup(server.Close)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	return r, server.URL
+}
+
+func (r *receiver) take() []delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deliveries := r.deliveries
+	r.deliveries = nil
+
+	return deliveries
+}
+
+func finished(status mugi.Status, output string) []mugi.Finished {
+	return []mugi.Finished{
+		{Task: mugi.Task{RepoName: "ebisu/demo", RemoteName: "github"}, Status: mugi.StatusSucceeded},
+		{Task: mugi.Task{RepoName: "ebisu/demo", RemoteName: "codeberg"}, Status: status, Result: mugi.Result{Output: output}},
+	}
+}
+
+func TestDispatchTriggers(t *testing.T) {
+	runs := []struct {
+		status mugi.Status
+		want   string
+	}{
+		{mugi.StatusSucceeded, StatusSuccess},
+		{mugi.StatusFailed, StatusFailure},
+		{mugi.StatusBlocked, StatusFailure},
+		{mugi.StatusSucceeded, StatusRecovery},
+		{mugi.StatusSucceeded, StatusSuccess},
+	}
+
+	tests := []struct {
+		on   config.NotifyEvents
+		want []string
+	}{
+		{nil, []string{StatusFailure, StatusFailure}},
+		{config.NotifyEvents{config.NotifyOnFailure}, []string{StatusFailure, StatusFailure}},
+		{config.NotifyEvents{config.NotifyOnRecovery}, []string{StatusRecovery}},
+		{config.NotifyEvents{config.NotifyOnFailure, config.NotifyOnRecovery}, []string{StatusFailure, StatusFailure, StatusRecovery}},
+		{config.NotifyEvents{config.NotifyOnAlways}, []string{StatusSuccess, StatusFailure, StatusFailure, StatusRecovery, StatusSuccess}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.on, "+"), func(t *testing.T) {
+			r, url := newReceiver(t)
+			sinks := []config.NotifySink{{Type: config.NotifyWebhook, URL: url, On: tt.on}}
+
+			var got []string
+
+			for _, run := range runs {
+				report := NewReport("push ebisu/demo", "push", "ebisu/demo", finished(run.status, "fatal: rejected"))
+
+				if errs := Dispatch(context.Background(), sinks, report); len(errs) > 0 {
+					t.Fatalf("Dispatch() = %v", errs)
+				}
+
+				for _, d := range r.take() {
+					var payload Report
+
+					if err := json.Unmarshal([]byte(d.body), &payload); err != nil {
+						t.Fatalf("payload %q: %v", d.body, err)
+					}
+
+					if payload.Status != run.want {
+						t.Errorf("payload status = %s, want %s", payload.Status, run.want)
+					}
+
+					got = append(got, payload.Status)
+				}
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("delivered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatchConcurrentKeys(t *testing.T) {
+	r, url := newReceiver(t)
+	sinks := []config.NotifySink{{Type: config.NotifyWebhook, URL: url, On: config.NotifyEvents{config.NotifyOnRecovery}}}
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	dispatchAll := func(status mugi.Status) {
+		var wg sync.WaitGroup
+
+		for _, key := range keys {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				Dispatch(context.Background(), sinks, NewReport(key, "fetch", key, finished(status, "")))
+			}()
+		}
+
+		wg.Wait()
+	}
+
+	dispatchAll(mugi.StatusFailed)
+	dispatchAll(mugi.StatusSucceeded)
+
+	if got := len(r.take()); got != len(keys) {
+		t.Errorf("recoveries = %d, want %d", got, len(keys))
+	}
+}
+
+func TestRenderPayload(t *testing.T) {
+	redact.Register("hunter2-token")
+
+	tests := []struct {
+		name   string
+		sink   config.NotifySink
+		target string
+		header map[string]string
+		check  func(t *testing.T, body string)
+	}{
+		{
+			name: "json",
+			sink: config.NotifySink{},
+			header: map[string]string{
+				"Content-Type": "application/json",
+			},
+			check: func(t *testing.T, body string) {
+				var payload Report
+
+				if err := json.Unmarshal([]byte(body), &payload); err != nil {
+					t.Fatal(err)
+				}
+
+				if payload.Failed != 1 || len(payload.Failures) != 1 || payload.Failures[0].Remote != "codeberg" {
+					t.Errorf("payload = %+v", payload)
+				}
+			},
+		},
+		{
+			name: "slack",
+			sink: config.NotifySink{Format: "slack"},
+			check: func(t *testing.T, body string) {
+				var payload struct {
+					Text string `json:"text"`
+				}
+
+				if err := json.Unmarshal([]byte(body), &payload); err != nil {
+					t.Fatal(err)
+				}
+
+				if !strings.HasPrefix(payload.Text, "mugi push failed for ebisu/demo") || !strings.Contains(payload.Text, "✗ ebisu/demo → codeberg: fatal: rejected") {
+					t.Errorf("text = %q", payload.Text)
+				}
+			},
+		},
+		{
+			name: "ntfy",
+			sink: config.NotifySink{Format: "ntfy"},
+			header: map[string]string{
+				"Content-Type": "text/plain; charset=utf-8",
+				"Priority":     "high",
+			},
+			check: func(t *testing.T, body string) {
+				if !strings.Contains(body, "1 failed, 1 succeeded") {
+					t.Errorf("body = %q", body)
+				}
+			},
+		},
+		{
+			name: "template",
+			sink: config.NotifySink{
+				Template: `{{range $f := .Failures}}{{$f.Repo}}/{{$f.Remote}} {{end}}{{json .Status}}`,
+				Headers:  map[string]string{"X-Token": "abc"},
+			},
+			header: map[string]string{"X-Token": "abc"},
+			check: func(t *testing.T, body string) {
+				if body != `ebisu/demo/codeberg "failure"` {
+					t.Errorf("body = %q", body)
+				}
+			},
+		},
+		{
+			name:   "redacted title and text",
+			sink:   config.NotifySink{Format: "ntfy"},
+			target: "hunter2-token",
+			check: func(t *testing.T, body string) {
+				if strings.Contains(body, "hunter2-token") {
+					t.Errorf("body = %q, want secret masked", body)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, url := newReceiver(t)
+
+			tt.sink.Type = config.NotifyWebhook
+			tt.sink.URL = url
+
+			target := "ebisu/demo"
+
+			if tt.target != "" {
+				target = tt.target
+			}
+
+			report := NewReport("push", "push", target, finished(mugi.StatusFailed, "fatal: rejected\nhint: pull first"))
+
+			if errs := Dispatch(context.Background(), []config.NotifySink{tt.sink}, report); len(errs) > 0 {
+				t.Fatalf("Dispatch() = %v", errs)
+			}
+
+			deliveries := r.take()
+			if len(deliveries) != 1 {
+				t.Fatalf("deliveries = %d, want 1", len(deliveries))
+			}
+
+			for key, want := range tt.header {
+				if got := deliveries[0].header.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+
+			tt.check(t, deliveries[0].body)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package redact
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const Mask = "***"
+
+var (
+	mu       sync.RWMutex
+	disabled bool
+	secrets  []string
+)
+
+var (
+	userinfoPattern = regexp.MustCompile(`([A-Za-z][A-Za-z0-9+.-]*://[^/@\s:]*):[^/@\s]+@`)
+	httpUserPattern = regexp.MustCompile(`(?i)(https?://)[^/@\s:]+@`)
+	tokenPattern    = regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{16,}|github_pat_[A-Za-z0-9_]{16,}|glpat-[A-Za-z0-9_-]{16,})`)
+)
+
+func SetEnabled(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	disabled = !enabled
+}
+
+func Register(secret string) {
+	secret = strings.TrimSpace(secret)
+
+	if len(secret) < 4 {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !slices.Contains(secrets, secret) {
+		secrets = append(secrets, secret)
+	}
+}
+
+func IsSecret(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return slices.Contains(secrets, s) || tokenPattern.FindString(s) == s
+}
+
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if disabled || s == "" {
+		return s
+	}
+
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+
+	s = userinfoPattern.ReplaceAllString(s, "$1:"+Mask+"@")
+	s = httpUserPattern.ReplaceAllString(s, "${1}"+Mask+"@")
+
+	return tokenPattern.ReplaceAllString(s, Mask)
+}
+
+func Error(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return String(err.Error())
+}
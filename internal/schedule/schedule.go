@@ -0,0 +1,365 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+const (
+	prefix = "mugi-"
+	marker = "# Generated by mugi schedule install"
+)
+
+const (
+	StateInstalled = "installed"
+	StateOutdated  = "outdated"
+	StateMissing   = "missing"
+	StateStale     = "stale"
+)
+
+type Unit struct {
+	Name      string
+	Operation string
+	Repo      string
+	Calendar  string
+	Service   string
+	Timer     string
+}
+
+type UnitStatus struct {
+	Unit
+	State  string
+	Active string
+	Next   string
+	Last   string
+	Result string
+}
+
+func Dir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "systemd", "user"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+func Units(cfg config.Config, executable, configPath string) []Unit {
+	var units []Unit
+
+	for _, operation := range slices.Sorted(maps.Keys(cfg.Defaults.Schedule)) {
+		units = append(units, newUnit(prefix+operation, operation, "", cfg.Defaults.Schedule[operation], executable, configPath))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Repos)) {
+		schedule := cfg.Repos[name].Schedule
+
+		for _, operation := range slices.Sorted(maps.Keys(schedule)) {
+			unitName := prefix + operation + "-" + escapeName(name)
+
+			units = append(units, newUnit(unitName, operation, name, schedule[operation], executable, configPath))
+		}
+	}
+
+	return units
+}
+
+func newUnit(name, operation, repo, calendar, executable, configPath string) Unit {
+	unit := Unit{Name: name, Operation: operation, Repo: repo, Calendar: calendar}
+	target := "all repositories"
+
+	if repo != "" {
+		target = repo
+	}
+
+	argv := []string{executable, "--plain"}
+
+	if configPath != "" {
+		argv = append(argv, "-c", configPath)
+	}
+
+	argv = append(argv, operation)
+
+	if repo != "" {
+		argv = append(argv, repo)
+	}
+
+	unit.Service = fmt.Sprintf(`%s
+[Unit]
+Description=mugi %s (%s)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, marker, operation, target, execLine(argv))
+
+	unit.Timer = fmt.Sprintf(`%s
+[Unit]
+Description=Run mugi %s (%s) on schedule
+
+[Timer]
+OnCalendar=%s
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, marker, operation, target, calendar)
+
+	return unit
+}
+
+func escapeName(name string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c == '.' && i == 0, !isUnitNameChar(c):
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func isUnitNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == ':' || c == '_' || c == '.'
+}
+
+func execLine(argv []string) string {
+	quoted := make([]string, len(argv))
+
+	for i, arg := range argv {
+		arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(arg)
+
+		if arg == "" || strings.ContainsAny(arg, " \t'\";") {
+			arg = `"` + arg + `"`
+		}
+
+		quoted[i] = arg
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func Install(ctx context.Context, dir string, units []Unit, systemd bool) (written, removed []string, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	installed, err := generated(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keep := make(map[string]bool)
+
+	for _, unit := range units {
+		keep[unit.Name] = true
+	}
+
+	for _, name := range installed {
+		if keep[name] {
+			continue
+		}
+
+		if err := removeUnit(ctx, dir, name, systemd); err != nil {
+			return written, removed, err
+		}
+
+		removed = append(removed, name)
+	}
+
+	for _, unit := range units {
+		for _, file := range []struct{ ext, content string }{{".service", unit.Service}, {".timer", unit.Timer}} {
+			if err := os.WriteFile(filepath.Join(dir, unit.Name+file.ext), []byte(file.content), 0o644); err != nil {
+				return written, removed, err
+			}
+		}
+
+		written = append(written, unit.Name)
+	}
+
+	if !systemd {
+		return written, removed, nil
+	}
+
+	if _, err := systemctl(ctx, "daemon-reload"); err != nil {
+		return written, removed, err
+	}
+
+	for _, name := range written {
+		if _, err := systemctl(ctx, "enable", "--now", name+".timer"); err != nil {
+			return written, removed, err
+		}
+	}
+
+	return written, removed, nil
+}
+
+func Remove(ctx context.Context, dir string, systemd bool) ([]string, error) {
+	installed, err := generated(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+
+	for _, name := range installed {
+		if err := removeUnit(ctx, dir, name, systemd); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, name)
+	}
+
+	if systemd && len(removed) > 0 {
+		if _, err := systemctl(ctx, "daemon-reload"); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+func Status(ctx context.Context, dir string, units []Unit, systemd bool) ([]UnitStatus, error) {
+	installed, err := generated(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []UnitStatus
+
+	for _, unit := range units {
+		status := UnitStatus{Unit: unit, State: StateInstalled}
+
+		service, serviceErr := os.ReadFile(filepath.Join(dir, unit.Name+".service"))
+		timer, timerErr := os.ReadFile(filepath.Join(dir, unit.Name+".timer"))
+
+		switch {
+		case serviceErr != nil || timerErr != nil:
+			status.State = StateMissing
+		case string(service) != unit.Service || string(timer) != unit.Timer:
+			status.State = StateOutdated
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	for _, name := range installed {
+		if !slices.ContainsFunc(units, func(unit Unit) bool { return unit.Name == name }) {
+			statuses = append(statuses, UnitStatus{Unit: Unit{Name: name}, State: StateStale})
+		}
+	}
+
+	if !systemd {
+		return statuses, nil
+	}
+
+	for i, status := range statuses {
+		if status.State == StateMissing {
+			continue
+		}
+
+		timer := properties(ctx, status.Name+".timer", "ActiveState", "NextElapseUSecRealtime", "LastTriggerUSec")
+		service := properties(ctx, status.Name+".service", "Result")
+
+		statuses[i].Active = timer["ActiveState"]
+		statuses[i].Next = timer["NextElapseUSecRealtime"]
+		statuses[i].Last = timer["LastTriggerUSec"]
+		statuses[i].Result = service["Result"]
+	}
+
+	return statuses, nil
+}
+
+func generated(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".timer")
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil || !strings.HasPrefix(string(data), marker) {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func removeUnit(ctx context.Context, dir, name string, systemd bool) error {
+	if systemd {
+		systemctl(ctx, "disable", "--now", name+".timer")
+	}
+
+	for _, ext := range []string{".timer", ".service"} {
+		if err := os.Remove(filepath.Join(dir, name+ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func properties(ctx context.Context, unit string, names ...string) map[string]string {
+	values := make(map[string]string)
+
+	output, err := systemctl(ctx, "show", unit, "--property="+strings.Join(names, ","))
+	if err != nil {
+		return values
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = value
+		}
+	}
+
+	return values
+}
+
+func systemctl(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "systemctl", append([]string{"--user"}, args...)...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("systemctl %s: %s", strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
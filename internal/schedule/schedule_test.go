@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+func TestEscapeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"gemrest/september", "gemrest-september"},
+		{"fuwn/my-site", `fuwn-my\x2dsite`},
+		{"fuwn/my/site", "fuwn-my-site"},
+		{".dotfiles/vim.d", `\x2edotfiles-vim.d`},
+		{"a b\\c", `a\x20b\x5cc`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeName(tt.name); got != tt.want {
+			t.Errorf("escapeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInstallRendersUnits(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Config{
+		Defaults: config.Defaults{Schedule: config.Schedule{"fetch": "hourly"}},
+		Repos: map[string]config.Repo{
+			"fuwn/my-site": {Schedule: config.Schedule{"push": "*-*-* 02:00"}},
+			"fuwn/my/site": {Schedule: config.Schedule{"push": "daily"}},
+		},
+	}
+
+	units := Units(cfg, "/usr/bin/mugi", "/home/fuwn/my config.yaml")
+
+	written, removed, err := Install(context.Background(), dir, units, false)
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	want := []string{"mugi-fetch", `mugi-push-fuwn-my\x2dsite`, "mugi-push-fuwn-my-site"}
+
+	if !slices.Equal(written, want) || len(removed) != 0 {
+		t.Fatalf("Install() = %q, %q, want %q", written, removed, want)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	service := read(`mugi-push-fuwn-my\x2dsite.service`)
+
+	for _, line := range []string{
+		marker,
+		"Description=mugi push (fuwn/my-site)",
+		`ExecStart=/usr/bin/mugi --plain -c "/home/fuwn/my config.yaml" push fuwn/my-site`,
+	} {
+		if !strings.Contains(service, line+"\n") {
+			t.Errorf("service missing %q:\n%s", line, service)
+		}
+	}
+
+	calendars := map[string]string{
+		"mugi-fetch.timer":                "OnCalendar=hourly\n",
+		`mugi-push-fuwn-my\x2dsite.timer`: "OnCalendar=*-*-* 02:00\n",
+		"mugi-push-fuwn-my-site.timer":    "OnCalendar=daily\n",
+	}
+
+	for file, calendar := range calendars {
+		timer := read(file)
+
+		if !strings.HasPrefix(timer, marker) || !strings.Contains(timer, calendar) || !strings.Contains(timer, "WantedBy=timers.target\n") {
+			t.Errorf("%s = %q, want %q", file, timer, calendar)
+		}
+	}
+
+	statuses, err := Status(context.Background(), dir, units[:2], false)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	states := make(map[string]string)
+
+	for _, status := range statuses {
+		states[status.Name] = status.State
+	}
+
+	if states["mugi-fetch"] != StateInstalled || states["mugi-push-fuwn-my-site"] != StateStale {
+		t.Errorf("Status() states = %v", states)
+	}
+}
@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/redact"
+	"github.com/ebisu/mugi/pkg/mugi"
+)
+
+func NewCommandModel(runner git.Runner, argv []string, tasks []mugi.Task, verbose bool, jobs int) Model {
+	model := newModel(strings.Join(argv, " "), tasks, verbose, mugi.Options{Jobs: jobs, Runner: runner})
+	model.browse = true
+
+	return model
+}
+
+func RunCommands(runner git.Runner, argv []string, tasks []mugi.Task, verbose bool, jobs int) (int, error) {
+	p := tea.NewProgram(NewCommandModel(runner, argv, tasks, verbose, jobs))
+
+	m, err := p.Run()
+	if err != nil {
+		return 0, err
+	}
+
+	model, ok := m.(Model)
+	if !ok {
+		return 0, nil
+	}
+
+	_, failed, _, _ := model.summary()
+
+	return failed, nil
+}
+
+func RunCommandsPlain(w io.Writer, runner git.Runner, tasks []mugi.Task, jobs int) int {
+	var finished []mugi.Finished
+
+	for event := range mugi.Run(context.Background(), tasks, mugi.Options{Jobs: jobs, Runner: runner}) {
+		f, ok := event.(mugi.Finished)
+		if !ok {
+			continue
+		}
+
+		finished = append(finished, f)
+
+		line := filepath.Base(f.Task.RepoName)
+
+		switch f.Status {
+		case mugi.StatusSkipped:
+			line = "⊘ " + line + " skipped: " + f.Task.Skip
+		case mugi.StatusSucceeded:
+			line = "✓ " + line
+		default:
+			line = "✗ " + line
+		}
+
+		if output := f.Result.Output; output != "" {
+			line += "\n" + indentOutput(output, lipgloss.NewStyle())
+		}
+
+		fmt.Fprint(w, redact.String(line+"\n"))
+	}
+
+	summary := mugi.Summarize(finished)
+	line := fmt.Sprintf("\n%d succeeded", summary.Succeeded)
+
+	if summary.Failed > 0 {
+		line = fmt.Sprintf("\n%d failed, %d succeeded", summary.Failed, summary.Succeeded)
+	}
+
+	if summary.Skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", summary.Skipped)
+	}
+
+	fmt.Fprintln(w, line)
+
+	return summary.Failed
+}
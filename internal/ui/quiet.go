@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/redact"
+	"github.com/ebisu/mugi/pkg/mugi"
+)
+
+func RunPlain(w io.Writer, runner git.Runner, tasks []mugi.Task, verbose, force, linear bool) []mugi.Finished {
+	opts := mugi.Options{Force: force, Runner: runner}
+
+	if linear {
+		opts.Jobs = 1
+	}
+
+	var finished []mugi.Finished
+
+	for event := range mugi.Run(context.Background(), tasks, opts) {
+		f, ok := event.(mugi.Finished)
+		if !ok {
+			continue
+		}
+
+		finished = append(finished, f)
+
+		line := fmt.Sprintf("%s → %s", filepath.Base(f.Task.RepoName), f.Task.RemoteName)
+
+		switch f.Status {
+		case mugi.StatusSkipped:
+			line = "⊘ " + line + " skipped: " + f.Task.Skip
+		case mugi.StatusSucceeded:
+			line = "✓ " + line
+		case mugi.StatusBlocked:
+			line = "⊘ " + line
+		default:
+			line = "✗ " + line
+		}
+
+		if output := f.Result.Output; output != "" {
+			if verbose {
+				line += "\n" + indentOutput(output, lipgloss.NewStyle())
+			} else if f.Status != mugi.StatusSucceeded {
+				line += " " + firstLine(output)
+			}
+		}
+
+		fmt.Fprint(w, redact.String(line+"\n"))
+	}
+
+	summary := mugi.Summarize(finished)
+	line := fmt.Sprintf("\n%d succeeded", summary.Succeeded)
+
+	if summary.Failed > 0 {
+		line = fmt.Sprintf("\n%d failed, %d succeeded", summary.Failed, summary.Succeeded)
+	}
+
+	if summary.Blocked > 0 {
+		line += fmt.Sprintf(", %d blocked by hooks", summary.Blocked)
+	}
+
+	if summary.Skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", summary.Skipped)
+	}
+
+	fmt.Fprintln(w, line)
+
+	return finished
+}
+
+func InitPlain(w io.Writer, runner git.Runner, inits []RepoInit, verbose bool) error {
+	failed := 0
+
+	for _, init := range inits {
+		result := InitRepo(context.Background(), runner, init)
+		line := "✓ " + filepath.Base(init.Name)
+
+		if !result.Success {
+			line = "✗ " + filepath.Base(init.Name)
+			failed++
+		}
+
+		if result.Output != "" && (verbose || !result.Success) {
+			line += "\n" + indentOutput(result.Output, lipgloss.NewStyle())
+		}
+
+		fmt.Fprint(w, redact.String(line+"\n"))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("repository initialisation failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ebisu/mugi/internal/redact"
+)
+
+type SelectModel struct {
+	title     string
+	items     []string
+	selected  map[int]bool
+	cursor    int
+	confirmed bool
+}
+
+func NewSelectModel(title string, items []string) SelectModel {
+	selected := make(map[int]bool)
+
+	for i := range items {
+		selected[i] = true
+	}
+
+	return SelectModel{
+		title:    title,
+		items:    items,
+		selected: selected,
+	}
+}
+
+func (m SelectModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m SelectModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch key.String() {
+	case "q", "esc", "ctrl+c":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.items)-1 {
+			m.cursor++
+		}
+	case " ", "x":
+		m.selected[m.cursor] = !m.selected[m.cursor]
+	case "a":
+		all := len(m.Selected()) == len(m.items)
+
+		for i := range m.items {
+			m.selected[i] = !all
+		}
+	case "enter":
+		m.confirmed = true
+
+		return m, tea.Quit
+	}
+
+	return m, nil
+}
+
+func (m SelectModel) View() string {
+	if m.confirmed {
+		return ""
+	}
+
+	var b strings.Builder
+
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("212")).
+		Render(m.title)
+
+	b.WriteString(title + "\n\n")
+
+	cursorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+
+	for i, item := range m.items {
+		cursor := " "
+		if i == m.cursor {
+			cursor = cursorStyle.Render("›")
+		}
+
+		check := dimStyle.Render("○")
+		if m.selected[i] {
+			check = successStyle.Render("●")
+		}
+
+		b.WriteString(fmt.Sprintf("%s %s %s\n", cursor, check, item))
+	}
+
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render(fmt.Sprintf(
+		"%d/%d selected · space toggle · a all · enter confirm · q cancel",
+		len(m.Selected()), len(m.items),
+	)))
+	b.WriteString("\n")
+
+	return redact.String(b.String())
+}
+
+func (m SelectModel) Selected() []int {
+	var indices []int
+
+	for i := range m.items {
+		if m.selected[i] {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+func Select(title string, items []string) ([]int, error) {
+	p := tea.NewProgram(NewSelectModel(title, items))
+
+	m, err := p.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	selectModel, ok := m.(SelectModel)
+	if !ok || !selectModel.confirmed {
+		return nil, nil
+	}
+
+	return selectModel.Selected(), nil
+}
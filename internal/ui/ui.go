@@ -10,19 +10,12 @@ import (
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/ebisu/mugi/internal/config"
 	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/redact"
 	"github.com/ebisu/mugi/internal/remote"
+	"github.com/ebisu/mugi/pkg/mugi"
 )
 
-type Task struct {
-	RepoName   string
-	RemoteName string
-	RemoteURL  string
-	RepoPath   string
-	Op         remote.Operation
-}
-
 type taskState int
 
 const (
@@ -30,27 +23,49 @@ const (
 	taskRunning
 	taskSuccess
 	taskFailed
+	taskSkipped
+	taskBlocked
 )
 
-type taskResult struct {
-	task   Task
-	result git.Result
+type eventMsg struct {
+	event mugi.Event
+}
+
+type eventsDone struct{}
+
+type eventsStarted struct {
+	events <-chan mugi.Event
 }
 
 type Model struct {
-	tasks       []Task
-	states      map[string]taskState
-	results     map[string]git.Result
-	spinner     spinner.Model
-	operation   remote.Operation
-	verbose     bool
-	force       bool
-	linear      bool
-	currentTask int
-	done        bool
+	tasks    []mugi.Task
+	opts     mugi.Options
+	ctx      context.Context
+	cancel   context.CancelFunc
+	events   <-chan mugi.Event
+	states   map[string]taskState
+	results  map[string]git.Result
+	finished []mugi.Finished
+	spinner  spinner.Model
+	title    string
+	verbose  bool
+	done     bool
+	browse   bool
+	cursor   int
+	expanded map[string]bool
 }
 
-func NewModel(op remote.Operation, tasks []Task, verbose, force, linear bool) Model {
+func NewModel(runner git.Runner, op remote.Operation, tasks []mugi.Task, verbose, force, linear bool) Model {
+	opts := mugi.Options{Force: force, Runner: runner}
+
+	if linear {
+		opts.Jobs = 1
+	}
+
+	return newModel(fmt.Sprintf("%s repositories", op.Verb()), tasks, verbose, opts)
+}
+
+func newModel(title string, tasks []mugi.Task, verbose bool, opts mugi.Options) Model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
@@ -58,39 +73,50 @@ func NewModel(op remote.Operation, tasks []Task, verbose, force, linear bool) Mo
 	states := make(map[string]taskState)
 
 	for _, t := range tasks {
-		states[taskKey(t)] = taskPending
+		if t.Skip != "" {
+			states[t.Key()] = taskSkipped
+
+			continue
+		}
+
+		states[t.Key()] = taskPending
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return Model{
-		tasks:     tasks,
-		states:    states,
-		results:   make(map[string]git.Result),
-		spinner:   s,
-		operation: op,
-		verbose:   verbose,
-		force:     force,
-		linear:    linear,
+		tasks:    tasks,
+		opts:     opts,
+		ctx:      ctx,
+		cancel:   cancel,
+		states:   states,
+		results:  make(map[string]git.Result),
+		spinner:  s,
+		title:    title,
+		verbose:  verbose,
+		expanded: make(map[string]bool),
 	}
 }
 
-func taskKey(t Task) string {
-	return t.RepoName + ":" + t.RemoteName
+func (m Model) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, m.start())
 }
 
-func (m Model) Init() tea.Cmd {
-	cmds := []tea.Cmd{m.spinner.Tick}
+func (m Model) start() tea.Cmd {
+	return func() tea.Msg {
+		return eventsStarted{events: mugi.Run(m.ctx, m.tasks, m.opts)}
+	}
+}
 
-	if m.linear {
-		if len(m.tasks) > 0 {
-			cmds = append(cmds, m.runTask(m.tasks[0]))
-		}
-	} else {
-		for _, task := range m.tasks {
-			cmds = append(cmds, m.runTask(task))
+func (m Model) waitForEvent() tea.Cmd {
+	return func() tea.Msg {
+		event, ok := <-m.events
+		if !ok {
+			return eventsDone{}
 		}
-	}
 
-	return tea.Batch(cmds...)
+		return eventMsg{event: event}
+	}
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -98,7 +124,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "q", "ctrl+c":
+			m.cancel()
+
 			return m, tea.Quit
+		case "up", "k":
+			if m.browse && m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.browse && m.cursor < len(m.tasks)-1 {
+				m.cursor++
+			}
+		case "enter", " ":
+			if m.browse && len(m.tasks) > 0 {
+				key := m.tasks[m.cursor].Key()
+				m.expanded[key] = !m.expanded[key]
+			}
 		}
 
 	case spinner.TickMsg:
@@ -107,27 +148,45 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		return m, cmd
 
-	case taskResult:
-		key := taskKey(msg.task)
+	case eventsStarted:
+		m.events = msg.events
+
+		return m, m.waitForEvent()
+
+	case eventMsg:
+		switch event := msg.event.(type) {
+		case mugi.Started:
+			m.states[event.Task.Key()] = taskRunning
+		case mugi.Finished:
+			key := event.Task.Key()
+			m.finished = append(m.finished, event)
+
+			switch event.Status {
+			case mugi.StatusSucceeded:
+				m.states[key] = taskSuccess
+			case mugi.StatusFailed:
+				m.states[key] = taskFailed
+			case mugi.StatusBlocked:
+				m.states[key] = taskBlocked
+			case mugi.StatusSkipped:
+				m.states[key] = taskSkipped
+			}
 
-		if msg.result.Error != nil {
-			m.states[key] = taskFailed
-		} else {
-			m.states[key] = taskSuccess
+			if event.Status != mugi.StatusSkipped {
+				m.results[key] = event.Result
+			}
 		}
 
-		m.results[key] = msg.result
-		m.currentTask++
+		return m, m.waitForEvent()
 
-		if m.allDone() {
-			m.done = true
+	case eventsDone:
+		m.done = true
 
-			return m, tea.Quit
+		if m.browse {
+			return m, nil
 		}
 
-		if m.linear && m.currentTask < len(m.tasks) {
-			return m, m.runTask(m.tasks[m.currentTask])
-		}
+		return m, tea.Quit
 	}
 
 	return m, nil
@@ -139,16 +198,17 @@ func (m Model) View() string {
 	title := lipgloss.NewStyle().
 		Bold(true).
 		Foreground(lipgloss.Color("212")).
-		Render(fmt.Sprintf("%s repositories", m.operation.Verb()))
+		Render(m.title)
 
 	b.WriteString(title + "\n\n")
 
 	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
 	failStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
 	dimStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	blockedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
 
-	for _, task := range m.tasks {
-		key := taskKey(task)
+	for i, task := range m.tasks {
+		key := task.Key()
 		state := m.states[key]
 
 		var status string
@@ -161,15 +221,37 @@ func (m Model) View() string {
 			status = successStyle.Render("✓")
 		case taskFailed:
 			status = failStyle.Render("✗")
+		case taskSkipped:
+			status = dimStyle.Render("⊘")
+		case taskBlocked:
+			status = blockedStyle.Render("⊘")
 		}
 
 		repoName := filepath.Base(task.RepoName)
 		line := fmt.Sprintf("%s %s → %s", status, repoName, task.RemoteName)
 
+		if task.RemoteName == "" {
+			line = fmt.Sprintf("%s %s", status, repoName)
+		}
+
+		if m.browse {
+			cursor := "  "
+
+			if i == m.cursor {
+				cursor = lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Render("›") + " "
+			}
+
+			line = cursor + line
+		}
+
+		if state == taskSkipped {
+			line += dimStyle.Render(" skipped: " + task.Skip)
+		}
+
 		if result, ok := m.results[key]; ok && result.Output != "" {
-			if m.verbose {
+			if m.verbose || m.expanded[key] {
 				line += "\n" + indentOutput(result.Output, dimStyle)
-			} else if state == taskFailed {
+			} else if m.browse || state == taskFailed || state == taskBlocked {
 				line += dimStyle.Render(" " + firstLine(result.Output))
 			}
 		}
@@ -180,7 +262,7 @@ func (m Model) View() string {
 	if m.done {
 		b.WriteString("\n")
 
-		success, failed := m.summary()
+		success, failed, skipped, blocked := m.summary()
 
 		if failed > 0 {
 			b.WriteString(failStyle.Render(fmt.Sprintf("%d failed", failed)))
@@ -188,43 +270,38 @@ func (m Model) View() string {
 		}
 
 		b.WriteString(successStyle.Render(fmt.Sprintf("%d succeeded", success)))
-		b.WriteString("\n")
-	}
-
-	return b.String()
-}
-
-func (m *Model) runTask(task Task) tea.Cmd {
-	return func() tea.Msg {
-		op := task.Op
 
-		if op == 0 {
-			op = m.operation
+		if blocked > 0 {
+			b.WriteString(", ")
+			b.WriteString(blockedStyle.Render(fmt.Sprintf("%d blocked by hooks", blocked)))
 		}
 
-		result := git.Execute(context.Background(), op, task.RepoPath, task.RemoteName, m.force)
+		if skipped > 0 {
+			b.WriteString(", ")
+			b.WriteString(dimStyle.Render(fmt.Sprintf("%d skipped", skipped)))
+		}
 
-		return taskResult{task: task, result: result}
-	}
-}
+		b.WriteString("\n")
 
-func (m Model) allDone() bool {
-	for _, state := range m.states {
-		if state == taskPending || state == taskRunning {
-			return false
+		if m.browse {
+			b.WriteString(dimStyle.Render("↑/↓ select · enter show output · q quit") + "\n")
 		}
 	}
 
-	return true
+	return redact.String(b.String())
 }
 
-func (m Model) summary() (success, failed int) {
+func (m Model) summary() (success, failed, skipped, blocked int) {
 	for _, state := range m.states {
 		switch state {
 		case taskSuccess:
 			success++
 		case taskFailed:
 			failed++
+		case taskSkipped:
+			skipped++
+		case taskBlocked:
+			blocked++
 		}
 	}
 	return
@@ -248,77 +325,23 @@ func indentOutput(s string, style lipgloss.Style) string {
 	return strings.Join(lines, "\n")
 }
 
-func Run(op remote.Operation, tasks []Task, verbose, force, linear bool) error {
-	if op == remote.Pull {
-		inits := NeedsInit(tasks)
-		if len(inits) > 0 {
-			if err := runInit(inits, verbose); err != nil {
-				return err
-			}
-		}
-	}
-
-	syncRemotes(tasks)
-
-	if op == remote.Pull {
-		tasks = adjustPullTasks(tasks)
-	}
-
-	model := NewModel(op, tasks, verbose, force, linear)
-	p := tea.NewProgram(model)
-
-	_, err := p.Run()
-
-	return err
-}
-
-func syncRemotes(tasks []Task) {
-	ctx := context.Background()
-	seen := make(map[string]bool)
-
-	for _, task := range tasks {
-		key := task.RepoPath + ":" + task.RemoteName
-
-		if seen[key] {
-			continue
-		}
-
-		seen[key] = true
+func Run(runner git.Runner, op remote.Operation, tasks []mugi.Task, verbose, force, linear bool) ([]mugi.Finished, error) {
+	p := tea.NewProgram(NewModel(runner, op, tasks, verbose, force, linear))
 
-		if !git.IsRepo(task.RepoPath) {
-			continue
-		}
-
-		currentURL := git.GetRemoteURL(task.RepoPath, task.RemoteName)
-
-		if currentURL == "" {
-			git.AddRemote(ctx, task.RepoPath, task.RemoteName, task.RemoteURL)
-		} else if currentURL != task.RemoteURL {
-			git.SetRemoteURL(ctx, task.RepoPath, task.RemoteName, task.RemoteURL)
-		}
+	m, err := p.Run()
+	if err != nil {
+		return nil, err
 	}
-}
-
-func adjustPullTasks(tasks []Task) []Task {
-	firstPerRepo := make(map[string]bool)
-	result := make([]Task, len(tasks))
 
-	for i, task := range tasks {
-		result[i] = task
-
-		if firstPerRepo[task.RepoPath] {
-			result[i].Op = remote.Fetch
-		} else {
-			result[i].Op = remote.Pull
-			firstPerRepo[task.RepoPath] = true
-		}
+	if model, ok := m.(Model); ok {
+		return model.finished, nil
 	}
 
-	return result
+	return nil, nil
 }
 
-func runInit(inits []RepoInit, verbose bool) error {
-	model := NewInitModel(inits, verbose)
+func RunInit(runner git.Runner, inits []RepoInit, verbose bool) error {
+	model := NewInitModel(runner, inits, verbose)
 	p := tea.NewProgram(model)
 
 	m, err := p.Run()
@@ -337,30 +360,6 @@ func runInit(inits []RepoInit, verbose bool) error {
 	return nil
 }
 
-func BuildTasks(cfg config.Config, repoName string, remoteNames []string) []Task {
-	var tasks []Task
-
-	repos := resolveRepos(cfg, repoName)
-
-	for _, fullName := range repos {
-		repo := cfg.Repos[fullName]
-		remotes := resolveRemotes(cfg, repo, remoteNames)
-
-		for _, remoteName := range remotes {
-			if url, ok := repo.Remotes[remoteName]; ok {
-				tasks = append(tasks, Task{
-					RepoName:   fullName,
-					RemoteName: remoteName,
-					RemoteURL:  url,
-					RepoPath:   repo.ExpandPath(),
-				})
-			}
-		}
-	}
-
-	return tasks
-}
-
 type RepoInit struct {
 	Name    string
 	Path    string
@@ -380,6 +379,7 @@ type initTaskResult struct {
 }
 
 type InitModel struct {
+	runner  git.Runner
 	inits   []RepoInit
 	states  map[string]taskState
 	results map[string]InitResult
@@ -388,7 +388,7 @@ type InitModel struct {
 	done    bool
 }
 
-func NewInitModel(inits []RepoInit, verbose bool) InitModel {
+func NewInitModel(runner git.Runner, inits []RepoInit, verbose bool) InitModel {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
@@ -400,6 +400,7 @@ func NewInitModel(inits []RepoInit, verbose bool) InitModel {
 	}
 
 	return InitModel{
+		runner:  runner,
 		inits:   inits,
 		states:  states,
 		results: make(map[string]InitResult),
@@ -496,12 +497,12 @@ func (m InitModel) View() string {
 		b.WriteString("\n")
 	}
 
-	return b.String()
+	return redact.String(b.String())
 }
 
 func (m *InitModel) runInit(init RepoInit) tea.Cmd {
 	return func() tea.Msg {
-		result := InitRepo(context.Background(), init)
+		result := InitRepo(context.Background(), m.runner, init)
 
 		return initTaskResult{init: init, result: result}
 	}
@@ -517,7 +518,8 @@ func (m InitModel) allDone() bool {
 	return true
 }
 
-func NeedsInit(tasks []Task) []RepoInit {
+func NeedsInit(ctx context.Context, runner git.Runner, tasks []mugi.Task) []RepoInit {
+	client := git.New(runner)
 	seen := make(map[string]bool)
 
 	var inits []RepoInit
@@ -535,7 +537,7 @@ func NeedsInit(tasks []Task) []RepoInit {
 			continue
 		}
 
-		if !git.IsRepo(task.RepoPath) {
+		if !client.IsRepo(ctx, task.RepoPath) {
 			inits = append(inits, collectRepoInit(tasks, task.RepoPath, task.RepoName))
 		}
 	}
@@ -543,7 +545,7 @@ func NeedsInit(tasks []Task) []RepoInit {
 	return inits
 }
 
-func collectRepoInit(tasks []Task, path, name string) RepoInit {
+func collectRepoInit(tasks []mugi.Task, path, name string) RepoInit {
 	remotes := make(map[string]string)
 
 	for _, t := range tasks {
@@ -555,7 +557,8 @@ func collectRepoInit(tasks []Task, path, name string) RepoInit {
 	return RepoInit{Name: name, Path: path, Remotes: remotes}
 }
 
-func InitRepo(ctx context.Context, init RepoInit) InitResult {
+func InitRepo(ctx context.Context, runner git.Runner, init RepoInit) InitResult {
+	client := git.New(runner)
 	result := InitResult{Repo: init.Name}
 
 	var firstRemote, firstURL string
@@ -574,7 +577,7 @@ func InitRepo(ctx context.Context, init RepoInit) InitResult {
 		return result
 	}
 
-	cloneResult := git.Clone(ctx, firstURL, init.Path)
+	cloneResult := client.Clone(ctx, firstURL, init.Path)
 
 	if cloneResult.Error != nil {
 		result.Error = cloneResult.Error
@@ -585,7 +588,7 @@ func InitRepo(ctx context.Context, init RepoInit) InitResult {
 
 	outputs := []string{fmt.Sprintf("Cloned from %s", firstRemote)}
 
-	renameResult := git.RenameRemote(ctx, init.Path, "origin", firstRemote)
+	renameResult := client.RenameRemote(ctx, init.Path, "origin", firstRemote)
 
 	if renameResult.Error != nil {
 		result.Error = renameResult.Error
@@ -599,7 +602,7 @@ func InitRepo(ctx context.Context, init RepoInit) InitResult {
 			continue
 		}
 
-		addResult := git.AddRemote(ctx, init.Path, name, url)
+		addResult := client.AddRemote(ctx, init.Path, name, url)
 
 		if addResult.Error != nil {
 			result.Error = addResult.Error
@@ -616,35 +619,3 @@ func InitRepo(ctx context.Context, init RepoInit) InitResult {
 
 	return result
 }
-
-func resolveRepos(cfg config.Config, name string) []string {
-	if name == remote.All {
-		return cfg.AllRepos()
-	}
-
-	if fullName, _, ok := cfg.FindRepo(name); ok {
-		return []string{fullName}
-	}
-
-	return nil
-}
-
-func resolveRemotes(cfg config.Config, repo config.Repo, names []string) []string {
-	if len(names) == 1 && names[0] == remote.All {
-		remotes := make([]string, 0, len(repo.Remotes))
-
-		for name := range repo.Remotes {
-			remotes = append(remotes, name)
-		}
-
-		return remotes
-	}
-
-	resolved := make([]string, 0, len(names))
-
-	for _, name := range names {
-		resolved = append(resolved, cfg.ResolveAlias(name))
-	}
-
-	return resolved
-}
@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ebisu/mugi/internal/git/gittest"
+	"github.com/ebisu/mugi/internal/remote"
+	"github.com/ebisu/mugi/pkg/mugi"
+)
+
+const testURL = "https://codeberg.org/ebisu/mugi.git"
+
+func TestInitRepo(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  func(f *gittest.Fake, path string)
+		success bool
+		output  string
+		calls   int
+	}{
+		{
+			name:    "clones and renames origin",
+			success: true,
+			output:  "Cloned from codeberg",
+			calls:   2,
+		},
+		{
+			name: "clone failure",
+			script: func(f *gittest.Fake, path string) {
+				f.On("git clone "+testURL+" "+path, gittest.Response{Stderr: "fatal: repository not found", Exit: 128})
+			},
+			output: "fatal: repository not found",
+			calls:  1,
+		},
+		{
+			name: "rename failure",
+			script: func(f *gittest.Fake, path string) {
+				f.On("git remote rename origin codeberg", gittest.Response{Stderr: "error: remote codeberg already exists.", Exit: 3})
+			},
+			output: "error: remote codeberg already exists.",
+			calls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ebisu", "mugi")
+			fake := gittest.NewFake()
+
+			if tt.script != nil {
+				tt.script(fake, path)
+			}
+
+			result := InitRepo(context.Background(), fake, RepoInit{
+				Name:    "ebisu/mugi",
+				Path:    path,
+				Remotes: map[string]string{"codeberg": testURL},
+			})
+
+			if result.Success != tt.success || result.Output != tt.output {
+				t.Errorf("InitRepo() = %v %q, want %v %q", result.Success, result.Output, tt.success, tt.output)
+			}
+
+			want := []string{"git clone " + testURL + " " + path, "git remote rename origin codeberg"}[:tt.calls]
+
+			if got := fake.Argv(); !slices.Equal(got, want) {
+				t.Errorf("argv = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestInitRepoAddsRemotes(t *testing.T) {
+	remotes := map[string]string{
+		"codeberg":  testURL,
+		"github":    "git@github.com:ebisu/mugi.git",
+		"sourcehut": "git@git.sr.ht:~ebisu/mugi",
+	}
+
+	path := filepath.Join(t.TempDir(), "mugi")
+	fake := gittest.NewFake()
+
+	result := InitRepo(context.Background(), fake, RepoInit{Name: "ebisu/mugi", Path: path, Remotes: remotes})
+	if !result.Success {
+		t.Fatalf("InitRepo() failed: %s", result.Output)
+	}
+
+	argv := fake.Argv()
+	if len(argv) != 4 {
+		t.Fatalf("argv = %q, want clone, rename and two adds", argv)
+	}
+
+	first := strings.TrimPrefix(argv[1], "git remote rename origin ")
+
+	if argv[0] != "git clone "+remotes[first]+" "+path {
+		t.Errorf("clone = %q, want clone of %s", argv[0], first)
+	}
+
+	added := argv[2:]
+	slices.Sort(added)
+
+	var want []string
+
+	for name, url := range remotes {
+		if name != first {
+			want = append(want, "git remote add "+name+" "+url)
+		}
+	}
+
+	slices.Sort(want)
+
+	if !slices.Equal(added, want) {
+		t.Errorf("added = %q, want %q", added, want)
+	}
+}
+
+func TestModelStartsRunFromInit(t *testing.T) {
+	fake := gittest.NewFake()
+	tasks := []mugi.Task{{RepoName: "ebisu/demo", RepoPath: "/repo", RemoteName: "origin", RemoteURL: testURL, Op: mugi.Fetch}}
+
+	model := NewModel(fake, remote.Fetch, tasks, false, false, false)
+
+	if calls := fake.Argv(); len(calls) != 0 {
+		t.Fatalf("NewModel() ran git: %q", calls)
+	}
+
+	started, ok := model.start()().(eventsStarted)
+	if !ok {
+		t.Fatal("start() did not return eventsStarted")
+	}
+
+	if finished := mugi.Collect(started.events); len(finished) != 1 || finished[0].Status != mugi.StatusSucceeded {
+		t.Errorf("finished = %+v, want one success", finished)
+	}
+
+	if !slices.ContainsFunc(fake.Argv(), func(argv string) bool { return strings.HasPrefix(argv, "git fetch") }) {
+		t.Errorf("argv = %q, want a fetch", fake.Argv())
+	}
+}
+
+func TestModelQuitCancelsRun(t *testing.T) {
+	model := NewModel(gittest.NewFake(), remote.Fetch, nil, false, false, false)
+
+	updated, _ := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+
+	if err := updated.(Model).ctx.Err(); err == nil {
+		t.Error("quitting did not cancel the run context")
+	}
+}
+
+func TestRunCommandsPlain(t *testing.T) {
+	argv := []string{"git", "status", "-sb"}
+	clean, dirty := t.TempDir(), t.TempDir()
+
+	fake := gittest.NewFake()
+	fake.OnDir(clean, "git status -sb", gittest.Response{Stdout: "## main...origin/main\n"})
+	fake.OnDir(dirty, "git status -sb", gittest.Response{Stderr: "fatal: not a git repository", Exit: 128})
+
+	tasks := []mugi.Task{
+		{RepoName: "ebisu/clean", RepoPath: clean, Command: argv},
+		{RepoName: "ebisu/dirty", RepoPath: dirty, Command: argv},
+		{RepoName: "ebisu/shared", RepoPath: clean, Command: argv, Skip: "path shared with ebisu/clean"},
+	}
+
+	var out strings.Builder
+
+	if failed := RunCommandsPlain(&out, fake, tasks, 1); failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+
+	for _, want := range []string{
+		"✓ clean\n",
+		"## main...origin/main",
+		"✗ dirty\n",
+		"fatal: not a git repository",
+		"⊘ shared skipped: path shared with ebisu/clean",
+		"1 failed, 1 succeeded, 1 skipped",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/ebisu/mugi/internal/git"
+	"golang.org/x/sys/unix"
+)
+
+const refMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_CLOSE_WRITE | unix.IN_DELETE
+
+type watchTarget struct {
+	repo   string
+	dir    string
+	gitDir bool
+}
+
+type inotifyWatcher struct {
+	fd      int
+	watches map[int]watchTarget
+	events  chan string
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newRefWatcher(_ git.Runner, gitDirs map[string]string) (refWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &inotifyWatcher{
+		fd:      fd,
+		watches: make(map[int]watchTarget),
+		events:  make(chan string, 64),
+		done:    make(chan struct{}),
+	}
+
+	for repo, gitDir := range gitDirs {
+		if err := w.add(watchTarget{repo: repo, dir: gitDir, gitDir: true}); err != nil {
+			unix.Close(fd)
+
+			return nil, err
+		}
+
+		for _, dir := range []string{"heads", "tags"} {
+			if err := w.addTree(repo, filepath.Join(gitDir, "refs", dir)); err != nil {
+				unix.Close(fd)
+
+				return nil, err
+			}
+		}
+	}
+
+	w.wg.Add(1)
+
+	go w.loop()
+
+	return w, nil
+}
+
+func (w *inotifyWatcher) add(target watchTarget) error {
+	wd, err := unix.InotifyAddWatch(w.fd, target.dir, refMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: target.dir, Err: err}
+	}
+
+	w.watches[wd] = target
+
+	return nil
+}
+
+func (w *inotifyWatcher) addTree(repo, root string) error {
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		return w.add(watchTarget{repo: repo, dir: path})
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (w *inotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	w.wg.Wait()
+
+	return unix.Close(w.fd)
+}
+
+func (w *inotifyWatcher) loop() {
+	defer w.wg.Done()
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+	for {
+		fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+
+		ready, err := unix.Poll(fds, 500)
+
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		if err != nil || ready == 0 {
+			continue
+		}
+
+		n, err := unix.Read(w.fd, buf)
+		if err != nil || n < unix.SizeofInotifyEvent {
+			continue
+		}
+
+		w.handle(buf[:n])
+	}
+}
+
+func (w *inotifyWatcher) handle(buf []byte) {
+	changed := make(map[string]bool)
+
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		offset = nameEnd
+
+		if nameEnd > len(buf) {
+			break
+		}
+
+		name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+
+		target, ok := w.watches[int(event.Wd)]
+		if !ok || strings.HasSuffix(name, ".lock") {
+			continue
+		}
+
+		if target.gitDir {
+			if name == "packed-refs" {
+				changed[target.repo] = true
+			}
+
+			continue
+		}
+
+		if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			w.addTree(target.repo, filepath.Join(target.dir, name))
+		}
+
+		changed[target.repo] = true
+	}
+
+	for repo := range changed {
+		select {
+		case w.events <- repo:
+		case <-w.done:
+			return
+		}
+	}
+}
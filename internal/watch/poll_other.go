@@ -0,0 +1,85 @@
+//go:build !linux
+
+package watch
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/ebisu/mugi/internal/git"
+)
+
+const pollInterval = 2 * time.Second
+
+type pollWatcher struct {
+	client  git.Client
+	gitDirs map[string]string
+	events  chan string
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newRefWatcher(runner git.Runner, gitDirs map[string]string) (refWatcher, error) {
+	w := &pollWatcher{
+		client:  git.New(runner),
+		gitDirs: gitDirs,
+		events:  make(chan string, 64),
+		done:    make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+
+	go w.loop()
+
+	return w, nil
+}
+
+func (w *pollWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	w.wg.Wait()
+
+	return nil
+}
+
+func (w *pollWatcher) loop() {
+	defer w.wg.Done()
+
+	snapshots := make(map[string]map[string]string)
+
+	for repo, gitDir := range w.gitDirs {
+		snapshots[repo] = w.client.LocalRefs(context.Background(), gitDir)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		for repo, gitDir := range w.gitDirs {
+			refs := w.client.LocalRefs(context.Background(), gitDir)
+
+			if maps.Equal(refs, snapshots[repo]) {
+				continue
+			}
+
+			snapshots[repo] = refs
+
+			select {
+			case w.events <- repo:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package watch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const socketTimeout = 5 * time.Second
+
+func listen(path string) (net.Listener, error) {
+	if err := secureDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+
+			return nil, fmt.Errorf("watch already running on %s", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func secureDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+
+	uid, ok := fileOwner(info)
+	if !ok {
+		return nil
+	}
+
+	if uid != os.Getuid() {
+		return fmt.Errorf("socket directory %s is owned by uid %d, not you", dir, uid)
+	}
+
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("socket directory %s is writable by other users (mode %04o)", dir, info.Mode().Perm())
+	}
+
+	return nil
+}
+
+func (d *Daemon) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go d.handle(conn)
+	}
+}
+
+func (d *Daemon) handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(socketTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return
+	}
+
+	encoder := json.NewEncoder(conn)
+
+	switch command := strings.TrimSpace(line); command {
+	case "", "status":
+		encoder.Encode(d.Status())
+	case "reload", "fetch":
+		select {
+		case d.requests <- command:
+			encoder.Encode(map[string]bool{"ok": true})
+		case <-d.done:
+			encoder.Encode(map[string]string{"error": "watch is stopping"})
+		}
+	default:
+		encoder.Encode(map[string]string{"error": "unknown command: " + command})
+	}
+}
+
+func Query(path, command string) (Status, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return Status{}, fmt.Errorf("watch not running on %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(socketTimeout))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return Status{}, err
+	}
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		return Status{}, err
+	}
+
+	var reply struct {
+		Status
+		Error string `json:"error"`
+	}
+
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return Status{}, err
+	}
+
+	if reply.Error != "" {
+		return Status{}, errors.New(reply.Error)
+	}
+
+	return reply.Status, nil
+}
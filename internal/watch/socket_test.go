@@ -0,0 +1,66 @@
+//go:build unix
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecureDir(t *testing.T) {
+	root := t.TempDir()
+
+	created := filepath.Join(root, "created")
+
+	if err := secureDir(created); err != nil {
+		t.Fatalf("secureDir() error = %v", err)
+	}
+
+	if info, err := os.Stat(created); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o700 {
+		t.Errorf("created mode = %v, want 0700", info.Mode().Perm())
+	}
+
+	shared := filepath.Join(root, "shared")
+
+	if err := os.Mkdir(shared, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(shared, 0o777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := secureDir(shared); err == nil || !strings.Contains(err.Error(), "writable by other users") {
+		t.Errorf("secureDir(0777) error = %v, want writable error", err)
+	}
+
+	link := filepath.Join(root, "link")
+
+	if err := os.Symlink(created, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := secureDir(link); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("secureDir(symlink) error = %v, want not a directory", err)
+	}
+}
+
+func TestListenSocketMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mugi", "watch.sock")
+
+	listener, err := listen(path)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %v, want 0600", info.Mode().Perm())
+	}
+}
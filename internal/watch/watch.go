@@ -0,0 +1,507 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/notify"
+	"github.com/ebisu/mugi/internal/redact"
+	"github.com/ebisu/mugi/internal/remote"
+	"github.com/ebisu/mugi/pkg/mugi"
+)
+
+const jobs = 4
+
+type refWatcher interface {
+	Events() <-chan string
+	Close() error
+}
+
+type RemoteStatus struct {
+	Op    string    `json:"op"`
+	At    time.Time `json:"at"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+type RepoStatus struct {
+	Repo       string                  `json:"repo"`
+	Path       string                  `json:"path"`
+	Watching   bool                    `json:"watching"`
+	Running    string                  `json:"running,omitempty"`
+	LastChange time.Time               `json:"last_change,omitzero"`
+	LastFetch  time.Time               `json:"last_fetch,omitzero"`
+	LastPush   time.Time               `json:"last_push,omitzero"`
+	Remotes    map[string]RemoteStatus `json:"remotes"`
+}
+
+type Status struct {
+	PID         int          `json:"pid"`
+	Started     time.Time    `json:"started"`
+	Reloaded    time.Time    `json:"reloaded"`
+	ReloadError string       `json:"reload_error,omitempty"`
+	NextFetch   time.Time    `json:"next_fetch"`
+	Repos       []RepoStatus `json:"repos"`
+}
+
+type Daemon struct {
+	configPath string
+	socket     string
+	log        io.Writer
+	runner     git.Runner
+
+	mu         sync.Mutex
+	cfg        config.Config
+	repos      map[string]*RepoStatus
+	gitDirs    map[string]string
+	quietUntil map[string]time.Time
+	timers     map[string]*time.Timer
+	started    time.Time
+	reloaded   time.Time
+	reloadErr  string
+	nextFetch  time.Time
+
+	watcher  refWatcher
+	pushes   chan string
+	requests chan string
+	done     chan struct{}
+	running  sync.WaitGroup
+}
+
+func New(runner git.Runner, configPath, socket string, log io.Writer) (*Daemon, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	now := time.Now()
+
+	d := &Daemon{
+		configPath: configPath,
+		socket:     socket,
+		log:        log,
+		runner:     runner,
+		repos:      make(map[string]*RepoStatus),
+		quietUntil: make(map[string]time.Time),
+		timers:     make(map[string]*time.Timer),
+		started:    now,
+		reloaded:   now,
+		pushes:     make(chan string, 16),
+		requests:   make(chan string, 4),
+		done:       make(chan struct{}),
+	}
+
+	d.apply(cfg)
+
+	return d, nil
+}
+
+func (d *Daemon) SocketPath() string {
+	if d.socket != "" {
+		return d.socket
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cfg.Defaults.Watch.SocketPath()
+}
+
+func (d *Daemon) Run(ctx context.Context) error {
+	listener, err := listen(d.SocketPath())
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	watcher, err := newRefWatcher(d.runner, d.gitDirs)
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+
+	d.watcher = watcher
+
+	go d.serve(listener)
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	interval := d.cfg.Defaults.Watch.Interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	d.logf("watching %d repositories, fetching every %s, socket %s", len(d.gitDirs), interval, listener.Addr())
+	d.scheduleFetch(interval)
+	d.startFetch(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.shutdown()
+
+			return nil
+		case <-hangups:
+			d.reload(ticker)
+		case request := <-d.requests:
+			switch request {
+			case "reload":
+				d.reload(ticker)
+			case "fetch":
+				d.startFetch(ctx)
+			}
+		case <-ticker.C:
+			d.scheduleFetch(d.cfg.Defaults.Watch.Interval())
+			d.startFetch(ctx)
+		case name := <-d.watcher.Events():
+			d.changed(name)
+		case name := <-d.pushes:
+			d.startPush(ctx, name)
+		}
+	}
+}
+
+func (d *Daemon) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := Status{
+		PID:         os.Getpid(),
+		Started:     d.started,
+		Reloaded:    d.reloaded,
+		ReloadError: d.reloadErr,
+		NextFetch:   d.nextFetch,
+		Repos:       make([]RepoStatus, 0, len(d.repos)),
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(d.repos)) {
+		repo := *d.repos[name]
+		repo.Remotes = maps.Clone(repo.Remotes)
+		status.Repos = append(status.Repos, repo)
+	}
+
+	return status
+}
+
+func (d *Daemon) apply(cfg config.Config) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.cfg = cfg
+	d.gitDirs = make(map[string]string)
+
+	repos := make(map[string]*RepoStatus)
+
+	for _, name := range cfg.AllRepos() {
+		path := cfg.Repos[name].ExpandPath()
+
+		status, ok := d.repos[name]
+		if !ok {
+			status = &RepoStatus{Repo: name, Remotes: make(map[string]RemoteStatus)}
+		}
+
+		status.Path = path
+		status.Watching = false
+
+		if gitDir := git.New(d.runner).CommonDir(context.Background(), path); gitDir != "" {
+			d.gitDirs[name] = gitDir
+			status.Watching = true
+		}
+
+		repos[name] = status
+	}
+
+	for name, timer := range d.timers {
+		if _, ok := repos[name]; !ok {
+			timer.Stop()
+			delete(d.timers, name)
+		}
+	}
+
+	d.repos = repos
+}
+
+func (d *Daemon) reload(ticker *time.Ticker) {
+	cfg, err := config.Load(d.configPath)
+	if err != nil {
+		d.mu.Lock()
+		d.reloadErr = err.Error()
+		d.mu.Unlock()
+
+		d.logf("reload failed, keeping previous config: %v", err)
+
+		return
+	}
+
+	previousSocket := d.SocketPath()
+
+	d.apply(cfg)
+
+	watcher, err := newRefWatcher(d.runner, d.gitDirs)
+	if err != nil {
+		d.logf("reload failed to watch repositories: %v", err)
+	} else {
+		d.watcher.Close()
+		d.watcher = watcher
+	}
+
+	interval := cfg.Defaults.Watch.Interval()
+	ticker.Reset(interval)
+
+	d.mu.Lock()
+	d.reloaded = time.Now()
+	d.reloadErr = ""
+	d.mu.Unlock()
+
+	d.scheduleFetch(interval)
+
+	if socket := cfg.Defaults.Watch.SocketPath(); d.socket == "" && socket != previousSocket {
+		d.logf("socket changed to %s, restart to apply", socket)
+	}
+
+	d.logf("reloaded config, watching %d repositories", len(d.gitDirs))
+}
+
+func (d *Daemon) scheduleFetch(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextFetch = time.Now().Add(interval)
+}
+
+func (d *Daemon) changed(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status, ok := d.repos[name]
+	if !ok || status.Running == remote.Fetch.String() || time.Now().Before(d.quietUntil[name]) {
+		return
+	}
+
+	status.LastChange = time.Now()
+
+	if !d.cfg.Defaults.Watch.PushesOnChange() {
+		return
+	}
+
+	d.debounce(name)
+}
+
+func (d *Daemon) debounce(name string) {
+	delay := d.cfg.Defaults.Watch.DebounceDelay()
+
+	if timer, ok := d.timers[name]; ok && timer.Stop() {
+		timer.Reset(delay)
+
+		return
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+
+		if d.timers[name] != timer {
+			d.mu.Unlock()
+
+			return
+		}
+
+		delete(d.timers, name)
+		d.mu.Unlock()
+
+		select {
+		case d.pushes <- name:
+		case <-d.done:
+		}
+	})
+
+	d.timers[name] = timer
+}
+
+func (d *Daemon) startFetch(ctx context.Context) {
+	d.mu.Lock()
+
+	var names []string
+
+	for _, name := range slices.Sorted(maps.Keys(d.repos)) {
+		status := d.repos[name]
+
+		if status.Watching && status.Running == "" {
+			status.Running = remote.Fetch.String()
+			names = append(names, name)
+		}
+	}
+
+	cfg := d.cfg
+
+	d.mu.Unlock()
+
+	if len(names) == 0 {
+		return
+	}
+
+	d.running.Add(1)
+
+	go d.execute(ctx, cfg, remote.Fetch, names)
+}
+
+func (d *Daemon) startPush(ctx context.Context, name string) {
+	d.mu.Lock()
+
+	status, ok := d.repos[name]
+	if !ok {
+		d.mu.Unlock()
+
+		return
+	}
+
+	if status.Running != "" {
+		d.debounce(name)
+		d.mu.Unlock()
+
+		return
+	}
+
+	status.Running = remote.Push.String()
+	cfg := d.cfg
+
+	d.mu.Unlock()
+
+	d.running.Add(1)
+
+	go d.execute(ctx, cfg, remote.Push, []string{name})
+}
+
+func (d *Daemon) execute(ctx context.Context, cfg config.Config, op remote.Operation, names []string) {
+	defer d.running.Done()
+
+	var tasks []mugi.Task
+
+	for _, name := range names {
+		tasks = append(tasks, mugi.Plan(cfg, name, nil, op)...)
+	}
+
+	var finished []mugi.Finished
+
+	for event := range mugi.Run(ctx, tasks, mugi.Options{Jobs: jobs, Runner: d.runner}) {
+		if f, ok := event.(mugi.Finished); ok && f.Status != mugi.StatusSkipped {
+			finished = append(finished, f)
+
+			d.mu.Lock()
+			d.record(op, f)
+			d.mu.Unlock()
+		}
+	}
+
+	d.notify(ctx, cfg, op, names, finished)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+
+	for _, name := range names {
+		status, ok := d.repos[name]
+		if !ok {
+			continue
+		}
+
+		status.Running = ""
+
+		if op == remote.Push {
+			status.LastPush = now
+		} else {
+			status.LastFetch = now
+		}
+
+		d.quietUntil[name] = now.Add(cfg.Defaults.Watch.DebounceDelay())
+	}
+}
+
+func (d *Daemon) notify(ctx context.Context, cfg config.Config, op remote.Operation, names []string, finished []mugi.Finished) {
+	key, target := "watch "+op.String(), "all repositories"
+
+	if op == remote.Push {
+		key, target = key+" "+names[0], names[0]
+	}
+
+	for _, err := range notify.Dispatch(ctx, cfg.Defaults.Notify, notify.NewReport(key, op.String(), target, finished)) {
+		d.logf("! %v", err)
+	}
+}
+
+func (d *Daemon) record(op remote.Operation, f mugi.Finished) {
+	task := f.Task
+	arrow := "←"
+
+	if op == remote.Push {
+		arrow = "→"
+	}
+
+	entry := RemoteStatus{Op: op.String(), At: time.Now(), OK: f.Status == mugi.StatusSucceeded}
+
+	switch f.Status {
+	case mugi.StatusBlocked:
+		entry.Error = firstLine(f.Result.Output)
+		d.logf("! %s %s %s %s blocked: %s", op, task.RepoName, arrow, task.RemoteName, entry.Error)
+	case mugi.StatusFailed:
+		entry.Error = firstLine(f.Result.Output)
+		if entry.Error == "" {
+			entry.Error = f.Result.Error.Error()
+		}
+
+		d.logf("✗ %s %s %s %s: %s", op, task.RepoName, arrow, task.RemoteName, entry.Error)
+	default:
+		d.logf("✓ %s %s %s %s", op, task.RepoName, arrow, task.RemoteName)
+	}
+
+	entry.Error = redact.String(entry.Error)
+
+	if status, ok := d.repos[task.RepoName]; ok {
+		status.Remotes[task.RemoteName] = entry
+	}
+}
+
+func (d *Daemon) shutdown() {
+	d.mu.Lock()
+
+	for name, timer := range d.timers {
+		timer.Stop()
+		delete(d.timers, name)
+	}
+
+	d.mu.Unlock()
+
+	close(d.done)
+	d.running.Wait()
+	d.watcher.Close()
+	d.logf("stopped")
+}
+
+func (d *Daemon) logf(format string, args ...any) {
+	message := redact.String(fmt.Sprintf(format, args...))
+
+	fmt.Fprintf(d.log, "%s %s\n", time.Now().Format(time.TimeOnly), message)
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+
+	return s
+}
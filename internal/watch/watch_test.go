@@ -0,0 +1,105 @@
+package watch
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+const testRepo = "ebisu/demo"
+
+func newTestDaemon(debounce time.Duration) *Daemon {
+	return &Daemon{
+		cfg:        config.Config{Defaults: config.Defaults{Watch: config.Watch{Debounce: debounce}}},
+		repos:      map[string]*RepoStatus{testRepo: {Repo: testRepo, Remotes: make(map[string]RemoteStatus)}},
+		quietUntil: make(map[string]time.Time),
+		timers:     make(map[string]*time.Timer),
+		pushes:     make(chan string, 16),
+		requests:   make(chan string),
+		done:       make(chan struct{}),
+	}
+}
+
+func countPushes(d *Daemon, wait time.Duration) int {
+	deadline := time.After(wait)
+
+	var n int
+
+	for {
+		select {
+		case <-d.pushes:
+			n++
+		case <-deadline:
+			return n
+		}
+	}
+}
+
+func TestDebounceCoalescesChanges(t *testing.T) {
+	d := newTestDaemon(20 * time.Millisecond)
+
+	for range 3 {
+		d.mu.Lock()
+		d.debounce(testRepo)
+		d.mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if n := countPushes(d, 200*time.Millisecond); n != 1 {
+		t.Errorf("pushes = %d, want 1", n)
+	}
+}
+
+func TestDebounceAfterTimerFiredPushesOnce(t *testing.T) {
+	d := newTestDaemon(10 * time.Millisecond)
+
+	d.mu.Lock()
+	d.debounce(testRepo)
+	time.Sleep(50 * time.Millisecond)
+	d.debounce(testRepo)
+	d.mu.Unlock()
+
+	if n := countPushes(d, 200*time.Millisecond); n != 1 {
+		t.Errorf("pushes = %d, want 1", n)
+	}
+}
+
+func TestStoppedDaemonDoesNotBlock(t *testing.T) {
+	d := newTestDaemon(time.Millisecond)
+	d.pushes = make(chan string)
+
+	d.mu.Lock()
+	d.debounce(testRepo)
+	d.mu.Unlock()
+
+	close(d.done)
+
+	server, client := net.Pipe()
+	handled := make(chan struct{})
+
+	go func() {
+		d.handle(server)
+		close(handled)
+	}()
+
+	fmt.Fprintln(client, "fetch")
+
+	reply, _ := bufio.NewReader(client).ReadString('\n')
+	client.Close()
+
+	if !strings.Contains(reply, "watch is stopping") {
+		t.Errorf("reply = %q, want watch is stopping", reply)
+	}
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("socket handler blocked after shutdown")
+	}
+}
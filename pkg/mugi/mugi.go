@@ -0,0 +1,195 @@
+package mugi
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ebisu/mugi/internal/config"
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/remote"
+)
+
+type (
+	Config    = config.Config
+	Repo      = config.Repo
+	Hooks     = config.Hooks
+	Operation = remote.Operation
+	Result    = git.Result
+	Runner    = git.Runner
+	Command   = git.Command
+	Output    = git.Output
+)
+
+const (
+	Pull  = remote.Pull
+	Push  = remote.Push
+	Fetch = remote.Fetch
+	All   = remote.All
+)
+
+type Task struct {
+	RepoName   string
+	RemoteName string
+	RemoteURL  string
+	RepoPath   string
+	Op         Operation
+	Skip       string
+	Refspecs   []string
+	Hooks      Hooks
+	Command    []string
+}
+
+func (t Task) Key() string {
+	return t.RepoName + ":" + t.RemoteName
+}
+
+func LoadConfig(path string) (Config, error) {
+	return config.LoadFile(path)
+}
+
+func Plan(cfg Config, selector string, remotes []string, op Operation) []Task {
+	if len(remotes) == 0 {
+		remotes = cfg.Defaults.RemotesFor(op.String())
+	}
+
+	if len(remotes) == 0 {
+		remotes = []string{All}
+	}
+
+	var tasks []Task
+
+	shared := sharedPaths(cfg)
+
+	for _, fullName := range resolveRepos(cfg, selector) {
+		repo := cfg.Repos[fullName]
+
+		for _, remoteName := range resolveRemotes(cfg, repo, remotes) {
+			if url, ok := repo.Remotes[remoteName]; ok {
+				task := Task{
+					RepoName:   fullName,
+					RemoteName: remoteName,
+					RemoteURL:  url,
+					RepoPath:   repo.ExpandPath(),
+					Op:         op,
+					Skip:       shared[fullName],
+					Hooks:      repo.Hooks,
+				}
+
+				if task.Skip == "" {
+					task.Skip = skipReason(repo, remoteName, op)
+				}
+
+				tasks = append(tasks, task)
+			}
+		}
+	}
+
+	return tasks
+}
+
+func PlanCommand(cfg Config, selector string, argv []string) []Task {
+	repos := resolveRepos(cfg, selector)
+	slices.Sort(repos)
+
+	tasks := make([]Task, 0, len(repos))
+	shared := sharedPaths(cfg)
+
+	for _, fullName := range repos {
+		task := Task{
+			RepoName: fullName,
+			RepoPath: cfg.Repos[fullName].ExpandPath(),
+			Command:  argv,
+			Skip:     shared[fullName],
+		}
+
+		if _, err := os.Stat(task.RepoPath); err != nil && task.Skip == "" {
+			task.Skip = "no working copy"
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks
+}
+
+func Runnable(tasks []Task) []Task {
+	runnable := make([]Task, 0, len(tasks))
+
+	for _, task := range tasks {
+		if task.Skip == "" {
+			runnable = append(runnable, task)
+		}
+	}
+
+	return runnable
+}
+
+func sharedPaths(cfg Config) map[string]string {
+	shared := make(map[string]string)
+
+	for _, collision := range cfg.Collisions() {
+		for _, name := range collision.Repos {
+			others := slices.DeleteFunc(slices.Clone(collision.Repos), func(other string) bool {
+				return other == name
+			})
+
+			shared[name] = "path shared with " + strings.Join(others, ", ")
+		}
+	}
+
+	return shared
+}
+
+func skipReason(repo config.Repo, remoteName string, op Operation) string {
+	if op != Push {
+		if repo.Direction(remoteName) == config.DirectionPush {
+			return remoteName + " is push-only"
+		}
+
+		return ""
+	}
+
+	switch {
+	case repo.Mode == config.ModeArchive:
+		return "repository is archived"
+	case repo.Direction(remoteName) != config.DirectionPull:
+		return ""
+	case repo.Mode == config.ModeMirror:
+		return "repository is a pull-only mirror"
+	default:
+		return remoteName + " is pull-only"
+	}
+}
+
+func resolveRepos(cfg Config, name string) []string {
+	if name == All {
+		return cfg.AllRepos()
+	}
+
+	if fullName, _, ok := cfg.FindRepo(name); ok {
+		return []string{fullName}
+	}
+
+	return nil
+}
+
+func resolveRemotes(cfg Config, repo config.Repo, names []string) []string {
+	if len(names) == 1 && names[0] == All {
+		remotes := make([]string, 0, len(repo.Remotes))
+
+		for name := range repo.Remotes {
+			remotes = append(remotes, name)
+		}
+
+		return remotes
+	}
+
+	resolved := make([]string, 0, len(names))
+
+	for _, name := range names {
+		resolved = append(resolved, cfg.ResolveAlias(name))
+	}
+
+	return resolved
+}
@@ -0,0 +1,176 @@
+package mugi
+
+import (
+	"testing"
+
+	"github.com/ebisu/mugi/internal/config"
+)
+
+func TestPlanSkipsSharedPaths(t *testing.T) {
+	cfg := config.Config{
+		Repos: map[string]config.Repo{
+			"ebisu/a-b": {Path: "/src/a-b", Remotes: config.RepoRemotes{"origin": "git@example.com:ebisu/a-b.git"}},
+			"ebisu/a_b": {Path: "/src/a-b", Remotes: config.RepoRemotes{"origin": "git@example.com:ebisu/a_b.git"}},
+			"ebisu/c":   {Path: "/src/c", Remotes: config.RepoRemotes{"origin": "git@example.com:ebisu/c.git"}},
+		},
+	}
+
+	want := map[string]string{
+		"ebisu/a-b": "path shared with ebisu/a_b",
+		"ebisu/a_b": "path shared with ebisu/a-b",
+		"ebisu/c":   "",
+	}
+
+	for _, task := range Plan(cfg, All, nil, Push) {
+		if task.Skip != want[task.RepoName] {
+			t.Errorf("%s skip = %q, want %q", task.RepoName, task.Skip, want[task.RepoName])
+		}
+	}
+
+	for _, task := range PlanCommand(cfg, All, []string{"true"}) {
+		if task.RepoName != "ebisu/c" && task.Skip != want[task.RepoName] {
+			t.Errorf("%s command skip = %q, want %q", task.RepoName, task.Skip, want[task.RepoName])
+		}
+	}
+}
+
+func TestPlanSkipsByModeAndDirection(t *testing.T) {
+	remotes := config.RepoRemotes{
+		"github":   "git@github.com:ebisu/demo.git",
+		"codeberg": "git@codeberg.org:ebisu/demo.git",
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		directions map[string]string
+		op         Operation
+		want       map[string]string
+	}{
+		{
+			name: "normal push",
+			mode: config.ModeNormal,
+			op:   Push,
+			want: map[string]string{"github": "", "codeberg": ""},
+		},
+		{
+			name:       "push-only remote on pull",
+			mode:       config.ModeNormal,
+			directions: map[string]string{"codeberg": config.DirectionPush},
+			op:         Pull,
+			want:       map[string]string{"github": "", "codeberg": "codeberg is push-only"},
+		},
+		{
+			name:       "push-only remote on fetch",
+			mode:       config.ModeNormal,
+			directions: map[string]string{"codeberg": config.DirectionPush},
+			op:         Fetch,
+			want:       map[string]string{"github": "", "codeberg": "codeberg is push-only"},
+		},
+		{
+			name:       "push-only remote on push",
+			mode:       config.ModeNormal,
+			directions: map[string]string{"codeberg": config.DirectionPush},
+			op:         Push,
+			want:       map[string]string{"github": "", "codeberg": ""},
+		},
+		{
+			name:       "fetch-only remote on push",
+			mode:       config.ModeNormal,
+			directions: map[string]string{"github": config.DirectionPull},
+			op:         Push,
+			want:       map[string]string{"github": "github is pull-only", "codeberg": ""},
+		},
+		{
+			name:       "fetch-only remote on fetch",
+			mode:       config.ModeNormal,
+			directions: map[string]string{"github": config.DirectionPull},
+			op:         Fetch,
+			want:       map[string]string{"github": "", "codeberg": ""},
+		},
+		{
+			name: "mirror push",
+			mode: config.ModeMirror,
+			op:   Push,
+			want: map[string]string{"github": "repository is a pull-only mirror", "codeberg": "repository is a pull-only mirror"},
+		},
+		{
+			name:       "mirror with push remote",
+			mode:       config.ModeMirror,
+			directions: map[string]string{"codeberg": config.DirectionBoth},
+			op:         Push,
+			want:       map[string]string{"github": "repository is a pull-only mirror", "codeberg": ""},
+		},
+		{
+			name: "mirror pull",
+			mode: config.ModeMirror,
+			op:   Pull,
+			want: map[string]string{"github": "", "codeberg": ""},
+		},
+		{
+			name:       "archived push ignores directions",
+			mode:       config.ModeArchive,
+			directions: map[string]string{"codeberg": config.DirectionPush},
+			op:         Push,
+			want:       map[string]string{"github": "repository is archived", "codeberg": "repository is archived"},
+		},
+		{
+			name: "archived fetch",
+			mode: config.ModeArchive,
+			op:   Fetch,
+			want: map[string]string{"github": "", "codeberg": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				Repos: map[string]config.Repo{
+					"ebisu/demo": {Path: "/src/demo", Remotes: remotes, Mode: tt.mode, Directions: tt.directions},
+				},
+			}
+
+			tasks := Plan(cfg, All, nil, tt.op)
+			if len(tasks) != len(tt.want) {
+				t.Fatalf("Plan() = %d tasks, want %d", len(tasks), len(tt.want))
+			}
+
+			for _, task := range tasks {
+				if task.Skip != tt.want[task.RemoteName] {
+					t.Errorf("%s skip = %q, want %q", task.RemoteName, task.Skip, tt.want[task.RemoteName])
+				}
+			}
+
+			if got, want := len(Runnable(tasks)), countRunnable(tt.want); got != want {
+				t.Errorf("Runnable() = %d tasks, want %d", got, want)
+			}
+		})
+	}
+}
+
+func countRunnable(skips map[string]string) int {
+	var n int
+
+	for _, skip := range skips {
+		if skip == "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestPlanOmitsRemotesARepoDoesNotUse(t *testing.T) {
+	cfg := config.Config{
+		Remotes: map[string]config.RemoteDefinition{"sourcehut": {Aliases: []string{"sh"}}},
+		Repos: map[string]config.Repo{
+			"ebisu/demo": {Path: "/src/demo", Remotes: config.RepoRemotes{"github": "git@github.com:ebisu/demo.git"}},
+		},
+	}
+
+	tasks := Plan(cfg, All, []string{"github", "sh"}, Push)
+
+	if len(tasks) != 1 || tasks[0].RemoteName != "github" {
+		t.Errorf("Plan() = %+v, want only github", tasks)
+	}
+}
@@ -0,0 +1,389 @@
+package mugi
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/hook"
+)
+
+type Status int
+
+const (
+	StatusSucceeded Status = iota
+	StatusFailed
+	StatusBlocked
+	StatusSkipped
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusSucceeded:
+		return "succeeded"
+	case StatusFailed:
+		return "failed"
+	case StatusBlocked:
+		return "blocked"
+	case StatusSkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+type Stage int
+
+const (
+	StagePreHook Stage = iota
+	StageGit
+	StagePostHook
+	StageCommand
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StagePreHook:
+		return "pre-hook"
+	case StageGit:
+		return "git"
+	case StagePostHook:
+		return "post-hook"
+	case StageCommand:
+		return "command"
+	default:
+		return "unknown"
+	}
+}
+
+type Event interface {
+	event()
+}
+
+type Started struct {
+	Task Task
+}
+
+type Progress struct {
+	Task  Task
+	Stage Stage
+}
+
+type Finished struct {
+	Task   Task
+	Status Status
+	Result Result
+}
+
+func (Started) event()  {}
+func (Progress) event() {}
+func (Finished) event() {}
+
+type Options struct {
+	Force  bool
+	Jobs   int
+	Runner Runner
+}
+
+type Summary struct {
+	Succeeded int
+	Failed    int
+	Blocked   int
+	Skipped   int
+}
+
+func Run(ctx context.Context, tasks []Task, opts Options) <-chan Event {
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		send := func(event Event) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+
+		for _, task := range tasks {
+			if task.Skip != "" {
+				send(Finished{Task: task, Status: StatusSkipped})
+			}
+		}
+
+		client := git.New(opts.Runner)
+		active := Runnable(tasks)
+
+		syncRemotes(ctx, client, active)
+
+		operations := gitOperations(active)
+		repos := repoHookRuns(active)
+		jobs := opts.Jobs
+
+		if jobs < 1 {
+			jobs = len(active)
+		}
+
+		semaphore := make(chan struct{}, max(jobs, 1))
+
+		var wg sync.WaitGroup
+
+	dispatch:
+		for i, task := range active {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				break dispatch
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+
+				send(Started{Task: task})
+
+				progress := func(stage Stage) {
+					send(Progress{Task: task, Stage: stage})
+				}
+
+				send(execute(ctx, client, task, operations[i], opts.Force, repos[task.RepoPath], progress))
+			}()
+		}
+
+		wg.Wait()
+	}()
+
+	return events
+}
+
+func Collect(events <-chan Event) []Finished {
+	var finished []Finished
+
+	for event := range events {
+		if f, ok := event.(Finished); ok {
+			finished = append(finished, f)
+		}
+	}
+
+	return finished
+}
+
+func Summarize(finished []Finished) Summary {
+	var summary Summary
+
+	for _, f := range finished {
+		switch f.Status {
+		case StatusSucceeded:
+			summary.Succeeded++
+		case StatusFailed:
+			summary.Failed++
+		case StatusBlocked:
+			summary.Blocked++
+		case StatusSkipped:
+			summary.Skipped++
+		}
+	}
+
+	return summary
+}
+
+func syncRemotes(ctx context.Context, client git.Client, tasks []Task) {
+	seen := make(map[string]bool)
+
+	for _, task := range tasks {
+		key := task.RepoPath + ":" + task.RemoteName
+
+		if task.Command != nil || seen[key] {
+			continue
+		}
+
+		seen[key] = true
+
+		if !client.IsRepo(ctx, task.RepoPath) {
+			continue
+		}
+
+		currentURL := client.GetRemoteURL(ctx, task.RepoPath, task.RemoteName)
+
+		if currentURL == "" {
+			client.AddRemote(ctx, task.RepoPath, task.RemoteName, task.RemoteURL)
+		} else if currentURL != git.StripCredentials(task.RemoteURL) {
+			client.SetRemoteURL(ctx, task.RepoPath, task.RemoteName, task.RemoteURL)
+		}
+	}
+}
+
+func gitOperations(tasks []Task) []Operation {
+	pulled := make(map[string]bool)
+	operations := make([]Operation, len(tasks))
+
+	for i, task := range tasks {
+		operations[i] = task.Op
+
+		if task.Op != Pull {
+			continue
+		}
+
+		if pulled[task.RepoPath] {
+			operations[i] = Fetch
+		}
+
+		pulled[task.RepoPath] = true
+	}
+
+	return operations
+}
+
+type repoHookRun struct {
+	task      Task
+	remotes   []string
+	pre       sync.Once
+	blocked   *Result
+	mu        sync.Mutex
+	remaining int
+	failed    bool
+	fetchHead sync.Mutex
+}
+
+func repoHookRuns(tasks []Task) map[string]*repoHookRun {
+	runs := make(map[string]*repoHookRun)
+
+	for _, task := range tasks {
+		if task.Command != nil {
+			continue
+		}
+
+		run, ok := runs[task.RepoPath]
+		if !ok {
+			run = &repoHookRun{task: task}
+			runs[task.RepoPath] = run
+		}
+
+		run.remotes = append(run.remotes, task.RemoteName)
+		run.remaining++
+	}
+
+	return runs
+}
+
+func (r *repoHookRun) env() hook.Env {
+	return hook.Env{Repo: r.task.RepoName, Remote: strings.Join(r.remotes, " "), Op: r.task.Op.String()}
+}
+
+func (r *repoHookRun) fail(ctx context.Context, err error, output string) Result {
+	env := r.env()
+	env.ExitCode = hook.ExitCode(err)
+
+	hook.Run(ctx, "on_failure", r.task.Hooks.OnFailure, r.task.RepoPath, env)
+
+	return Result{ExitCode: env.ExitCode, Error: err, Output: strings.TrimSpace(err.Error() + "\n" + output)}
+}
+
+func (r *repoHookRun) before(ctx context.Context, progress func(Stage)) *Result {
+	userOp := r.task.Op.String()
+	command := r.task.Hooks.Pre(userOp)
+
+	if command == "" {
+		return nil
+	}
+
+	progress(StagePreHook)
+
+	r.pre.Do(func() {
+		if output, err := hook.Run(ctx, "pre_"+userOp, command, r.task.RepoPath, r.env()); err != nil {
+			result := r.fail(ctx, err, output)
+			r.blocked = &result
+		}
+	})
+
+	return r.blocked
+}
+
+func (r *repoHookRun) after(ctx context.Context, finished *Finished, progress func(Stage)) {
+	r.mu.Lock()
+
+	r.remaining--
+	r.failed = r.failed || finished.Status != StatusSucceeded
+	last := r.remaining == 0 && !r.failed
+
+	r.mu.Unlock()
+
+	userOp := r.task.Op.String()
+	command := r.task.Hooks.Post(userOp)
+
+	if !last || command == "" {
+		return
+	}
+
+	progress(StagePostHook)
+
+	output, err := hook.Run(ctx, "post_"+userOp, command, r.task.RepoPath, r.env())
+	if err == nil {
+		return
+	}
+
+	result := r.fail(ctx, err, output)
+
+	finished.Status = StatusFailed
+	finished.Result.Error = result.Error
+	finished.Result.ExitCode = result.ExitCode
+	finished.Result.Output = strings.TrimSpace(result.Output + "\n" + finished.Result.Output)
+}
+
+func execute(ctx context.Context, client git.Client, task Task, op Operation, force bool, repo *repoHookRun, progress func(Stage)) Finished {
+	if task.Command != nil {
+		progress(StageCommand)
+
+		return finish(task, client.RunCommand(ctx, task.RepoPath, task.Command), false)
+	}
+
+	var finished Finished
+
+	if blocked := repo.before(ctx, progress); blocked != nil {
+		result := *blocked
+		result.Repo = task.RepoPath
+		result.Remote = task.RemoteName
+
+		finished = finish(task, result, true)
+	} else {
+		progress(StageGit)
+
+		if task.Op == Pull {
+			repo.fetchHead.Lock()
+		}
+
+		result := client.WithCredentials(task.RemoteURL).Execute(ctx, op, task.RepoPath, task.RemoteName, force, task.Refspecs...)
+
+		if task.Op == Pull {
+			repo.fetchHead.Unlock()
+		}
+
+		if result.Error != nil {
+			env := hook.Env{Repo: task.RepoName, Remote: task.RemoteName, Op: task.Op.String(), ExitCode: result.ExitCode}
+
+			hook.Run(ctx, "on_failure", task.Hooks.OnFailure, task.RepoPath, env)
+		}
+
+		finished = finish(task, result, false)
+	}
+
+	repo.after(ctx, &finished, progress)
+
+	return finished
+}
+
+func finish(task Task, result Result, blocked bool) Finished {
+	status := StatusSucceeded
+
+	switch {
+	case blocked:
+		status = StatusBlocked
+	case result.Error != nil:
+		status = StatusFailed
+	}
+
+	return Finished{Task: task, Status: status, Result: result}
+}
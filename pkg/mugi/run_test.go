@@ -0,0 +1,341 @@
+package mugi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ebisu/mugi/internal/git"
+	"github.com/ebisu/mugi/internal/git/gittest"
+)
+
+func TestGitOperations(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []Task
+		want  []Operation
+	}{
+		{
+			name: "first pull per repository",
+			tasks: []Task{
+				{RepoPath: "/a", RemoteName: "origin", Op: Pull},
+				{RepoPath: "/a", RemoteName: "backup", Op: Pull},
+				{RepoPath: "/b", RemoteName: "origin", Op: Pull},
+				{RepoPath: "/a", RemoteName: "mirror", Op: Pull},
+			},
+			want: []Operation{Pull, Fetch, Pull, Fetch},
+		},
+		{
+			name: "push unchanged",
+			tasks: []Task{
+				{RepoPath: "/a", RemoteName: "origin", Op: Push},
+				{RepoPath: "/a", RemoteName: "backup", Op: Push},
+			},
+			want: []Operation{Push, Push},
+		},
+		{
+			name: "fetch unchanged",
+			tasks: []Task{
+				{RepoPath: "/a", RemoteName: "origin", Op: Fetch},
+				{RepoPath: "/a", RemoteName: "backup", Op: Fetch},
+			},
+			want: []Operation{Fetch, Fetch},
+		},
+		{
+			name: "fetch does not count as pull",
+			tasks: []Task{
+				{RepoPath: "/a", RemoteName: "origin", Op: Fetch},
+				{RepoPath: "/a", RemoteName: "backup", Op: Pull},
+			},
+			want: []Operation{Fetch, Pull},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gitOperations(tt.tasks); !slices.Equal(got, tt.want) {
+				t.Errorf("gitOperations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncRemotes(t *testing.T) {
+	origin := Task{RepoPath: "/a", RemoteName: "origin", RemoteURL: "git@example.com:a.git"}
+
+	tests := []struct {
+		name   string
+		tasks  []Task
+		script func(*gittest.Fake)
+		want   []string
+	}{
+		{
+			name:  "adds missing remote",
+			tasks: []Task{origin},
+			script: func(f *gittest.Fake) {
+				f.On("git remote get-url origin", gittest.Response{Exit: 2})
+			},
+			want: []string{
+				"git rev-parse --git-dir",
+				"git remote get-url origin",
+				"git remote add origin git@example.com:a.git",
+			},
+		},
+		{
+			name:  "updates changed url",
+			tasks: []Task{origin},
+			script: func(f *gittest.Fake) {
+				f.On("git remote get-url origin", gittest.Response{Stdout: "git@old.example.com:a.git\n"})
+			},
+			want: []string{
+				"git rev-parse --git-dir",
+				"git remote get-url origin",
+				"git remote set-url origin git@example.com:a.git",
+			},
+		},
+		{
+			name:  "leaves matching url",
+			tasks: []Task{origin},
+			script: func(f *gittest.Fake) {
+				f.On("git remote get-url origin", gittest.Response{Stdout: "git@example.com:a.git\n"})
+			},
+			want: []string{
+				"git rev-parse --git-dir",
+				"git remote get-url origin",
+			},
+		},
+		{
+			name:  "skips missing working copy",
+			tasks: []Task{origin},
+			script: func(f *gittest.Fake) {
+				f.On("git rev-parse --git-dir", gittest.Response{Exit: 128})
+			},
+			want: []string{"git rev-parse --git-dir"},
+		},
+		{
+			name:  "checks each remote once",
+			tasks: []Task{origin, origin},
+			script: func(f *gittest.Fake) {
+				f.On("git remote get-url origin", gittest.Response{Stdout: "git@example.com:a.git\n"})
+			},
+			want: []string{
+				"git rev-parse --git-dir",
+				"git remote get-url origin",
+			},
+		},
+		{
+			name:  "ignores command tasks",
+			tasks: []Task{{RepoPath: "/a", Command: []string{"make"}}},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gittest.NewFake()
+
+			if tt.script != nil {
+				tt.script(fake)
+			}
+
+			syncRemotes(context.Background(), git.New(fake), tt.tasks)
+
+			if got := fake.Argv(); !slices.Equal(got, tt.want) {
+				t.Errorf("argv = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunHooksOncePerRepo(t *testing.T) {
+	tests := []struct {
+		name   string
+		hooks  Hooks
+		script func(*gittest.Fake)
+		log    string
+		status []Status
+		pushes int
+	}{
+		{
+			name:   "pre and post once",
+			hooks:  Hooks{PrePush: "echo pre $MUGI_REMOTE >> log", PostPush: "echo post >> log"},
+			log:    "pre origin backup mirror\npost\n",
+			status: []Status{StatusSucceeded, StatusSucceeded, StatusSucceeded},
+			pushes: 3,
+		},
+		{
+			name:   "failing pre blocks every remote",
+			hooks:  Hooks{PrePush: "echo pre >> log; exit 3", PostPush: "echo post >> log", OnFailure: "echo failure $MUGI_EXIT_CODE >> log"},
+			log:    "pre\nfailure 3\n",
+			status: []Status{StatusBlocked, StatusBlocked, StatusBlocked},
+		},
+		{
+			name:  "post skipped after a failed remote",
+			hooks: Hooks{PostPush: "echo post >> log", OnFailure: "echo failure $MUGI_REMOTE >> log"},
+			script: func(f *gittest.Fake) {
+				f.On("git push backup", gittest.Response{Exit: 1})
+			},
+			log:    "failure backup\n",
+			status: []Status{StatusSucceeded, StatusFailed, StatusSucceeded},
+			pushes: 3,
+		},
+		{
+			name:   "failing post fails one task",
+			hooks:  Hooks{PostPush: "echo post >> log; exit 4"},
+			log:    "post\n",
+			status: []Status{StatusFailed, StatusSucceeded, StatusSucceeded},
+			pushes: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fake := gittest.NewFake()
+
+			fake.On("git remote get-url origin", gittest.Response{Stdout: "o\n"})
+			fake.On("git remote get-url backup", gittest.Response{Stdout: "b\n"})
+			fake.On("git remote get-url mirror", gittest.Response{Stdout: "m\n"})
+
+			if tt.script != nil {
+				tt.script(fake)
+			}
+
+			var tasks []Task
+
+			for _, remote := range []string{"origin", "backup", "mirror"} {
+				tasks = append(tasks, Task{RepoName: "demo", RepoPath: dir, RemoteName: remote, RemoteURL: remote[:1], Op: Push, Hooks: tt.hooks})
+			}
+
+			finished := Collect(Run(context.Background(), tasks, Options{Runner: fake}))
+
+			var statuses []Status
+
+			for _, f := range finished {
+				statuses = append(statuses, f.Status)
+			}
+
+			slices.Sort(statuses)
+
+			want := slices.Clone(tt.status)
+			slices.Sort(want)
+
+			if !slices.Equal(statuses, want) {
+				t.Errorf("statuses = %v, want %v", statuses, want)
+			}
+
+			pushes := 0
+
+			for _, argv := range fake.Argv() {
+				if strings.HasPrefix(argv, "git push") {
+					pushes++
+				}
+			}
+
+			if pushes != tt.pushes {
+				t.Errorf("pushes = %d, want %d", pushes, tt.pushes)
+			}
+
+			log, _ := os.ReadFile(filepath.Join(dir, "log"))
+
+			if string(log) != tt.log {
+				t.Errorf("hook log = %q, want %q", log, tt.log)
+			}
+		})
+	}
+}
+
+type overlapRunner struct {
+	git.Runner
+	mu       sync.Mutex
+	inFlight map[string]int
+	overlaps map[string]int
+	peak     int
+}
+
+func (r *overlapRunner) Run(ctx context.Context, command git.Command) (git.Output, error) {
+	if len(command.Argv) < 2 || (command.Argv[1] != "pull" && command.Argv[1] != "fetch") {
+		return r.Runner.Run(ctx, command)
+	}
+
+	r.mu.Lock()
+	r.inFlight[command.Dir]++
+	r.overlaps[command.Dir] = max(r.overlaps[command.Dir], r.inFlight[command.Dir])
+
+	running := 0
+
+	for _, n := range r.inFlight {
+		running += n
+	}
+
+	r.peak = max(r.peak, running)
+	r.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	r.mu.Lock()
+	r.inFlight[command.Dir]--
+	r.mu.Unlock()
+
+	return r.Runner.Run(ctx, command)
+}
+
+func TestRunPullSerialisesFetchHead(t *testing.T) {
+	runner := &overlapRunner{Runner: gittest.NewFake(), inFlight: make(map[string]int), overlaps: make(map[string]int)}
+
+	var tasks []Task
+
+	for _, remote := range []string{"origin", "backup", "mirror"} {
+		tasks = append(tasks, Task{RepoName: "a", RepoPath: "/a", RemoteName: remote, RemoteURL: remote, Op: Pull})
+	}
+
+	tasks = append(tasks, Task{RepoName: "b", RepoPath: "/b", RemoteName: "origin", RemoteURL: "origin", Op: Pull})
+
+	for _, f := range Collect(Run(context.Background(), tasks, Options{Runner: runner})) {
+		if f.Status != StatusSucceeded {
+			t.Errorf("%s → %s = %v, want succeeded", f.Task.RepoName, f.Task.RemoteName, f.Status)
+		}
+	}
+
+	if runner.overlaps["/a"] != 1 {
+		t.Errorf("concurrent git operations in /a = %d, want 1 so the pull reads its own FETCH_HEAD", runner.overlaps["/a"])
+	}
+
+	if runner.peak < 2 {
+		t.Errorf("concurrent git operations = %d, want repositories to run in parallel", runner.peak)
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	var tasks []Task
+
+	for _, remote := range []string{"origin", "backup", "mirror"} {
+		tasks = append(tasks, Task{RepoName: "demo", RepoPath: "/a", RemoteName: remote, RemoteURL: remote, Op: Fetch})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := Run(ctx, tasks, Options{Jobs: 1, Runner: gittest.NewFake()})
+
+	<-events
+	cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		for range events {
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not close its channel after cancellation")
+	}
+}